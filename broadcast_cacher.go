@@ -0,0 +1,155 @@
+// Copyright 2017 The Xorm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xorm
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+
+	"github.com/caser789/go-xorm/core"
+)
+
+// CacheBus broadcasts messages between the processes sharing a cache store
+type CacheBus interface {
+	Publish(message string) error
+	// Subscribe calls handler for every message published by any process
+	Subscribe(handler func(message string)) error
+}
+
+// BroadcastCacher wraps a Cacher whose store is shared by processes, such as
+// a LRUCacher on a RedisStore. Its deletions are published on the bus and
+// the ones of the other processes are applied to the wrapped Cacher, so that
+// the entries known by its in-process index are evicted too. The
+// invalidation is best-effort: a deletion whose publication fails is logged,
+// and the other processes keep the entries until they expire.
+type BroadcastCacher struct {
+	core.Cacher
+	bus    CacheBus
+	node   string
+	logger errorLogger
+}
+
+// errorLogger is the part of core.ILogger BroadcastCacher logs with
+type errorLogger interface {
+	Errorf(format string, v ...interface{})
+}
+
+// broadcastMessage is a deletion published on the bus
+type broadcastMessage struct {
+	Node  string
+	Op    string
+	Table string
+	Key   string   `json:",omitempty"`
+	Keys  []string `json:",omitempty"`
+}
+
+// NewBroadcastCacher returns a BroadcastCacher subscribed to bus
+func NewBroadcastCacher(cacher core.Cacher, bus CacheBus) (*BroadcastCacher, error) {
+	var id [8]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return nil, err
+	}
+
+	c := &BroadcastCacher{Cacher: cacher, bus: bus, node: hex.EncodeToString(id[:]), logger: NewSimpleLogger(os.Stdout)}
+	if err := bus.Subscribe(c.receive); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// SetLogger sets the logger of the failed publications, a core.ILogger such
+// as the engine's one
+func (c *BroadcastCacher) SetLogger(logger errorLogger) {
+	c.logger = logger
+}
+
+// DelIds implements Cacher
+func (c *BroadcastCacher) DelIds(tableName, sql string) {
+	c.Cacher.DelIds(tableName, sql)
+	c.publish("DelIds", tableName, sql)
+}
+
+// DelBean implements Cacher
+func (c *BroadcastCacher) DelBean(tableName string, id string) {
+	c.Cacher.DelBean(tableName, id)
+	c.publish("DelBean", tableName, id)
+}
+
+// ClearIds implements Cacher
+func (c *BroadcastCacher) ClearIds(tableName string) {
+	c.Cacher.ClearIds(tableName)
+	c.publish("ClearIds", tableName, "")
+}
+
+// ClearBeans implements Cacher
+func (c *BroadcastCacher) ClearBeans(tableName string) {
+	c.Cacher.ClearBeans(tableName)
+	c.publish("ClearBeans", tableName, "")
+}
+
+// PutIdsDeps implements the dependencies of the id lists if the wrapped
+// Cacher does
+func (c *BroadcastCacher) PutIdsDeps(tableName, sql string, ids interface{}, deps CacheIdsDeps) {
+	putIdsDeps(c.Cacher, tableName, sql, ids, deps)
+}
+
+// ClearIdsOfColumns removes the id lists depending on one of cols
+func (c *BroadcastCacher) ClearIdsOfColumns(tableName string, cols []string) {
+	clearIdsOfColumns(c.Cacher, tableName, cols)
+	c.publish("ClearIdsOfColumns", tableName, "", cols...)
+}
+
+// ClearIdsOfBeans removes the id lists which may list one of ids
+func (c *BroadcastCacher) ClearIdsOfBeans(tableName string, ids []string) {
+	clearIdsOfBeans(c.Cacher, tableName, ids)
+	c.publish("ClearIdsOfBeans", tableName, "", ids...)
+}
+
+// Close closes the wrapped Cacher if it's an io.Closer, the subscription
+// lasts as long as the bus
+func (c *BroadcastCacher) Close() error {
+	if closer, ok := c.Cacher.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// publish sends the deletion to the other processes, the Cacher interface
+// can't report the failures so they are logged and the store's expiration
+// is the safety net.
+func (c *BroadcastCacher) publish(op, tableName, key string, keys ...string) {
+	data, err := json.Marshal(&broadcastMessage{Node: c.node, Op: op, Table: tableName, Key: key, Keys: keys})
+	if err == nil {
+		err = c.bus.Publish(string(data))
+	}
+	if err != nil {
+		c.logger.Errorf("[cache] broadcast %s of %s: %v", op, tableName, err)
+	}
+}
+
+func (c *BroadcastCacher) receive(message string) {
+	var msg broadcastMessage
+	if err := json.Unmarshal([]byte(message), &msg); err != nil || msg.Node == c.node {
+		return
+	}
+
+	switch msg.Op {
+	case "DelIds":
+		c.Cacher.DelIds(msg.Table, msg.Key)
+	case "DelBean":
+		c.Cacher.DelBean(msg.Table, msg.Key)
+	case "ClearIds":
+		c.Cacher.ClearIds(msg.Table)
+	case "ClearBeans":
+		c.Cacher.ClearBeans(msg.Table)
+	case "ClearIdsOfColumns":
+		clearIdsOfColumns(c.Cacher, msg.Table, msg.Keys)
+	case "ClearIdsOfBeans":
+		clearIdsOfBeans(c.Cacher, msg.Table, msg.Keys)
+	}
+}
@@ -0,0 +1,199 @@
+// Copyright 2017 The Xorm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xorm
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/go-xorm/core"
+)
+
+// CacheIdsDeps are what a cached id list depends on
+type CacheIdsDeps struct {
+	// Columns are the columns the query of the list refers to, an update of
+	// the other columns doesn't change the list
+	Columns []string
+	// Ids are the listed ids, deleting other records doesn't change the
+	// list. It's nil when it could, as when the query has an offset.
+	Ids []string
+}
+
+func (deps *CacheIdsDeps) hasColumn(cols []string) bool {
+	for _, col := range cols {
+		for _, c := range deps.Columns {
+			if strings.EqualFold(c, col) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (deps *CacheIdsDeps) hasId(ids []string) bool {
+	if deps.Ids == nil {
+		return true
+	}
+	for _, id := range ids {
+		for _, i := range deps.Ids {
+			if i == id {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// depsCacher is implemented by the cachers which remember what their id
+// lists depend on, so that a write only evicts the lists it changes
+type depsCacher interface {
+	PutIdsDeps(tableName, sql string, ids interface{}, deps CacheIdsDeps)
+	// ClearIdsOfColumns removes the id lists depending on one of cols
+	ClearIdsOfColumns(tableName string, cols []string)
+	// ClearIdsOfBeans removes the id lists which may list one of ids
+	ClearIdsOfBeans(tableName string, ids []string)
+}
+
+func putIdsDeps(cacher core.Cacher, tableName, sql string, ids interface{}, deps CacheIdsDeps) {
+	if c, ok := cacher.(depsCacher); ok {
+		c.PutIdsDeps(tableName, sql, ids, deps)
+		return
+	}
+	cacher.PutIds(tableName, sql, ids)
+}
+
+func clearIdsOfColumns(cacher core.Cacher, tableName string, cols []string) {
+	if c, ok := cacher.(depsCacher); ok {
+		c.ClearIdsOfColumns(tableName, cols)
+		return
+	}
+	cacher.ClearIds(tableName)
+}
+
+func clearIdsOfBeans(cacher core.Cacher, tableName string, ids []string) {
+	if c, ok := cacher.(depsCacher); ok {
+		c.ClearIdsOfBeans(tableName, ids)
+		return
+	}
+	cacher.ClearIds(tableName)
+}
+
+// putCacheIds caches the ids selected by sqlStr as core.PutCacheSql does,
+// with their dependencies
+func (session *Session) putCacheIds(cacher core.Cacher, ids []core.PK, tableName, sqlStr string, args interface{}) error {
+	bytes, err := json.Marshal(ids)
+	if err != nil {
+		return err
+	}
+
+	deps := CacheIdsDeps{Columns: session.Statement.RefTable.PrimaryKeys}
+	seen := make(map[string]bool)
+	for _, word := range strings.FieldsFunc(sqlStr, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+	}) {
+		if col := session.Statement.RefTable.GetColumn(word); col != nil && !seen[col.Name] {
+			seen[col.Name] = true
+			deps.Columns = append(deps.Columns, col.Name)
+		}
+	}
+
+	// deleting the records before the offset moves the list
+	if session.Statement.Start == 0 &&
+		indexNoCase(sqlStr, "offset") == -1 &&
+		indexNoCase(sqlStr, "rownum") == -1 &&
+		indexNoCase(sqlStr, "row_number") == -1 {
+		deps.Ids = make([]string, 0, len(ids))
+		for _, id := range ids {
+			sid, err := id.ToString()
+			if err != nil {
+				return err
+			}
+			deps.Ids = append(deps.Ids, sid)
+		}
+	}
+
+	putIdsDeps(cacher, tableName, core.GenSqlKey(sqlStr, args), string(bytes), deps)
+	return nil
+}
+
+// cacheUpdated evicts the id lists depending on the updated columns, which
+// are the "col = value" assignments of colNames, and the updated beans
+func (session *Session) cacheUpdated(colNames []string) {
+	table := session.Statement.RefTable
+	cacher := session.getCacher(table)
+	if cacher == nil || !session.Statement.UseCache {
+		return
+	}
+	tableName := session.Statement.TableName()
+
+	if cols, ok := updatedColumns(session.Engine.QuoteStr(), colNames); ok {
+		session.Engine.logger.Debug("[cache] clear sql of columns:", tableName, cols)
+		clearIdsOfColumns(cacher, tableName, cols)
+	} else {
+		session.Engine.logger.Debug("[cache] clear sql:", tableName)
+		cacher.ClearIds(tableName)
+	}
+
+	if session.Statement.IdParam != nil {
+		if sid, err := session.cacheId(*session.Statement.IdParam); err == nil {
+			session.Engine.logger.Debug("[cache] delete bean:", tableName, sid)
+			cacher.DelBean(tableName, sid)
+			return
+		}
+	}
+	session.Engine.logger.Debug("[cache] clear beans:", tableName)
+	cacher.ClearBeans(tableName)
+}
+
+// cacheId returns the cache id of pk, its values are converted as the ones
+// read by cacheFind
+func (session *Session) cacheId(pk core.PK) (string, error) {
+	cols := session.Statement.RefTable.PKColumns()
+	if len(pk) != len(cols) {
+		return "", ErrCacheFailed
+	}
+
+	var id core.PK = make([]interface{}, len(pk))
+	for i, col := range cols {
+		s := fmt.Sprint(pk[i])
+		if col.SQLType.IsNumeric() {
+			n, err := strconv.ParseInt(s, 10, 64)
+			if err != nil {
+				return "", err
+			}
+			id[i] = n
+		} else if col.SQLType.IsText() {
+			id[i] = s
+		} else {
+			return "", ErrCacheFailed
+		}
+	}
+	return id.ToString()
+}
+
+// updatedColumns returns the names of the columns assigned by colNames, ok
+// is false if one of them can't be parsed
+func updatedColumns(quote string, colNames []string) (cols []string, ok bool) {
+	for _, colName := range colNames {
+		sps := strings.SplitN(colName, "=", 2)
+		if len(sps) != 2 {
+			return nil, false
+		}
+		names := strings.Split(sps[0], ".")
+		name := strings.TrimSpace(names[len(names)-1])
+		if quote != "" {
+			name = strings.Replace(name, quote, "", -1)
+		}
+		name = strings.Trim(name, "`\"[]")
+		if name == "" {
+			return nil, false
+		}
+		cols = append(cols, name)
+	}
+	return cols, true
+}
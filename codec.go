@@ -0,0 +1,156 @@
+// Copyright 2017 The Xorm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xorm
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// Codec serializes the values kept by a CacheStore, which are the cached
+// beans and the encoded id lists, so that they could be shared by processes.
+type Codec interface {
+	Encode(v interface{}) ([]byte, error)
+	Decode(data []byte) (interface{}, error)
+}
+
+var (
+	codecTypesMutex sync.RWMutex
+	codecTypes      = map[string]reflect.Type{
+		"string": reflect.TypeOf(""),
+	}
+)
+
+// registerCodecType records the type of v so that MarshalCodec could decode
+// it, the beans' types are registered by Engine.GobRegister
+func registerCodecType(v interface{}) {
+	t := reflect.TypeOf(v)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	codecTypesMutex.Lock()
+	codecTypes[codecTypeName(t)] = t
+	codecTypesMutex.Unlock()
+}
+
+func codecTypeName(t reflect.Type) string {
+	if t.PkgPath() == "" {
+		return t.String()
+	}
+	return t.PkgPath() + "." + t.Name()
+}
+
+// codecEnvelope keeps the type of an encoded value, Ptr is true if the value
+// was a pointer to it
+type codecEnvelope struct {
+	Type  string
+	Ptr   bool
+	Value []byte
+}
+
+// restorePtr returns v, or a pointer to it if ptr is true
+func restorePtr(v reflect.Value, ptr bool) interface{} {
+	if v.Kind() == reflect.Ptr && !ptr {
+		return v.Elem().Interface()
+	}
+	if v.Kind() != reflect.Ptr && ptr {
+		p := reflect.New(v.Type())
+		p.Elem().Set(v)
+		return p.Interface()
+	}
+	return v.Interface()
+}
+
+// GobCodec encodes the values with encoding/gob, their types must be
+// registered with gob.Register or Engine.GobRegister.
+type GobCodec struct{}
+
+type gobEnvelope struct {
+	Ptr   bool
+	Value interface{}
+}
+
+// Encode implements Codec
+func (GobCodec) Encode(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	env := gobEnvelope{Ptr: reflect.ValueOf(v).Kind() == reflect.Ptr, Value: v}
+	if err := gob.NewEncoder(&buf).Encode(&env); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Decode implements Codec
+func (GobCodec) Decode(data []byte) (interface{}, error) {
+	var env gobEnvelope
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&env); err != nil {
+		return nil, err
+	}
+	if env.Value == nil {
+		return nil, nil
+	}
+	return restorePtr(reflect.ValueOf(env.Value), env.Ptr), nil
+}
+
+// MarshalCodec encodes the values with a pair of marshal functions, such as
+// the ones of encoding/json or of a msgpack package. The types of the values
+// are registered by Engine.GobRegister.
+type MarshalCodec struct {
+	Marshal   func(v interface{}) ([]byte, error)
+	Unmarshal func(data []byte, v interface{}) error
+}
+
+// NewJSONCodec returns a MarshalCodec using encoding/json
+func NewJSONCodec() *MarshalCodec {
+	return &MarshalCodec{Marshal: json.Marshal, Unmarshal: json.Unmarshal}
+}
+
+// NewMsgpackCodec returns a MarshalCodec using the functions of a msgpack
+// package, such as msgpack.Marshal and msgpack.Unmarshal
+func NewMsgpackCodec(marshal func(v interface{}) ([]byte, error), unmarshal func(data []byte, v interface{}) error) *MarshalCodec {
+	return &MarshalCodec{Marshal: marshal, Unmarshal: unmarshal}
+}
+
+// Encode implements Codec
+func (c *MarshalCodec) Encode(v interface{}) ([]byte, error) {
+	rv := reflect.ValueOf(v)
+	env := codecEnvelope{Ptr: rv.Kind() == reflect.Ptr}
+	t := rv.Type()
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	env.Type = codecTypeName(t)
+
+	var err error
+	if env.Value, err = c.Marshal(v); err != nil {
+		return nil, err
+	}
+	return c.Marshal(&env)
+}
+
+// Decode implements Codec
+func (c *MarshalCodec) Decode(data []byte) (interface{}, error) {
+	var env codecEnvelope
+	if err := c.Unmarshal(data, &env); err != nil {
+		return nil, err
+	}
+
+	codecTypesMutex.RLock()
+	t, ok := codecTypes[env.Type]
+	codecTypesMutex.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("codec type %s is not registered", env.Type)
+	}
+
+	p := reflect.New(t)
+	if err := c.Unmarshal(env.Value, p.Interface()); err != nil {
+		return nil, err
+	}
+	return restorePtr(p, env.Ptr), nil
+}
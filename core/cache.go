@@ -10,11 +10,12 @@ import (
 const (
 	// default cache expired time
 	CacheExpired = 60 * time.Minute
-	// not use now
+	// default memory budget of the cached entries in megabytes, a byte
+	// budget of CacheMaxMemory << 20 could be given to a LRUCacher
 	CacheMaxMemory = 256
-	// evey ten minutes to clear all expired nodes
+	// minimum interval between two gc clearing the expired nodes
 	CacheGcInterval = 10 * time.Minute
-	// each time when gc to removed max nodes
+	// not use now, gc removes all the expired nodes
 	CacheGcMaxRemoved = 20
 )
 
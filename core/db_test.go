@@ -1,6 +1,7 @@
 package core
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"os"
@@ -338,3 +339,53 @@ func BenchmarkMapStringQuery(b *testing.B) {
 		rows.Close()
 	}
 }
+
+func TestQueryContextCanceled(t *testing.T) {
+	db, err := Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err = db.QueryContext(ctx, "select 1")
+	if err != context.Canceled {
+		t.Fatalf("expected %v, got %v", context.Canceled, err)
+	}
+
+	_, err = db.BeginTx(ctx, nil)
+	if err != context.Canceled {
+		t.Fatalf("expected %v, got %v", context.Canceled, err)
+	}
+}
+
+func TestStmtQueryContext(t *testing.T) {
+	db, err := Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	_, err = db.ExecContext(context.Background(), createTableSqlite3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stmt, err := db.PrepareContext(context.Background(), "select count(*) from user where name = ?name")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stmt.Close()
+
+	var total int
+	err = stmt.QueryRowContext(context.Background(), "xlw").Scan(&total)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 0 {
+		t.Fatalf("expected 0 rows, got %d", total)
+	}
+}
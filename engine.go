@@ -7,6 +7,7 @@ package xorm
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"database/sql"
 	"encoding/gob"
 	"errors"
@@ -17,6 +18,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-xorm/core"
@@ -35,15 +37,36 @@ type Engine struct {
 
 	mutex  *sync.RWMutex
 	Cacher core.Cacher
+	// cachers are the cachers created by the engine, closed by Close
+	cachers      []core.Cacher
+	resultCacher core.Cacher
+
+	cacheObserver CacheObserver
 
 	showSQL      bool
 	showExecTime bool
 
-	logger     core.ILogger
+	logger core.ILogger
+	// contextLogger logs the statements, a shim of logger unless
+	// SetContextLogger was called
+	contextLogger ContextLogger
+
 	TZLocation *time.Location
 	DatabaseTZ *time.Location // The timezone of the database
 
 	disableGlobalCache bool
+
+	// txMaxRetries is how many times Transaction retries on deadlock or
+	// serialization failure
+	txMaxRetries int
+
+	// poolSettings are the settings of the connection pool by name
+	poolSettings map[string]func(*core.DB)
+
+	tableNameResolvers map[reflect.Type]TableNameResolver
+	// schemas are the tableSchema of the mapped types by reflect.Type and
+	// of the tables read by DBMetas by name
+	schemas sync.Map
 }
 
 // ShowSQL show SQL statment or not on logger if log level is great than INFO
@@ -56,7 +79,8 @@ func (engine *Engine) ShowSQL(show ...bool) {
 	}
 }
 
-// ShowExecTime show SQL statment and execute time or not on logger if log level is great than INFO
+// ShowExecTime show SQL statment and execute time or not on logger if log level is great than INFO.
+// The statements are then logged once executed instead of before.
 func (engine *Engine) ShowExecTime(show ...bool) {
 	if len(show) == 0 {
 		engine.showExecTime = true
@@ -73,9 +97,18 @@ func (engine *Engine) Logger() core.ILogger {
 // SetLogger set the new logger
 func (engine *Engine) SetLogger(logger core.ILogger) {
 	engine.logger = logger
+	engine.contextLogger = &iLoggerShim{logger: logger, engine: engine}
 	engine.dialect.SetLogger(logger)
 }
 
+// SetContextLogger sets a structured logger receiving the context of every
+// statement, and the other messages of the engine at their level
+func (engine *Engine) SetContextLogger(logger ContextLogger) {
+	engine.logger = &contextLoggerShim{logger: logger, showSQL: engine.showSQL}
+	engine.contextLogger = logger
+	engine.dialect.SetLogger(engine.logger)
+}
+
 // SetDisableGlobalCache disable global cache or not
 func (engine *Engine) SetDisableGlobalCache(disable bool) {
 	if engine.disableGlobalCache != disable {
@@ -179,12 +212,36 @@ func (engine *Engine) AutoIncrStr() string {
 
 // SetMaxOpenConns is only available for go 1.2+
 func (engine *Engine) SetMaxOpenConns(conns int) {
-	engine.db.SetMaxOpenConns(conns)
+	engine.setPool("maxOpenConns", func(db *core.DB) {
+		db.SetMaxOpenConns(conns)
+	})
 }
 
 // SetMaxIdleConns set the max idle connections on pool, default is 2
 func (engine *Engine) SetMaxIdleConns(conns int) {
-	engine.db.SetMaxIdleConns(conns)
+	engine.setPool("maxIdleConns", func(db *core.DB) {
+		db.SetMaxIdleConns(conns)
+	})
+}
+
+// SetConnMaxLifetime sets the maximum amount of time a connection may be
+// reused
+func (engine *Engine) SetConnMaxLifetime(d time.Duration) {
+	engine.setPool("connMaxLifetime", func(db *core.DB) {
+		db.SetConnMaxLifetime(d)
+	})
+}
+
+// setPool applies the setting set of the connection pool, which is kept to
+// be applied again when the pool is replaced
+func (engine *Engine) setPool(name string, set func(*core.DB)) {
+	engine.mutex.Lock()
+	if engine.poolSettings == nil {
+		engine.poolSettings = make(map[string]func(*core.DB))
+	}
+	engine.poolSettings[name] = set
+	engine.mutex.Unlock()
+	set(engine.db)
 }
 
 // SetDefaultCacher set the default cacher. Xorm's default not enable cacher.
@@ -192,6 +249,19 @@ func (engine *Engine) SetDefaultCacher(cacher core.Cacher) {
 	engine.Cacher = cacher
 }
 
+// CacheObserver is notified of the cache lookups of Get and Find, op is "get"
+// or "find", and of the results cached by CacheResult, op is "result". A hit
+// means the records were served without querying them.
+type CacheObserver interface {
+	CacheHit(tableName, op string)
+	CacheMiss(tableName, op string)
+}
+
+// SetCacheObserver set the observer of the cache lookups
+func (engine *Engine) SetCacheObserver(observer CacheObserver) {
+	engine.cacheObserver = observer
+}
+
 // NoCache If you has set default cacher, and you want temporilly stop use cache,
 // you can use NoCache()
 func (engine *Engine) NoCache() *Session {
@@ -200,6 +270,14 @@ func (engine *Engine) NoCache() *Session {
 	return session.NoCache()
 }
 
+// Context returns a session whose queries, executions and transactions are
+// bound to ctx, so that cancelling ctx aborts the in-flight statement.
+func (engine *Engine) Context(ctx context.Context) *Session {
+	session := engine.NewSession()
+	session.IsAutoClose = true
+	return session.Context(ctx)
+}
+
 // NoCascade If you do not want to auto cascade load object
 func (engine *Engine) NoCascade() *Session {
 	session := engine.NewSession()
@@ -231,16 +309,80 @@ func (engine *Engine) Dialect() core.Dialect {
 
 // NewSession New a session
 func (engine *Engine) NewSession() *Session {
-	session := &Session{Engine: engine}
+	session := &Session{Engine: engine, id: atomic.AddInt64(&sessionIDs, 1)}
 	session.Init()
 	return session
 }
 
 // Close the engine
 func (engine *Engine) Close() error {
+	engine.mutex.Lock()
+	cachers := engine.cachers
+	engine.cachers = nil
+	engine.mutex.Unlock()
+
+	for _, cacher := range cachers {
+		if closer, ok := cacher.(io.Closer); ok {
+			closer.Close()
+		}
+	}
 	return engine.db.Close()
 }
 
+// SetTransactionRetries set how many times Transaction retries the closure when
+// it fails because of a deadlock or a serialization failure. Default is 0.
+func (engine *Engine) SetTransactionRetries(retries int) {
+	engine.txMaxRetries = retries
+}
+
+// Transaction executes f in a new transaction, which is committed if f returns
+// nil and rolled back if f returns an error or panics. When the transaction
+// fails because of a deadlock or a serialization failure, the whole
+// transaction is retried up to the times set by SetTransactionRetries.
+//
+//	err := engine.Transaction(func(session *Session) error {
+//		if _, err := session.Insert(&user); err != nil {
+//			return err
+//		}
+//		_, err := session.Id(user.Id).Update(&account)
+//		return err
+//	})
+func (engine *Engine) Transaction(f func(*Session) error) error {
+	var err error
+	for i := 0; i <= engine.txMaxRetries; i++ {
+		err = engine.transaction(f)
+		if err == nil || !engine.IsRetryableError(err) {
+			return err
+		}
+		if i < engine.txMaxRetries {
+			engine.logger.Warnf("[transaction] retry %d/%d: %v", i+1, engine.txMaxRetries, err)
+		}
+	}
+	return err
+}
+
+func (engine *Engine) transaction(f func(*Session) error) error {
+	session := engine.NewSession()
+	defer session.Close()
+
+	if err := session.Begin(); err != nil {
+		return err
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			session.Rollback()
+			panic(p)
+		}
+	}()
+
+	if err := f(session); err != nil {
+		session.Rollback()
+		return err
+	}
+	return session.Commit()
+}
+
 // Ping tests if database is alive
 func (engine *Engine) Ping() error {
 	session := engine.NewSession()
@@ -249,45 +391,53 @@ func (engine *Engine) Ping() error {
 	return session.Ping()
 }
 
-// logging sql
-func (engine *Engine) logSQL(sqlStr string, sqlArgs ...interface{}) {
-	if engine.showSQL && !engine.showExecTime {
-		if len(sqlArgs) > 0 {
-			engine.logger.Infof("[sql] %v [args] %v", sqlStr, sqlArgs)
-		} else {
-			engine.logger.Infof("[sql] %v", sqlStr)
-		}
+// logSQL logs a statement to the context logger if ShowSQL is on
+func (engine *Engine) logSQL(ctx LogContext) {
+	if engine.showSQL {
+		engine.contextLogger.LogSQL(ctx)
 	}
 }
 
-func (engine *Engine) logSQLQueryTime(sqlStr string, args []interface{}, executionBlock func() (*core.Stmt, *core.Rows, error)) (*core.Stmt, *core.Rows, error) {
-	if engine.showSQL && engine.showExecTime {
-		b4ExecTime := time.Now()
-		stmt, res, err := executionBlock()
-		execDuration := time.Since(b4ExecTime)
-		if len(args) > 0 {
-			engine.logger.Infof("[sql] %s [args] %v - took: %v", sqlStr, args, execDuration)
-		} else {
-			engine.logger.Infof("[sql] %s - took: %v", sqlStr, execDuration)
-		}
-		return stmt, res, err
+// pendingSQLLog logs the statement of log before it runs, or returns log for
+// the caller to time it when ShowExecTime is on
+func (engine *Engine) pendingSQLLog(log LogContext) *LogContext {
+	if !engine.showSQL {
+		return nil
 	}
-	return executionBlock()
+	if engine.showExecTime {
+		return &log
+	}
+	engine.logSQL(log)
+	return nil
 }
 
-func (engine *Engine) logSQLExecutionTime(sqlStr string, args []interface{}, executionBlock func() (sql.Result, error)) (sql.Result, error) {
-	if engine.showSQL && engine.showExecTime {
-		b4ExecTime := time.Now()
-		res, err := executionBlock()
-		execDuration := time.Since(b4ExecTime)
-		if len(args) > 0 {
-			engine.logger.Infof("[sql] %s [args] %v - took: %v", sqlStr, args, execDuration)
-		} else {
-			engine.logger.Infof("[sql] %s - took: %v", sqlStr, execDuration)
-		}
-		return res, err
+// logSQLQueryTime runs the query of log and logs it with its duration, log
+// is nil when the query isn't logged
+func (engine *Engine) logSQLQueryTime(log *LogContext, executionBlock func() (*core.Stmt, *core.Rows, error)) (*core.Stmt, *core.Rows, error) {
+	if log == nil {
+		return executionBlock()
 	}
-	return executionBlock()
+	b4ExecTime := time.Now()
+	stmt, res, err := executionBlock()
+	log.Duration, log.Err = time.Since(b4ExecTime), err
+	engine.logSQL(*log)
+	return stmt, res, err
+}
+
+// logSQLExecutionTime runs the execution of log and logs it with its
+// duration and the rows it affected, log is nil when it isn't logged
+func (engine *Engine) logSQLExecutionTime(log *LogContext, executionBlock func() (sql.Result, error)) (sql.Result, error) {
+	if log == nil {
+		return executionBlock()
+	}
+	b4ExecTime := time.Now()
+	res, err := executionBlock()
+	log.Duration, log.Err = time.Since(b4ExecTime), err
+	if err == nil && res != nil {
+		log.RowsAffected, _ = res.RowsAffected()
+	}
+	engine.logSQL(*log)
+	return res, err
 }
 
 // Sql will be depracated, please use SQL instead
@@ -318,6 +468,13 @@ func (engine *Engine) NoAutoTime() *Session {
 	return session.NoAutoTime()
 }
 
+// DoNothing makes Upsert keep the existing record instead of updating it
+func (engine *Engine) DoNothing() *Session {
+	session := engine.NewSession()
+	session.IsAutoClose = true
+	return session.DoNothing()
+}
+
 // NoAutoCondition disable auto generate Where condition from bean or not
 func (engine *Engine) NoAutoCondition(no ...bool) *Session {
 	session := engine.NewSession()
@@ -348,11 +505,17 @@ func (engine *Engine) DBMetas() ([]*core.Table, error) {
 		}
 		table.Indexes = indexes
 
+		schema, err := engine.readTableSchema(table.Name)
+		if err != nil {
+			return nil, err
+		}
+		engine.setTableSchema(table.Name, schema)
+
 		for _, index := range indexes {
 			for _, name := range index.Cols {
 				if col := table.GetColumn(name); col != nil {
 					col.Indexes[index.Name] = index.Type
-				} else {
+				} else if !isIndexExpr(name) {
 					return nil, fmt.Errorf("Unknown col "+name+" in indexes %v of table", index, table.ColumnsSeq())
 				}
 			}
@@ -436,8 +599,8 @@ func (engine *Engine) dumpAll(w io.Writer, tp ...core.DbType) error {
 		dialect.Init(nil, engine.dialect.URI(), "", "")
 	}
 
-	_, err = io.WriteString(w, fmt.Sprintf("/*Generated by xorm v%s %s*/\n\n",
-		Version, time.Now().In(engine.TZLocation).Format("2006-01-02 15:04:05")))
+	_, err = io.WriteString(w, fmt.Sprintf("/*Generated by xorm v%s %s, database %s*/\n\n",
+		Version, time.Now().In(engine.TZLocation).Format("2006-01-02 15:04:05"), engine.dialect.URI().DbName))
 	if err != nil {
 		return err
 	}
@@ -449,18 +612,23 @@ func (engine *Engine) dumpAll(w io.Writer, tp ...core.DbType) error {
 				return err
 			}
 		}
-		_, err = io.WriteString(w, dialect.CreateTableSql(table, "", table.StoreEngine, "")+";\n")
+		_, err = io.WriteString(w, engine.createTableSQL(dialect, table, "", table.StoreEngine, "")+";\n")
 		if err != nil {
 			return err
 		}
+		for _, sqlStr := range commentSQLs(dialect, table, "") {
+			if _, err = io.WriteString(w, sqlStr+";\n"); err != nil {
+				return err
+			}
+		}
 		for _, index := range table.Indexes {
-			_, err = io.WriteString(w, dialect.CreateIndexSql(table.Name, index)+";\n")
+			_, err = io.WriteString(w, engine.createIndexSQL(table, table.Name, index)+";\n")
 			if err != nil {
 				return err
 			}
 		}
 
-		rows, err := engine.DB().Query("SELECT * FROM " + engine.Quote(table.Name))
+		rows, err := engine.DB().Query("SELECT " + engine.dumpColumns(table) + " FROM " + engine.Quote(table.Name))
 		if err != nil {
 			return err
 		}
@@ -537,8 +705,9 @@ func (engine *Engine) dumpTables(tables []*core.Table, w io.Writer, tp ...core.D
 		dialect.Init(nil, engine.dialect.URI(), "", "")
 	}
 
-	_, err := io.WriteString(w, fmt.Sprintf("/*Generated by xorm v%s %s, from %s to %s*/\n\n",
-		Version, time.Now().In(engine.TZLocation).Format("2006-01-02 15:04:05"), engine.dialect.DBType(), dialect.DBType()))
+	_, err := io.WriteString(w, fmt.Sprintf("/*Generated by xorm v%s %s, database %s, from %s to %s*/\n\n",
+		Version, time.Now().In(engine.TZLocation).Format("2006-01-02 15:04:05"), engine.dialect.URI().DbName,
+		engine.dialect.DBType(), dialect.DBType()))
 	if err != nil {
 		return err
 	}
@@ -550,18 +719,23 @@ func (engine *Engine) dumpTables(tables []*core.Table, w io.Writer, tp ...core.D
 				return err
 			}
 		}
-		_, err = io.WriteString(w, dialect.CreateTableSql(table, "", table.StoreEngine, "")+";\n")
+		_, err = io.WriteString(w, engine.createTableSQL(dialect, table, "", table.StoreEngine, "")+";\n")
 		if err != nil {
 			return err
 		}
+		for _, sqlStr := range commentSQLs(dialect, table, "") {
+			if _, err = io.WriteString(w, sqlStr+";\n"); err != nil {
+				return err
+			}
+		}
 		for _, index := range table.Indexes {
-			_, err = io.WriteString(w, dialect.CreateIndexSql(table.Name, index)+";\n")
+			_, err = io.WriteString(w, engine.createIndexSQL(table, table.Name, index)+";\n")
 			if err != nil {
 				return err
 			}
 		}
 
-		rows, err := engine.DB().Query("SELECT * FROM " + engine.Quote(table.Name))
+		rows, err := engine.DB().Query("SELECT " + engine.dumpColumns(table) + " FROM " + engine.Quote(table.Name))
 		if err != nil {
 			return err
 		}
@@ -737,6 +911,14 @@ func (engine *Engine) UseBool(columns ...string) *Session {
 	return session.UseBool(columns...)
 }
 
+// Returning reads back the columns of the records changed by Insert,
+// InsertMulti, Update and Delete into the beans
+func (engine *Engine) Returning(cols ...string) *Session {
+	session := engine.NewSession()
+	session.IsAutoClose = true
+	return session.Returning(cols...)
+}
+
 // Omit only not use the paramters as select or update columns
 func (engine *Engine) Omit(columns ...string) *Session {
 	session := engine.NewSession()
@@ -866,10 +1048,12 @@ func (engine *Engine) autoMapType(v reflect.Value) *core.Table {
 	return table
 }
 
-// GobRegister register one struct to gob for cache use
+// GobRegister register one struct to gob and to the marshal codecs for
+// cache use
 func (engine *Engine) GobRegister(v interface{}) *Engine {
 	//fmt.Printf("Type: %[1]T => Data: %[1]#v\n", v)
 	gob.Register(v)
+	registerCodecType(v)
 	return engine
 }
 
@@ -932,10 +1116,18 @@ func (engine *Engine) mapType(v reflect.Value) *core.Table {
 	}
 
 	table.Type = t
+	if tc, ok := v.Interface().(TableComment); ok {
+		table.Comment = tc.TableComment()
+	} else if v.CanAddr() {
+		if tc, ok = v.Addr().Interface().(TableComment); ok {
+			table.Comment = tc.TableComment()
+		}
+	}
 
 	var idFieldColName string
 	var err error
 	var hasCacheTag, hasNoCacheTag bool
+	var schema = &tableSchema{generated: make(map[string]*GeneratedColumn)}
 
 	for i := 0; i < t.NumField(); i++ {
 		tag := t.Field(i).Tag
@@ -975,6 +1167,18 @@ func (engine *Engine) mapType(v reflect.Value) *core.Table {
 								addIndex(indexName, table, col, indexType)
 							}
 						}
+						parentSchema := engine.tableSchema(parentTable)
+						schema.foreignKeys = append(schema.foreignKeys, parentSchema.foreignKeys...)
+						schema.checks = append(schema.checks, parentSchema.checks...)
+						for name, gen := range parentSchema.generated {
+							schema.generated[name] = gen
+						}
+						for name, opts := range parentSchema.indexes {
+							if schema.indexes == nil {
+								schema.indexes = make(map[string]*IndexOptions)
+							}
+							schema.indexes[name] = opts
+						}
 						continue
 					default:
 						//TODO: warning
@@ -984,6 +1188,12 @@ func (engine *Engine) mapType(v reflect.Value) *core.Table {
 				indexNames := make(map[string]int)
 				var isIndex, isUnique bool
 				var preKey string
+				var fk *ForeignKey
+				var onDelete, onUpdate string
+				var check *Check
+				var gen *GeneratedColumn
+				var desc bool
+				var indexExpr, indexWhere, indexMethod string
 				for j, key := range tags {
 					k := strings.ToUpper(key)
 					switch {
@@ -1044,8 +1254,45 @@ func (engine *Engine) mapType(v reflect.Value) *core.Table {
 						indexNames[indexName] = core.UniqueType
 					case k == "UNIQUE":
 						isUnique = true
+					case k == "DESC":
+						desc = true
+					case strings.HasPrefix(k, "EXPR(") && strings.HasSuffix(k, ")"):
+						indexExpr = key[len("EXPR")+1 : len(key)-1]
+					case strings.HasPrefix(k, "WHERE(") && strings.HasSuffix(k, ")"):
+						indexWhere = key[len("WHERE")+1 : len(key)-1]
+					case strings.HasPrefix(k, "USING(") && strings.HasSuffix(k, ")"):
+						indexMethod = key[len("USING")+1 : len(key)-1]
 					case k == "NOTNULL":
 						col.Nullable = false
+					case strings.HasPrefix(k, "FK(") && strings.HasSuffix(k, ")"):
+						refTable, refCol, err := parseForeignKeyRef(key[len("FK")+1 : len(key)-1])
+						if err != nil {
+							engine.logger.Error(err)
+							break
+						}
+						fk = &ForeignKey{RefTable: refTable, RefCols: []string{refCol}}
+					case strings.HasPrefix(k, "ONDELETE(") && strings.HasSuffix(k, ")"):
+						onDelete, err = parseReferentialAction(key[len("ONDELETE")+1 : len(key)-1])
+						if err != nil {
+							engine.logger.Error(err)
+						}
+					case strings.HasPrefix(k, "ONUPDATE(") && strings.HasSuffix(k, ")"):
+						onUpdate, err = parseReferentialAction(key[len("ONUPDATE")+1 : len(key)-1])
+						if err != nil {
+							engine.logger.Error(err)
+						}
+					case strings.HasPrefix(k, "CHECK(") && strings.HasSuffix(k, ")"):
+						check = &Check{Expr: key[len("CHECK")+1 : len(key)-1]}
+					case strings.HasPrefix(k, "GENERATED(") && strings.HasSuffix(k, ")"):
+						gen = &GeneratedColumn{Expr: key[len("GENERATED")+1 : len(key)-1]}
+						col.MapType = core.ONLYFROMDB
+					case k == "STORED":
+						if gen != nil {
+							gen.Stored = true
+						}
+					case k == "VIRTUAL":
+					case strings.HasPrefix(k, "COMMENT(") && strings.HasSuffix(k, ")"):
+						col.Comment = strings.Replace(strings.Trim(key[len("COMMENT")+1:len(key)-1], "'"), "''", "'", -1)
 					case k == "CACHE":
 						if !hasCacheTag {
 							hasCacheTag = true
@@ -1136,6 +1383,20 @@ func (engine *Engine) mapType(v reflect.Value) *core.Table {
 				for indexName, indexType := range indexNames {
 					addIndex(indexName, table, col, indexType)
 				}
+				schema.setIndexOptions(indexNames, col, desc, indexExpr, indexWhere, indexMethod)
+
+				if fk != nil {
+					fk.Cols = []string{col.Name}
+					fk.OnDelete, fk.OnUpdate = onDelete, onUpdate
+					schema.foreignKeys = append(schema.foreignKeys, fk)
+				}
+				if check != nil {
+					check.col = col.Name
+					schema.checks = append(schema.checks, check)
+				}
+				if gen != nil {
+					schema.generated[strings.ToLower(col.Name)] = gen
+				}
 			}
 		} else {
 			var sqlType core.SQLType
@@ -1173,6 +1434,8 @@ func (engine *Engine) mapType(v reflect.Value) *core.Table {
 		table.AutoIncrement = col.Name
 	}
 
+	engine.setTableSchema(t, schema)
+
 	if hasCacheTag {
 		if engine.Cacher != nil { // !nash! use engine's cacher if provided
 			engine.logger.Info("enable cache on table:", table.Name)
@@ -1180,6 +1443,7 @@ func (engine *Engine) mapType(v reflect.Value) *core.Table {
 		} else {
 			engine.logger.Info("enable LRU cache on table:", table.Name)
 			table.Cacher = NewLRUCacher2(NewMemoryStore(), time.Hour, 10000) // !nashtsai! HACK use LRU cacher for now
+			engine.cachers = append(engine.cachers, table.Cacher)
 		}
 	}
 	if hasNoCacheTag {
@@ -1399,6 +1663,31 @@ func (engine *Engine) Sync2(beans ...interface{}) error {
 	return s.Sync2(beans...)
 }
 
+// SyncPlan returns the changes Sync2 would apply to synchronize structs to
+// database tables, without executing any of them.
+func (engine *Engine) SyncPlan(beans ...interface{}) (*SyncPlan, error) {
+	s := engine.NewSession()
+	defer s.Close()
+	return s.SyncPlan(beans...)
+}
+
+// SyncWithOptions synchronizes structs to database tables like Sync2, and also
+// applies the destructive changes enabled by opts: dropping stale columns and
+// indexes, altering the columns' type and nullability.
+func (engine *Engine) SyncWithOptions(opts SyncOptions, beans ...interface{}) error {
+	s := engine.NewSession()
+	defer s.Close()
+	return s.SyncWithOptions(opts, beans...)
+}
+
+// SyncPlanWithOptions returns the changes SyncWithOptions would apply, without
+// executing any of them.
+func (engine *Engine) SyncPlanWithOptions(opts SyncOptions, beans ...interface{}) (*SyncPlan, error) {
+	s := engine.NewSession()
+	defer s.Close()
+	return s.SyncPlanWithOptions(opts, beans...)
+}
+
 func (engine *Engine) unMap(beans ...interface{}) (e error) {
 	engine.mutex.Lock()
 	defer engine.mutex.Unlock()
@@ -1488,6 +1777,28 @@ func (engine *Engine) Query(sql string, paramStr ...interface{}) (resultsSlice [
 	return session.Query(sql, paramStr...)
 }
 
+// QueryString a raw sql and return records as []map[string]string
+func (engine *Engine) QueryString(sql string, paramStr ...interface{}) ([]map[string]string, error) {
+	session := engine.NewSession()
+	defer session.Close()
+	return session.QueryString(sql, paramStr...)
+}
+
+// CacheResult caches the results of the query for ttl, see Session.CacheResult
+func (engine *Engine) CacheResult(ttl time.Duration) *Session {
+	session := engine.NewSession()
+	session.IsAutoClose = true
+	return session.CacheResult(ttl)
+}
+
+// Partitions makes the session read the union of the tables, see
+// Session.Partitions
+func (engine *Engine) Partitions(tableNames ...string) *Session {
+	session := engine.NewSession()
+	session.IsAutoClose = true
+	return session.Partitions(tableNames...)
+}
+
 // Insert one or more records
 func (engine *Engine) Insert(beans ...interface{}) (int64, error) {
 	session := engine.NewSession()
@@ -1502,6 +1813,21 @@ func (engine *Engine) InsertOne(bean interface{}) (int64, error) {
 	return session.InsertOne(bean)
 }
 
+// Upsert insert one record, or update the existing one which conflicts with
+// it on conflictCols, the primary key by default
+func (engine *Engine) Upsert(bean interface{}, conflictCols ...string) (int64, error) {
+	session := engine.NewSession()
+	defer session.Close()
+	return session.Upsert(bean, conflictCols...)
+}
+
+// UpsertMulti insert or update multiple records in one statement
+func (engine *Engine) UpsertMulti(rowsSlicePtr interface{}, conflictCols ...string) (int64, error) {
+	session := engine.NewSession()
+	defer session.Close()
+	return session.UpsertMulti(rowsSlicePtr, conflictCols...)
+}
+
 // Update records, bean's non-empty fields are updated contents,
 // condiBean' non-empty filds are conditions
 // CAUTION:
@@ -1617,8 +1943,10 @@ func (engine *Engine) Import(r io.Reader) ([]sql.Result, error) {
 	for scanner.Scan() {
 		query := strings.Trim(scanner.Text(), " \t\n\r")
 		if len(query) > 0 {
-			engine.logSQL(query)
-			result, err := engine.DB().Exec(query)
+			log := engine.pendingSQLLog(LogContext{SQL: query, Context: context.Background()})
+			result, err := engine.logSQLExecutionTime(log, func() (sql.Result, error) {
+				return engine.DB().Exec(query)
+			})
 			results = append(results, result)
 			if err != nil {
 				return nil, err
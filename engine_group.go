@@ -0,0 +1,209 @@
+// Copyright 2017 The Xorm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xorm
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EngineGroup splits the reads and the writes between a master and its
+// replicas. It has the API of the master Engine: the writes, the
+// transactions and the ForUpdate sessions go to the master, while Get, Find,
+// Count, Sum, Iterate, Rows and the SELECTs of Query are read from a replica
+// chosen by the policy. Only the sessions of the group read from the
+// replicas, the ones of the master Engine keep reading their writes.
+type EngineGroup struct {
+	*Engine
+	slaves []*Engine
+	policy GroupPolicy
+
+	mutex *sync.RWMutex
+	// down tells the replicas ejected by the health check
+	down            []bool
+	stopHealthCheck context.CancelFunc
+}
+
+// NewEngineGroup creates a group of master and slaves, the replicas are
+// chosen by the first of policies, RoundRobinPolicy by default.
+func NewEngineGroup(master *Engine, slaves []*Engine, policies ...GroupPolicy) *EngineGroup {
+	group := &EngineGroup{
+		Engine: master,
+		slaves: slaves,
+		policy: RoundRobinPolicy(),
+		mutex:  &sync.RWMutex{},
+		down:   make([]bool, len(slaves)),
+	}
+	if len(policies) > 0 {
+		group.policy = policies[0]
+	}
+	return group
+}
+
+// Master returns the master engine
+func (group *EngineGroup) Master() *Engine {
+	return group.Engine
+}
+
+// Slaves returns all the replicas, including the ejected ones
+func (group *EngineGroup) Slaves() []*Engine {
+	return group.slaves
+}
+
+// SetPolicy sets the policy choosing the replica to read from
+func (group *EngineGroup) SetPolicy(policy GroupPolicy) {
+	group.mutex.Lock()
+	group.policy = policy
+	group.mutex.Unlock()
+}
+
+// Slave returns the replica to read from, or the master when all the
+// replicas are ejected
+func (group *EngineGroup) Slave() *Engine {
+	group.mutex.RLock()
+	defer group.mutex.RUnlock()
+
+	healthy := make([]int, 0, len(group.slaves))
+	for i := range group.slaves {
+		if !group.down[i] {
+			healthy = append(healthy, i)
+		}
+	}
+	if len(healthy) == 0 {
+		return group.Engine
+	}
+	return group.slaves[group.policy.Slave(group.slaves, healthy)]
+}
+
+// SetHealthCheck pings the replicas every interval, the failing ones are
+// ejected until they answer again. An interval <= 0 stops the checks.
+func (group *EngineGroup) SetHealthCheck(interval time.Duration) {
+	group.mutex.Lock()
+	defer group.mutex.Unlock()
+	if group.stopHealthCheck != nil {
+		group.stopHealthCheck()
+		group.stopHealthCheck = nil
+	}
+	if interval <= 0 {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	group.stopHealthCheck = cancel
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				checkCtx, cancel := context.WithTimeout(ctx, interval)
+				group.checkHealth(checkCtx)
+				cancel()
+			}
+		}
+	}()
+}
+
+// CheckHealth pings the replicas once, ejecting the failing ones and
+// restoring the ones which answer again
+func (group *EngineGroup) CheckHealth() {
+	group.checkHealth(context.Background())
+}
+
+func (group *EngineGroup) checkHealth(ctx context.Context) {
+	for i, slave := range group.slaves {
+		err := slave.DB().PingContext(ctx)
+		if ctx.Err() == context.Canceled {
+			return
+		}
+
+		group.mutex.Lock()
+		wasDown := group.down[i]
+		group.down[i] = err != nil
+		group.mutex.Unlock()
+
+		if err != nil && !wasDown {
+			group.logger.Warnf("[group] eject slave %d %v: %v", i, slave.DataSourceName(), err)
+		} else if err == nil && wasDown {
+			group.logger.Infof("[group] restore slave %d %v", i, slave.DataSourceName())
+		}
+	}
+}
+
+// Ping pings the master and all the replicas
+func (group *EngineGroup) Ping() error {
+	if err := group.Engine.Ping(); err != nil {
+		return err
+	}
+	for _, slave := range group.slaves {
+		if err := slave.Ping(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetMaxOpenConns sets the max open connections of the master and of every
+// replica
+func (group *EngineGroup) SetMaxOpenConns(conns int) {
+	group.Engine.SetMaxOpenConns(conns)
+	for _, slave := range group.slaves {
+		slave.SetMaxOpenConns(conns)
+	}
+}
+
+// SetMaxIdleConns sets the max idle connections of the master and of every
+// replica
+func (group *EngineGroup) SetMaxIdleConns(conns int) {
+	group.Engine.SetMaxIdleConns(conns)
+	for _, slave := range group.slaves {
+		slave.SetMaxIdleConns(conns)
+	}
+}
+
+// Close stops the health check and closes the master and the replicas
+func (group *EngineGroup) Close() error {
+	group.SetHealthCheck(0)
+
+	err := group.Engine.Close()
+	for _, slave := range group.slaves {
+		if e := slave.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// readReplica makes the session read from a replica of its engine group
+// until the returned func is called. It keeps reading from the master in a
+// transaction, with ForUpdate or prepared statements, and when sqlStr, the
+// raw SQL if any, isn't a plain SELECT.
+func (session *Session) readReplica(sqlStr string) func() {
+	group := session.group
+	if group == nil || session.replica != nil || !session.IsAutoCommit ||
+		session.prepareStmt || session.Statement.IsForUpdate || !isPlainSelect(sqlStr) {
+		return func() {}
+	}
+	session.replica = group.Slave().DB()
+	return func() {
+		session.replica = nil
+	}
+}
+
+// isPlainSelect tells if sqlStr only reads, an empty sqlStr is generated by
+// the statement so it does
+func isPlainSelect(sqlStr string) bool {
+	if sqlStr == "" {
+		return true
+	}
+	s := strings.ToLower(strings.TrimSpace(sqlStr))
+	return strings.HasPrefix(s, "select") &&
+		!strings.Contains(s, " for update") &&
+		!strings.Contains(s, " into ")
+}
@@ -0,0 +1,135 @@
+// Copyright 2017 The Xorm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xorm
+
+import (
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// GroupPolicy chooses the replica an EngineGroup reads from
+type GroupPolicy interface {
+	// Slave returns the index in slaves of the replica to read from, one of
+	// healthy which are the indexes of the replicas not ejected. healthy is
+	// never empty.
+	Slave(slaves []*Engine, healthy []int) int
+}
+
+// GroupPolicyHandler is a func used as a GroupPolicy
+type GroupPolicyHandler func(slaves []*Engine, healthy []int) int
+
+// Slave implements GroupPolicy
+func (h GroupPolicyHandler) Slave(slaves []*Engine, healthy []int) int {
+	return h(slaves, healthy)
+}
+
+// RoundRobinPolicy reads from the replicas in turn
+func RoundRobinPolicy() GroupPolicy {
+	var pos uint64
+	return GroupPolicyHandler(func(slaves []*Engine, healthy []int) int {
+		n := atomic.AddUint64(&pos, 1) - 1
+		return healthy[n%uint64(len(healthy))]
+	})
+}
+
+// RandomPolicy reads from a random replica
+func RandomPolicy() GroupPolicy {
+	r := newLockedRand()
+	return GroupPolicyHandler(func(slaves []*Engine, healthy []int) int {
+		return healthy[r.Intn(len(healthy))]
+	})
+}
+
+// WeightRandomPolicy reads from a random replica, weights[i] being the
+// weight of the i-th replica
+func WeightRandomPolicy(weights []int) GroupPolicy {
+	r := newLockedRand()
+	return GroupPolicyHandler(func(slaves []*Engine, healthy []int) int {
+		total := sumWeights(weights, healthy)
+		if total <= 0 {
+			return healthy[r.Intn(len(healthy))]
+		}
+		return pickWeight(weights, healthy, r.Intn(total))
+	})
+}
+
+// WeightRoundRobinPolicy reads from the replicas in turn, the i-th one
+// weights[i] times per round
+func WeightRoundRobinPolicy(weights []int) GroupPolicy {
+	var pos uint64
+	return GroupPolicyHandler(func(slaves []*Engine, healthy []int) int {
+		n := atomic.AddUint64(&pos, 1) - 1
+		total := sumWeights(weights, healthy)
+		if total <= 0 {
+			return healthy[n%uint64(len(healthy))]
+		}
+		return pickWeight(weights, healthy, int(n%uint64(total)))
+	})
+}
+
+// LeastConnPolicy reads from the replica with the least connections in use
+func LeastConnPolicy() GroupPolicy {
+	return GroupPolicyHandler(func(slaves []*Engine, healthy []int) int {
+		best, bestConns := healthy[0], -1
+		for _, i := range healthy {
+			conns := slaves[i].DB().Stats().InUse
+			if bestConns < 0 || conns < bestConns {
+				best, bestConns = i, conns
+			}
+		}
+		return best
+	})
+}
+
+// weight returns the weight of the i-th replica, the replicas without a
+// weight weigh 1
+func weight(weights []int, i int) int {
+	if i < len(weights) {
+		return weights[i]
+	}
+	return 1
+}
+
+func sumWeights(weights []int, healthy []int) int {
+	var total int
+	for _, i := range healthy {
+		if w := weight(weights, i); w > 0 {
+			total += w
+		}
+	}
+	return total
+}
+
+// pickWeight returns the replica of healthy which n falls on, n being less
+// than the sum of their weights
+func pickWeight(weights []int, healthy []int, n int) int {
+	for _, i := range healthy {
+		if w := weight(weights, i); w > 0 {
+			if n < w {
+				return i
+			}
+			n -= w
+		}
+	}
+	return healthy[len(healthy)-1]
+}
+
+// lockedRand is a rand.Rand safe for concurrent use
+type lockedRand struct {
+	mutex sync.Mutex
+	r     *rand.Rand
+}
+
+func newLockedRand() *lockedRand {
+	return &lockedRand{r: rand.New(rand.NewSource(time.Now().UnixNano()))}
+}
+
+func (l *lockedRand) Intn(n int) int {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.r.Intn(n)
+}
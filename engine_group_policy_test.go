@@ -0,0 +1,70 @@
+package xorm
+
+import "testing"
+
+func TestGroupPolicies(t *testing.T) {
+	slaves := []*Engine{{}, {}, {}}
+
+	rr := RoundRobinPolicy()
+	var got []int
+	for i := 0; i < 4; i++ {
+		got = append(got, rr.Slave(slaves, []int{0, 2}))
+	}
+	if !intsEq(got, []int{0, 2, 0, 2}) {
+		t.Errorf("round robin: got %v", got)
+	}
+
+	wrr := WeightRoundRobinPolicy([]int{2, 5, 1})
+	got = nil
+	for i := 0; i < 6; i++ {
+		got = append(got, wrr.Slave(slaves, []int{0, 2}))
+	}
+	if !intsEq(got, []int{0, 0, 2, 0, 0, 2}) {
+		t.Errorf("weight round robin: got %v", got)
+	}
+
+	wr := WeightRandomPolicy([]int{0, 1, 0})
+	for i := 0; i < 10; i++ {
+		if n := wr.Slave(slaves, []int{0, 1, 2}); n != 1 {
+			t.Fatalf("weight random: got %d, expected 1", n)
+		}
+	}
+
+	r := RandomPolicy()
+	for i := 0; i < 10; i++ {
+		if n := r.Slave(slaves, []int{1}); n != 1 {
+			t.Fatalf("random: got %d, expected 1", n)
+		}
+	}
+}
+
+func TestIsPlainSelect(t *testing.T) {
+	var cases = []struct {
+		sql      string
+		expected bool
+	}{
+		{"", true},
+		{" SELECT * FROM user", true},
+		{"select * from user for update", false},
+		{"SELECT * INTO user_copy FROM user", false},
+		{"UPDATE user SET age = 1", false},
+		{"INSERT INTO user (name) VALUES (?)", false},
+	}
+	for _, c := range cases {
+		if got := isPlainSelect(c.sql); got != c.expected {
+			t.Errorf("%s: got %v, expected %v", c.sql, got, c.expected)
+		}
+	}
+}
+
+func intsEq(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
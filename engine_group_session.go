@@ -0,0 +1,374 @@
+// Copyright 2017 The Xorm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xorm
+
+import (
+	"context"
+	"time"
+)
+
+// NewSession returns a session of the master which reads from the replicas,
+// unlike the sessions of Master
+func (group *EngineGroup) NewSession() *Session {
+	session := group.Engine.NewSession()
+	session.group = group
+	return session
+}
+
+// NoCache is Engine.NoCache on a session of the group
+func (group *EngineGroup) NoCache() *Session {
+	session := group.NewSession()
+	session.IsAutoClose = true
+	return session.NoCache()
+}
+
+// Context is Engine.Context on a session of the group
+func (group *EngineGroup) Context(ctx context.Context) *Session {
+	session := group.NewSession()
+	session.IsAutoClose = true
+	return session.Context(ctx)
+}
+
+// NoCascade is Engine.NoCascade on a session of the group
+func (group *EngineGroup) NoCascade() *Session {
+	session := group.NewSession()
+	session.IsAutoClose = true
+	return session.NoCascade()
+}
+
+// Sql is Engine.Sql on a session of the group
+func (group *EngineGroup) Sql(querystring string, args ...interface{}) *Session {
+	session := group.NewSession()
+	session.IsAutoClose = true
+	return session.Sql(querystring, args...)
+}
+
+// SQL is Engine.SQL on a session of the group
+func (group *EngineGroup) SQL(querystring string, args ...interface{}) *Session {
+	session := group.NewSession()
+	session.IsAutoClose = true
+	return session.SQL(querystring, args...)
+}
+
+// NoAutoTime is Engine.NoAutoTime on a session of the group
+func (group *EngineGroup) NoAutoTime() *Session {
+	session := group.NewSession()
+	session.IsAutoClose = true
+	return session.NoAutoTime()
+}
+
+// DoNothing is Engine.DoNothing on a session of the group
+func (group *EngineGroup) DoNothing() *Session {
+	session := group.NewSession()
+	session.IsAutoClose = true
+	return session.DoNothing()
+}
+
+// NoAutoCondition is Engine.NoAutoCondition on a session of the group
+func (group *EngineGroup) NoAutoCondition(no ...bool) *Session {
+	session := group.NewSession()
+	session.IsAutoClose = true
+	return session.NoAutoCondition(no...)
+}
+
+// Cascade is Engine.Cascade on a session of the group
+func (group *EngineGroup) Cascade(trueOrFalse ...bool) *Session {
+	session := group.NewSession()
+	session.IsAutoClose = true
+	return session.Cascade(trueOrFalse...)
+}
+
+// Where is Engine.Where on a session of the group
+func (group *EngineGroup) Where(query interface{}, args ...interface{}) *Session {
+	session := group.NewSession()
+	session.IsAutoClose = true
+	return session.Where(query, args...)
+}
+
+// Id is Engine.Id on a session of the group
+func (group *EngineGroup) Id(id interface{}) *Session {
+	session := group.NewSession()
+	session.IsAutoClose = true
+	return session.Id(id)
+}
+
+// ID is Engine.ID on a session of the group
+func (group *EngineGroup) ID(id interface{}) *Session {
+	session := group.NewSession()
+	session.IsAutoClose = true
+	return session.ID(id)
+}
+
+// Before is Engine.Before on a session of the group
+func (group *EngineGroup) Before(closures func(interface{})) *Session {
+	session := group.NewSession()
+	session.IsAutoClose = true
+	return session.Before(closures)
+}
+
+// After is Engine.After on a session of the group
+func (group *EngineGroup) After(closures func(interface{})) *Session {
+	session := group.NewSession()
+	session.IsAutoClose = true
+	return session.After(closures)
+}
+
+// Charset is Engine.Charset on a session of the group
+func (group *EngineGroup) Charset(charset string) *Session {
+	session := group.NewSession()
+	session.IsAutoClose = true
+	return session.Charset(charset)
+}
+
+// StoreEngine is Engine.StoreEngine on a session of the group
+func (group *EngineGroup) StoreEngine(storeEngine string) *Session {
+	session := group.NewSession()
+	session.IsAutoClose = true
+	return session.StoreEngine(storeEngine)
+}
+
+// Distinct is Engine.Distinct on a session of the group
+func (group *EngineGroup) Distinct(columns ...string) *Session {
+	session := group.NewSession()
+	session.IsAutoClose = true
+	return session.Distinct(columns...)
+}
+
+// Select is Engine.Select on a session of the group
+func (group *EngineGroup) Select(str string) *Session {
+	session := group.NewSession()
+	session.IsAutoClose = true
+	return session.Select(str)
+}
+
+// Cols is Engine.Cols on a session of the group
+func (group *EngineGroup) Cols(columns ...string) *Session {
+	session := group.NewSession()
+	session.IsAutoClose = true
+	return session.Cols(columns...)
+}
+
+// AllCols is Engine.AllCols on a session of the group
+func (group *EngineGroup) AllCols() *Session {
+	session := group.NewSession()
+	session.IsAutoClose = true
+	return session.AllCols()
+}
+
+// MustCols is Engine.MustCols on a session of the group
+func (group *EngineGroup) MustCols(columns ...string) *Session {
+	session := group.NewSession()
+	session.IsAutoClose = true
+	return session.MustCols(columns...)
+}
+
+// UseBool is Engine.UseBool on a session of the group
+func (group *EngineGroup) UseBool(columns ...string) *Session {
+	session := group.NewSession()
+	session.IsAutoClose = true
+	return session.UseBool(columns...)
+}
+
+// Returning is Engine.Returning on a session of the group
+func (group *EngineGroup) Returning(cols ...string) *Session {
+	session := group.NewSession()
+	session.IsAutoClose = true
+	return session.Returning(cols...)
+}
+
+// Omit is Engine.Omit on a session of the group
+func (group *EngineGroup) Omit(columns ...string) *Session {
+	session := group.NewSession()
+	session.IsAutoClose = true
+	return session.Omit(columns...)
+}
+
+// Nullable is Engine.Nullable on a session of the group
+func (group *EngineGroup) Nullable(columns ...string) *Session {
+	session := group.NewSession()
+	session.IsAutoClose = true
+	return session.Nullable(columns...)
+}
+
+// In is Engine.In on a session of the group
+func (group *EngineGroup) In(column string, args ...interface{}) *Session {
+	session := group.NewSession()
+	session.IsAutoClose = true
+	return session.In(column, args...)
+}
+
+// Incr is Engine.Incr on a session of the group
+func (group *EngineGroup) Incr(column string, arg ...interface{}) *Session {
+	session := group.NewSession()
+	session.IsAutoClose = true
+	return session.Incr(column, arg...)
+}
+
+// Decr is Engine.Decr on a session of the group
+func (group *EngineGroup) Decr(column string, arg ...interface{}) *Session {
+	session := group.NewSession()
+	session.IsAutoClose = true
+	return session.Decr(column, arg...)
+}
+
+// SetExpr is Engine.SetExpr on a session of the group
+func (group *EngineGroup) SetExpr(column string, expression string) *Session {
+	session := group.NewSession()
+	session.IsAutoClose = true
+	return session.SetExpr(column, expression)
+}
+
+// Table is Engine.Table on a session of the group
+func (group *EngineGroup) Table(tableNameOrBean interface{}) *Session {
+	session := group.NewSession()
+	session.IsAutoClose = true
+	return session.Table(tableNameOrBean)
+}
+
+// Alias is Engine.Alias on a session of the group
+func (group *EngineGroup) Alias(alias string) *Session {
+	session := group.NewSession()
+	session.IsAutoClose = true
+	return session.Alias(alias)
+}
+
+// Limit is Engine.Limit on a session of the group
+func (group *EngineGroup) Limit(limit int, start ...int) *Session {
+	session := group.NewSession()
+	session.IsAutoClose = true
+	return session.Limit(limit, start...)
+}
+
+// Desc is Engine.Desc on a session of the group
+func (group *EngineGroup) Desc(colNames ...string) *Session {
+	session := group.NewSession()
+	session.IsAutoClose = true
+	return session.Desc(colNames...)
+}
+
+// Asc is Engine.Asc on a session of the group
+func (group *EngineGroup) Asc(colNames ...string) *Session {
+	session := group.NewSession()
+	session.IsAutoClose = true
+	return session.Asc(colNames...)
+}
+
+// OrderBy is Engine.OrderBy on a session of the group
+func (group *EngineGroup) OrderBy(order string) *Session {
+	session := group.NewSession()
+	session.IsAutoClose = true
+	return session.OrderBy(order)
+}
+
+// Join is Engine.Join on a session of the group
+func (group *EngineGroup) Join(joinOperator string, tablename interface{}, condition string, args ...interface{}) *Session {
+	session := group.NewSession()
+	session.IsAutoClose = true
+	return session.Join(joinOperator, tablename, condition, args...)
+}
+
+// GroupBy is Engine.GroupBy on a session of the group
+func (group *EngineGroup) GroupBy(keys string) *Session {
+	session := group.NewSession()
+	session.IsAutoClose = true
+	return session.GroupBy(keys)
+}
+
+// Having is Engine.Having on a session of the group
+func (group *EngineGroup) Having(conditions string) *Session {
+	session := group.NewSession()
+	session.IsAutoClose = true
+	return session.Having(conditions)
+}
+
+// CacheResult is Engine.CacheResult on a session of the group
+func (group *EngineGroup) CacheResult(ttl time.Duration) *Session {
+	session := group.NewSession()
+	session.IsAutoClose = true
+	return session.CacheResult(ttl)
+}
+
+// Partitions is Engine.Partitions on a session of the group
+func (group *EngineGroup) Partitions(tableNames ...string) *Session {
+	session := group.NewSession()
+	session.IsAutoClose = true
+	return session.Partitions(tableNames...)
+}
+
+// Unscoped is Engine.Unscoped on a session of the group
+func (group *EngineGroup) Unscoped() *Session {
+	session := group.NewSession()
+	session.IsAutoClose = true
+	return session.Unscoped()
+}
+
+// Query is Engine.Query on a session of the group
+func (group *EngineGroup) Query(sql string, paramStr ...interface{}) (resultsSlice []map[string][]byte, err error) {
+	session := group.NewSession()
+	defer session.Close()
+	return session.Query(sql, paramStr...)
+}
+
+// QueryString is Engine.QueryString on a session of the group
+func (group *EngineGroup) QueryString(sql string, paramStr ...interface{}) ([]map[string]string, error) {
+	session := group.NewSession()
+	defer session.Close()
+	return session.QueryString(sql, paramStr...)
+}
+
+// Get is Engine.Get on a session of the group
+func (group *EngineGroup) Get(bean interface{}) (bool, error) {
+	session := group.NewSession()
+	defer session.Close()
+	return session.Get(bean)
+}
+
+// Find is Engine.Find on a session of the group
+func (group *EngineGroup) Find(beans interface{}, condiBeans ...interface{}) error {
+	session := group.NewSession()
+	defer session.Close()
+	return session.Find(beans, condiBeans...)
+}
+
+// Iterate is Engine.Iterate on a session of the group
+func (group *EngineGroup) Iterate(bean interface{}, fun IterFunc) error {
+	session := group.NewSession()
+	defer session.Close()
+	return session.Iterate(bean, fun)
+}
+
+// Rows is Engine.Rows on a session of the group
+func (group *EngineGroup) Rows(bean interface{}) (*Rows, error) {
+	session := group.NewSession()
+	return session.Rows(bean)
+}
+
+// Count is Engine.Count on a session of the group
+func (group *EngineGroup) Count(bean interface{}) (int64, error) {
+	session := group.NewSession()
+	defer session.Close()
+	return session.Count(bean)
+}
+
+// Sum is Engine.Sum on a session of the group
+func (group *EngineGroup) Sum(bean interface{}, colName string) (float64, error) {
+	session := group.NewSession()
+	defer session.Close()
+	return session.Sum(bean, colName)
+}
+
+// Sums is Engine.Sums on a session of the group
+func (group *EngineGroup) Sums(bean interface{}, colNames ...string) ([]float64, error) {
+	session := group.NewSession()
+	defer session.Close()
+	return session.Sums(bean, colNames...)
+}
+
+// SumsInt is Engine.SumsInt on a session of the group
+func (group *EngineGroup) SumsInt(bean interface{}, colNames ...string) ([]int64, error) {
+	session := group.NewSession()
+	defer session.Close()
+	return session.SumsInt(bean, colNames...)
+}
@@ -0,0 +1,86 @@
+package xorm
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+type GroupUser struct {
+	Id   int64
+	Name string
+}
+
+// newTestGroup returns a group whose master and replica have a user named
+// after them, the replica isn't replicated so the reads tell where they go
+func newTestGroup(t *testing.T) *EngineGroup {
+	var engines []*Engine
+	for _, name := range []string{"master", "replica"} {
+		engine, err := NewEngine("sqlite3", filepath.Join(t.TempDir(), name+".db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { engine.Close() })
+		if err = engine.Sync2(new(GroupUser)); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = engine.Insert(&GroupUser{Name: name}); err != nil {
+			t.Fatal(err)
+		}
+		engines = append(engines, engine)
+	}
+	return NewEngineGroup(engines[0], engines[1:])
+}
+
+func readName(t *testing.T, session *Session) string {
+	var user GroupUser
+	has, err := session.Id(1).Get(&user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !has {
+		t.Fatal("no user")
+	}
+	return user.Name
+}
+
+func TestEngineGroupRouting(t *testing.T) {
+	group := newTestGroup(t)
+
+	if name := readName(t, group.NewSession()); name != "replica" {
+		t.Errorf("the group read from the %v", name)
+	}
+	var users []GroupUser
+	if err := group.Where("id = ?", 1).Find(&users); err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 1 || users[0].Name != "replica" {
+		t.Errorf("the group found %v", users)
+	}
+	results, err := group.QueryString("SELECT name FROM group_user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results[0]["name"] != "replica" {
+		t.Errorf("the group queried the %v", results[0]["name"])
+	}
+
+	// the master isn't changed by the group
+	if name := readName(t, group.Master().NewSession()); name != "master" {
+		t.Errorf("the master read from the %v", name)
+	}
+	if name := readName(t, group.NewSession().ForUpdate()); name != "master" {
+		t.Errorf("ForUpdate read from the %v", name)
+	}
+
+	session := group.NewSession()
+	defer session.Close()
+	if err := session.Begin(); err != nil {
+		t.Fatal(err)
+	}
+	if name := readName(t, session); name != "master" {
+		t.Errorf("the transaction read from the %v", name)
+	}
+	if err := session.Commit(); err != nil {
+		t.Fatal(err)
+	}
+}
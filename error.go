@@ -2,6 +2,9 @@ package xorm
 
 import (
 	"errors"
+	"fmt"
+	"reflect"
+	"strings"
 )
 
 var (
@@ -12,4 +15,161 @@ var (
 	ErrCacheFailed     error = errors.New("Cache failed")
 	ErrNeedDeletedCond error = errors.New("Delete need at least one condition")
 	ErrNotImplemented  error = errors.New("Not implemented.")
+	ErrNoShard         error = errors.New("No shard")
+	ErrNoShardKey      error = errors.New("No sharding key")
+
+	// constraint violations, use errors.Is to test the error returned by
+	// Insert, Update or Delete and errors.As to get the *ConstraintError
+	ErrUniqueViolation     error = errors.New("Unique constraint violation")
+	ErrForeignKeyViolation error = errors.New("Foreign key constraint violation")
+	ErrNotNullViolation    error = errors.New("Not null constraint violation")
+	ErrCheckViolation      error = errors.New("Check constraint violation")
 )
+
+// ConstraintError is returned when the database rejects a statement because
+// of a constraint. Table, Constraint and Column are empty when the driver
+// doesn't expose them.
+type ConstraintError struct {
+	// Kind is one of ErrUniqueViolation, ErrForeignKeyViolation,
+	// ErrNotNullViolation and ErrCheckViolation
+	Kind       error
+	Table      string
+	Constraint string
+	Column     string
+	// Err is the driver's error
+	Err error
+}
+
+func (e *ConstraintError) Error() string {
+	return fmt.Sprintf("%v: %v", e.Kind, e.Err)
+}
+
+// Unwrap returns the driver's error
+func (e *ConstraintError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is the kind of the violation
+func (e *ConstraintError) Is(target error) bool {
+	return target == e.Kind
+}
+
+// errorClassifier is implemented by the dialects which can recognize the
+// errors returned by their drivers
+type errorClassifier interface {
+	// IsRetryableError returns true if err is a deadlock or a serialization
+	// failure, so that the whole transaction could be retried
+	IsRetryableError(err error) bool
+	// ConstraintError returns the constraint violation err reports, or nil
+	ConstraintError(err error) *ConstraintError
+}
+
+// IsRetryableError returns true if err is a deadlock or a serialization
+// failure according to the engine's dialect
+func (engine *Engine) IsRetryableError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if classifier, ok := engine.dialect.(errorClassifier); ok {
+		return classifier.IsRetryableError(err)
+	}
+	return false
+}
+
+// constraintError translates err into a *ConstraintError when it reports a
+// constraint violation, the table defaults to the statement's one
+func (session *Session) constraintError(err error) error {
+	if err == nil {
+		return nil
+	}
+	classifier, ok := session.Engine.dialect.(errorClassifier)
+	if !ok {
+		return err
+	}
+	ce := classifier.ConstraintError(err)
+	if ce == nil {
+		return err
+	}
+	if ce.Table == "" {
+		ce.Table = session.Statement.TableName()
+	}
+	return ce
+}
+
+// driverErrorField returns the field of the driver's error struct found in
+// err's chain. Reading the field by reflection classifies the drivers' errors
+// without importing all of them.
+func driverErrorField(err error, fieldName string) (reflect.Value, bool) {
+	for err != nil {
+		v := reflect.Indirect(reflect.ValueOf(err))
+		if v.Kind() == reflect.Struct {
+			if f := v.FieldByName(fieldName); f.IsValid() {
+				return f, true
+			}
+		}
+		err = errors.Unwrap(err)
+	}
+	return reflect.Value{}, false
+}
+
+// driverErrorIntCode returns the integer field of the driver's error
+func driverErrorIntCode(err error, fieldName string) (int64, bool) {
+	f, ok := driverErrorField(err, fieldName)
+	if !ok {
+		return 0, false
+	}
+	switch f.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return f.Int(), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(f.Uint()), true
+	}
+	return 0, false
+}
+
+// driverErrorStringCode returns the string field of the driver's error
+func driverErrorStringCode(err error, fieldName string) (string, bool) {
+	f, ok := driverErrorField(err, fieldName)
+	if !ok || f.Kind() != reflect.String {
+		return "", false
+	}
+	return f.String(), true
+}
+
+// driverErrorString returns the first non empty string field of the driver's
+// error among fieldNames
+func driverErrorString(err error, fieldNames ...string) string {
+	for _, name := range fieldNames {
+		if s, ok := driverErrorStringCode(err, name); ok && s != "" {
+			return s
+		}
+	}
+	return ""
+}
+
+// errorContains returns true if err's message contains one of the codes, for
+// the drivers which only report codes in messages like "ORA-00060: ..."
+func errorContains(err error, codes ...string) bool {
+	msg := err.Error()
+	for _, code := range codes {
+		if strings.Contains(msg, code) {
+			return true
+		}
+	}
+	return false
+}
+
+// between returns the part of s between the first start and the following
+// end, or "" if there is none
+func between(s, start, end string) string {
+	i := strings.Index(s, start)
+	if i < 0 {
+		return ""
+	}
+	s = s[i+len(start):]
+	j := strings.Index(s, end)
+	if j < 0 {
+		return ""
+	}
+	return s[:j]
+}
@@ -0,0 +1,226 @@
+package xorm
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+type fakeMysqlError struct {
+	Number  uint16
+	Message string
+}
+
+func (e *fakeMysqlError) Error() string {
+	return fmt.Sprintf("Error %d: %s", e.Number, e.Message)
+}
+
+type fakePqError struct {
+	Code       string
+	Message    string
+	Table      string
+	Constraint string
+	Column     string
+}
+
+func (e *fakePqError) Error() string {
+	return "pq: " + e.Message
+}
+
+type fakePgxError struct {
+	Code           string
+	Message        string
+	TableName      string
+	ConstraintName string
+	ColumnName     string
+}
+
+func (e *fakePgxError) Error() string {
+	return "ERROR: " + e.Message
+}
+
+type fakeMssqlError struct {
+	Number  int32
+	Message string
+}
+
+func (e fakeMssqlError) Error() string {
+	return "mssql: " + e.Message
+}
+
+type fakeSqlite3Error struct {
+	Code         int
+	ExtendedCode int
+	Message      string
+}
+
+func (e fakeSqlite3Error) Error() string {
+	return e.Message
+}
+
+func TestConstraintError(t *testing.T) {
+	var cases = []struct {
+		dialect  errorClassifier
+		err      error
+		expected *ConstraintError
+	}{
+		{&mysql{}, &fakeMysqlError{1062, "Duplicate entry 'a' for key 'UQE_user_name'"},
+			&ConstraintError{Kind: ErrUniqueViolation, Constraint: "UQE_user_name"}},
+		{&mysql{}, &fakeMysqlError{1062, "Duplicate entry 'a' for key 'user.UQE_user_name'"},
+			&ConstraintError{Kind: ErrUniqueViolation, Table: "user", Constraint: "UQE_user_name"}},
+		{&mysql{}, fmt.Errorf("insert: %w", &fakeMysqlError{1452, "Cannot add or update a child row: a foreign key constraint fails " +
+			"(`db`.`post`, CONSTRAINT `FK_post_user_id` FOREIGN KEY (`user_id`) REFERENCES `user` (`id`))"}),
+			&ConstraintError{Kind: ErrForeignKeyViolation, Table: "post", Constraint: "FK_post_user_id", Column: "user_id"}},
+		{&mysql{}, &fakeMysqlError{1048, "Column 'name' cannot be null"},
+			&ConstraintError{Kind: ErrNotNullViolation, Column: "name"}},
+		{&mysql{}, &fakeMysqlError{1364, "Field 'name' doesn't have a default value"},
+			&ConstraintError{Kind: ErrNotNullViolation, Column: "name"}},
+		{&mysql{}, &fakeMysqlError{3819, "Check constraint 'CK_user_age' is violated."},
+			&ConstraintError{Kind: ErrCheckViolation, Constraint: "CK_user_age"}},
+		{&mysql{}, &fakeMysqlError{1213, "Deadlock found"}, nil},
+
+		{&postgres{}, &fakePqError{Code: "23505", Table: "user", Constraint: "UQE_user_name"},
+			&ConstraintError{Kind: ErrUniqueViolation, Table: "user", Constraint: "UQE_user_name"}},
+		{&postgres{}, &fakePgxError{Code: "23503", TableName: "post", ConstraintName: "FK_post_user_id"},
+			&ConstraintError{Kind: ErrForeignKeyViolation, Table: "post", Constraint: "FK_post_user_id"}},
+		{&postgres{}, &fakePgxError{Code: "23502", TableName: "user", ColumnName: "name"},
+			&ConstraintError{Kind: ErrNotNullViolation, Table: "user", Column: "name"}},
+		{&postgres{}, &fakePqError{Code: "23514", Table: "user", Constraint: "CK_user_age"},
+			&ConstraintError{Kind: ErrCheckViolation, Table: "user", Constraint: "CK_user_age"}},
+		{&postgres{}, &fakePqError{Code: "42P01"}, nil},
+
+		{&mssql{}, fakeMssqlError{2627, "Violation of UNIQUE KEY constraint 'UQE_user_name'. Cannot insert duplicate key in object 'dbo.user'."},
+			&ConstraintError{Kind: ErrUniqueViolation, Constraint: "UQE_user_name"}},
+		{&mssql{}, fakeMssqlError{2601, "Cannot insert duplicate key row in object 'dbo.user' with unique index 'UQE_user_name'."},
+			&ConstraintError{Kind: ErrUniqueViolation, Constraint: "UQE_user_name"}},
+		{&mssql{}, fakeMssqlError{547, "The INSERT statement conflicted with the FOREIGN KEY constraint \"FK_post_user_id\"."},
+			&ConstraintError{Kind: ErrForeignKeyViolation, Constraint: "FK_post_user_id"}},
+		{&mssql{}, fakeMssqlError{547, "The INSERT statement conflicted with the CHECK constraint \"CK_user_age\"."},
+			&ConstraintError{Kind: ErrCheckViolation, Constraint: "CK_user_age"}},
+		{&mssql{}, fakeMssqlError{515, "Cannot insert the value NULL into column 'name', table 'db.dbo.user'"},
+			&ConstraintError{Kind: ErrNotNullViolation, Column: "name"}},
+
+		{&oracle{}, errors.New("ORA-00001: unique constraint (SCOTT.UQE_USER_NAME) violated"),
+			&ConstraintError{Kind: ErrUniqueViolation, Constraint: "UQE_USER_NAME"}},
+		{&oracle{}, errors.New("ORA-02291: integrity constraint (SCOTT.FK_POST_USER_ID) violated - parent key not found"),
+			&ConstraintError{Kind: ErrForeignKeyViolation, Constraint: "FK_POST_USER_ID"}},
+		{&oracle{}, errors.New("ORA-01400: cannot insert NULL into (\"SCOTT\".\"USER\".\"NAME\")"),
+			&ConstraintError{Kind: ErrNotNullViolation, Table: "USER", Column: "NAME"}},
+		{&oracle{}, errors.New("ORA-02290: check constraint (SCOTT.CK_USER_AGE) violated"),
+			&ConstraintError{Kind: ErrCheckViolation, Constraint: "CK_USER_AGE"}},
+		{&oracle{}, errors.New("ORA-00942: table or view does not exist"), nil},
+
+		{&sqlite3{}, fakeSqlite3Error{19, 2067, "UNIQUE constraint failed: user.name, user.email"},
+			&ConstraintError{Kind: ErrUniqueViolation, Table: "user", Column: "name"}},
+		{&sqlite3{}, fakeSqlite3Error{19, 1555, "UNIQUE constraint failed: user.id"},
+			&ConstraintError{Kind: ErrUniqueViolation, Table: "user", Column: "id"}},
+		{&sqlite3{}, fakeSqlite3Error{19, 787, "FOREIGN KEY constraint failed"},
+			&ConstraintError{Kind: ErrForeignKeyViolation}},
+		{&sqlite3{}, fakeSqlite3Error{19, 1299, "NOT NULL constraint failed: user.name"},
+			&ConstraintError{Kind: ErrNotNullViolation, Table: "user", Column: "name"}},
+		{&sqlite3{}, fakeSqlite3Error{19, 275, "CHECK constraint failed: CK_user_age"},
+			&ConstraintError{Kind: ErrCheckViolation, Constraint: "CK_user_age"}},
+		{&sqlite3{}, fakeSqlite3Error{5, 5, "database is locked"}, nil},
+
+		{&mysql{}, errors.New("Error 1062: Duplicate entry"), nil},
+	}
+
+	for i, c := range cases {
+		ce := c.dialect.ConstraintError(c.err)
+		if c.expected == nil {
+			if ce != nil {
+				t.Errorf("%d: got %+v for %v, expected nil", i, ce, c.err)
+			}
+			continue
+		}
+		if ce == nil {
+			t.Errorf("%d: got nil for %v", i, c.err)
+			continue
+		}
+		if ce.Kind != c.expected.Kind || ce.Table != c.expected.Table ||
+			ce.Constraint != c.expected.Constraint || ce.Column != c.expected.Column {
+			t.Errorf("%d: got %+v, expected %+v", i, *ce, *c.expected)
+		}
+		if ce.Err != c.err {
+			t.Errorf("%d: the driver's error is lost", i)
+		}
+	}
+}
+
+func TestIsRetryableError(t *testing.T) {
+	var cases = []struct {
+		dialect  errorClassifier
+		err      error
+		expected bool
+	}{
+		{&mysql{}, &fakeMysqlError{1213, "Deadlock found when trying to get lock"}, true},
+		{&mysql{}, fmt.Errorf("update: %w", &fakeMysqlError{1205, "Lock wait timeout exceeded"}), true},
+		{&mysql{}, &fakeMysqlError{1062, "Duplicate entry"}, false},
+		{&postgres{}, &fakePqError{Code: "40001"}, true},
+		{&postgres{}, &fakePgxError{Code: "40P01"}, true},
+		{&postgres{}, &fakePqError{Code: "23505"}, false},
+		{&mssql{}, fakeMssqlError{1205, "chosen as the deadlock victim"}, true},
+		{&mssql{}, fakeMssqlError{2627, "Violation of UNIQUE KEY"}, false},
+		{&oracle{}, errors.New("ORA-00060: deadlock detected while waiting for resource"), true},
+		{&oracle{}, errors.New("ORA-08177: can't serialize access for this transaction"), true},
+		{&oracle{}, errors.New("ORA-00001: unique constraint"), false},
+		{&sqlite3{}, fakeSqlite3Error{5, 5, "database is locked"}, true},
+		{&sqlite3{}, fakeSqlite3Error{19, 2067, "UNIQUE constraint failed"}, false},
+		{&sqlite3{}, errors.New("database is locked"), false},
+	}
+
+	for i, c := range cases {
+		if got := c.dialect.IsRetryableError(c.err); got != c.expected {
+			t.Errorf("%d: got %v for %v", i, got, c.err)
+		}
+	}
+}
+
+func TestBetween(t *testing.T) {
+	var cases = []struct {
+		s, start, end, expected string
+	}{
+		{"for key 'name'", "key '", "'", "name"},
+		{"for key 'name", "key '", "'", ""},
+		{"for index 'name'", "key '", "'", ""},
+		{"(a) (b)", "(", ")", "a"},
+	}
+	for _, c := range cases {
+		if got := between(c.s, c.start, c.end); got != c.expected {
+			t.Errorf("between(%q, %q, %q) = %q, expected %q", c.s, c.start, c.end, got, c.expected)
+		}
+	}
+}
+
+type UniqueUser struct {
+	Id   int64
+	Name string `xorm:"unique"`
+}
+
+func TestSqlite3UniqueViolation(t *testing.T) {
+	engine := newTestEngine(t)
+	if err := engine.Sync2(new(UniqueUser)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := engine.Insert(&UniqueUser{Name: "a"}); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := engine.Insert(&UniqueUser{Name: "a"})
+	if !errors.Is(err, ErrUniqueViolation) {
+		t.Fatalf("got %v, expected a unique violation", err)
+	}
+	if errors.Is(err, ErrForeignKeyViolation) {
+		t.Error("a unique violation is a foreign key violation")
+	}
+	var ce *ConstraintError
+	if !errors.As(err, &ce) {
+		t.Fatalf("%T is not a *ConstraintError", err)
+	}
+	if ce.Table != "unique_user" || ce.Column != "name" {
+		t.Errorf("got table %v and column %v", ce.Table, ce.Column)
+	}
+	if engine.IsRetryableError(err) {
+		t.Error("a unique violation is retryable")
+	}
+}
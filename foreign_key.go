@@ -0,0 +1,174 @@
+// Copyright 2017 The Xorm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xorm
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/go-xorm/core"
+)
+
+// ForeignKey is a foreign key constraint of a table, declared on a field by
+// the tags fk(users.id), ondelete(cascade) and onupdate(cascade)
+type ForeignKey struct {
+	// Name is the name of the constraint, FK_<table>_<columns> if empty
+	Name     string
+	Cols     []string
+	RefTable string
+	RefCols  []string
+	// OnDelete and OnUpdate are the referential actions as "CASCADE" or
+	// "SET NULL", empty for the default of the database
+	OnDelete string
+	OnUpdate string
+}
+
+// ConstraintName returns the name of the constraint on tableName
+func (fk *ForeignKey) ConstraintName(tableName string) string {
+	if fk.Name != "" {
+		return fk.Name
+	}
+	return fmt.Sprintf("FK_%v_%v", tableName, strings.Join(fk.Cols, "_"))
+}
+
+// Equal returns true if fk and fk2 link the same columns
+func (fk *ForeignKey) Equal(fk2 *ForeignKey) bool {
+	return equalNoCase(fk.RefTable, fk2.RefTable) &&
+		equalColsNoCase(fk.Cols, fk2.Cols) && equalColsNoCase(fk.RefCols, fk2.RefCols)
+}
+
+func equalColsNoCase(cols, cols2 []string) bool {
+	if len(cols) != len(cols2) {
+		return false
+	}
+	for i := range cols {
+		if !equalNoCase(cols[i], cols2[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// foreignKeysGetter is implemented by the dialects which can read the foreign
+// keys of a table
+type foreignKeysGetter interface {
+	GetForeignKeys(tableName string) ([]*ForeignKey, error)
+}
+
+// referentialActions are the actions of the ondelete and onupdate tags
+var referentialActions = map[string]bool{
+	"CASCADE":     true,
+	"SET NULL":    true,
+	"SET DEFAULT": true,
+	"RESTRICT":    true,
+	"NO ACTION":   true,
+}
+
+// parseReferentialAction returns the action of the tag value as "set_null"
+// or 'set null'
+func parseReferentialAction(s string) (string, error) {
+	action := strings.ToUpper(strings.Replace(strings.Trim(s, "'"), "_", " ", -1))
+	if !referentialActions[action] {
+		return "", fmt.Errorf("unknown referential action %v", s)
+	}
+	return action, nil
+}
+
+// parseForeignKeyRef parses the "table.column" of a fk tag, the table may be
+// qualified by its schema
+func parseForeignKeyRef(ref string) (string, string, error) {
+	i := strings.LastIndex(ref, ".")
+	if i <= 0 || i == len(ref)-1 {
+		return "", "", fmt.Errorf("foreign key %v is not a table.column", ref)
+	}
+	return ref[:i], ref[i+1:], nil
+}
+
+// ForeignKeys returns the foreign keys of table, either a mapped table or
+// one read by DBMetas
+func (engine *Engine) ForeignKeys(table *core.Table) []*ForeignKey {
+	return engine.tableSchema(table).foreignKeys
+}
+
+// quoteQualified quotes the parts of a name qualified as "schema.table"
+func quoteQualified(dialect core.Dialect, name string) string {
+	parts := strings.Split(name, ".")
+	for i, part := range parts {
+		parts[i] = dialect.Quote(part)
+	}
+	return strings.Join(parts, ".")
+}
+
+// foreignKeySQL returns the constraint clause of fk on tableName
+func foreignKeySQL(dialect core.Dialect, tableName string, fk *ForeignKey) string {
+	quoteCols := func(cols []string) string {
+		quoted := make([]string, len(cols))
+		for i, col := range cols {
+			quoted[i] = dialect.Quote(col)
+		}
+		return strings.Join(quoted, ", ")
+	}
+
+	sql := fmt.Sprintf("CONSTRAINT %v FOREIGN KEY (%v) REFERENCES %v (%v)",
+		dialect.Quote(fk.ConstraintName(tableName)), quoteCols(fk.Cols),
+		quoteQualified(dialect, fk.RefTable), quoteCols(fk.RefCols))
+	if fk.OnDelete != "" {
+		sql += " ON DELETE " + fk.OnDelete
+	}
+	// oracle has no ON UPDATE
+	if fk.OnUpdate != "" && dialect.DBType() != core.ORACLE {
+		sql += " ON UPDATE " + fk.OnUpdate
+	}
+	return sql
+}
+
+// addForeignKeySQL returns the statement adding fk to an existing table
+func (engine *Engine) addForeignKeySQL(tableName string, fk *ForeignKey) string {
+	return fmt.Sprintf("ALTER TABLE %v ADD %v", engine.Quote(tableName),
+		foreignKeySQL(engine.dialect, tableName, fk))
+}
+
+// queryForeignKeys reads the foreign keys of the rows of query, which
+// selects the constraint name, the column, the referenced table, the
+// referenced column, the delete action and the update action of every
+// column ordered by constraint and position
+func queryForeignKeys(db *core.DB, query string, args ...interface{}) ([]*ForeignKey, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var fks []*ForeignKey
+	var fk *ForeignKey
+	for rows.Next() {
+		var name, col, refTable, refCol, onDelete, onUpdate string
+		if err = rows.Scan(&name, &col, &refTable, &refCol, &onDelete, &onUpdate); err != nil {
+			return nil, err
+		}
+		if fk == nil || fk.Name != name {
+			fk = &ForeignKey{
+				Name:     name,
+				RefTable: refTable,
+				OnDelete: normalizeReferentialAction(onDelete),
+				OnUpdate: normalizeReferentialAction(onUpdate),
+			}
+			fks = append(fks, fk)
+		}
+		fk.Cols = append(fk.Cols, col)
+		fk.RefCols = append(fk.RefCols, refCol)
+	}
+	return fks, rows.Err()
+}
+
+// normalizeReferentialAction returns the action as in the tags, empty for
+// the default NO ACTION
+func normalizeReferentialAction(action string) string {
+	action = strings.ToUpper(strings.Replace(strings.TrimSpace(action), "_", " ", -1))
+	if action == "NO ACTION" {
+		return ""
+	}
+	return action
+}
@@ -0,0 +1,58 @@
+package xorm
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEditColumnDefs(t *testing.T) {
+	constraints := []string{"CONSTRAINT FK_a FOREIGN KEY (b) REFERENCES c (d)"}
+	var cases = []struct {
+		sql      string
+		expected string
+	}{
+		{
+			"CREATE TABLE a (id INT, b VARCHAR(10) DEFAULT ')') ENGINE=InnoDB",
+			"CREATE TABLE a (id INT, b VARCHAR(10) DEFAULT ')', CONSTRAINT FK_a FOREIGN KEY (b) REFERENCES c (d)) ENGINE=InnoDB",
+		},
+		{
+			"IF NOT EXISTS (SELECT [name] FROM sys.tables WHERE [name] = 'a' ) CREATE TABLE a (b INT);",
+			"IF NOT EXISTS (SELECT [name] FROM sys.tables WHERE [name] = 'a' ) CREATE TABLE a (b INT, CONSTRAINT FK_a FOREIGN KEY (b) REFERENCES c (d));",
+		},
+	}
+	for _, c := range cases {
+		got := editColumnDefs(c.sql, func(defs []string) []string {
+			return append(defs, constraints...)
+		})
+		if got != c.expected {
+			t.Errorf("got %v", got)
+		}
+	}
+}
+
+func TestParseForeignKeyTags(t *testing.T) {
+	table, col, err := parseForeignKeyRef("public.users.id")
+	if err != nil || table != "public.users" || col != "id" {
+		t.Errorf("got %v %v %v", table, col, err)
+	}
+	if _, _, err = parseForeignKeyRef("users"); err == nil {
+		t.Errorf("a reference without column should fail")
+	}
+
+	if action, err := parseReferentialAction("set_null"); err != nil || action != "SET NULL" {
+		t.Errorf("got %v %v", action, err)
+	}
+	if _, err = parseReferentialAction("drop"); err == nil {
+		t.Errorf("unknown action should fail")
+	}
+}
+
+func TestSplitColumnDefs(t *testing.T) {
+	defs := splitColumnDefs("`id` INTEGER, `price` DECIMAL(10, 2) DEFAULT '1,2', " +
+		"CONSTRAINT `FK_a` FOREIGN KEY (`b`, `c`) REFERENCES `d` (`e`, `f`)")
+	expected := []string{"`id` INTEGER", " `price` DECIMAL(10, 2) DEFAULT '1,2'",
+		" CONSTRAINT `FK_a` FOREIGN KEY (`b`, `c`) REFERENCES `d` (`e`, `f`)"}
+	if !reflect.DeepEqual(defs, expected) {
+		t.Errorf("got %q", defs)
+	}
+}
@@ -5,6 +5,7 @@
 package xorm
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"reflect"
@@ -90,12 +91,19 @@ func str2PK(s string, tp reflect.Type) (interface{}, error) {
 func splitTag(tag string) (tags []string) {
 	tag = strings.TrimSpace(tag)
 	var hasQuote = false
+	var depth = 0
 	var lastIdx = 0
 	for i, t := range tag {
-		if t == '\'' {
+		switch {
+		case t == '\'':
 			hasQuote = !hasQuote
-		} else if t == ' ' {
-			if lastIdx < i && !hasQuote {
+		case hasQuote:
+		case t == '(':
+			depth++
+		case t == ')':
+			depth--
+		case t == ' ':
+			if lastIdx < i && depth == 0 {
 				tags = append(tags, strings.TrimSpace(tag[lastIdx:i]))
 				lastIdx = i + 1
 			}
@@ -358,7 +366,7 @@ func rows2Strings(rows *core.Rows) (resultsSlice []map[string]string, err error)
 		resultsSlice = append(resultsSlice, result)
 	}
 
-	return resultsSlice, nil
+	return resultsSlice, rows.Err()
 }
 
 func rows2maps(rows *core.Rows) (resultsSlice []map[string][]byte, err error) {
@@ -374,7 +382,7 @@ func rows2maps(rows *core.Rows) (resultsSlice []map[string][]byte, err error) {
 		resultsSlice = append(resultsSlice, result)
 	}
 
-	return resultsSlice, nil
+	return resultsSlice, rows.Err()
 }
 
 func row2map(rows *core.Rows, fields []string) (resultsMap map[string][]byte, err error) {
@@ -433,8 +441,8 @@ func row2mapStr(rows *core.Rows, fields []string) (resultsMap map[string]string,
 	return result, nil
 }
 
-func txQuery2(tx *core.Tx, sqlStr string, params ...interface{}) (resultsSlice []map[string]string, err error) {
-	rows, err := tx.Query(sqlStr, params...)
+func txQuery2(ctx context.Context, tx *core.Tx, sqlStr string, params ...interface{}) (resultsSlice []map[string]string, err error) {
+	rows, err := tx.QueryContext(ctx, sqlStr, params...)
 	if err != nil {
 		return nil, err
 	}
@@ -443,13 +451,13 @@ func txQuery2(tx *core.Tx, sqlStr string, params ...interface{}) (resultsSlice [
 	return rows2Strings(rows)
 }
 
-func query2(db *core.DB, sqlStr string, params ...interface{}) (resultsSlice []map[string]string, err error) {
-	s, err := db.Prepare(sqlStr)
+func query2(ctx context.Context, db *core.DB, sqlStr string, params ...interface{}) (resultsSlice []map[string]string, err error) {
+	s, err := db.PrepareContext(ctx, sqlStr)
 	if err != nil {
 		return nil, err
 	}
 	defer s.Close()
-	rows, err := s.Query(params...)
+	rows, err := s.QueryContext(ctx, params...)
 	if err != nil {
 		return nil, err
 	}
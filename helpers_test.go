@@ -11,6 +11,8 @@ func TestSplitTag(t *testing.T) {
 		{"TEXT", []string{"TEXT"}},
 		{"default('2000-01-01 00:00:00')", []string{"default('2000-01-01 00:00:00')"}},
 		{"json  binary", []string{"json", "binary"}},
+		{"check(age >= 0) generated(price * qty) stored", []string{"check(age >= 0)", "generated(price * qty)", "stored"}},
+		{"comment('it''s (a) comment')", []string{"comment('it''s (a) comment')"}},
 	}
 
 	for _, kase := range cases {
@@ -0,0 +1,300 @@
+// Copyright 2017 The Xorm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xorm
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/go-xorm/core"
+)
+
+// IndexOptions are what an index has beyond its ascending columns, declared
+// next to the index or unique tag of a field by the tags desc,
+// expr(lower(email)), where(deleted IS NULL) and using(gin). The tags apply
+// to all the indexes of the field.
+type IndexOptions struct {
+	// Desc are the columns sorted in descending order
+	Desc []string
+	// Exprs are the expressions indexed in place of the columns
+	Exprs map[string]string
+	// Where is the predicate of a partial index on postgres, sqlite and
+	// mssql
+	Where string
+	// Method is the index method as GIN, GIST, BTREE or HASH on postgres, and
+	// FULLTEXT, SPATIAL or HASH on mysql
+	Method string
+}
+
+func (opts *IndexOptions) isEmpty() bool {
+	return len(opts.Desc) == 0 && len(opts.Exprs) == 0 && opts.Where == "" && opts.Method == ""
+}
+
+func (opts *IndexOptions) isDesc(col string) bool {
+	for _, desc := range opts.Desc {
+		if desc == col {
+			return true
+		}
+	}
+	return false
+}
+
+// indexOptionsGetter is implemented by the dialects which can read the
+// options of the indexes of a table
+type indexOptionsGetter interface {
+	GetIndexOptions(tableName string) (map[string]*IndexOptions, error)
+}
+
+// IndexOptions returns the options of the index indexName of table, nil if
+// it's a plain index
+func (engine *Engine) IndexOptions(table *core.Table, indexName string) *IndexOptions {
+	return engine.tableSchema(table).indexes[indexName]
+}
+
+// setIndexOptions adds the options of the index tags of col to the indexes
+// indexNames of schema
+func (schema *tableSchema) setIndexOptions(indexNames map[string]int, col *core.Column, desc bool, expr, where, method string) {
+	if !desc && expr == "" && where == "" && method == "" {
+		return
+	}
+	if schema.indexes == nil {
+		schema.indexes = make(map[string]*IndexOptions)
+	}
+	for indexName := range indexNames {
+		opts, ok := schema.indexes[indexName]
+		if !ok {
+			opts = new(IndexOptions)
+			schema.indexes[indexName] = opts
+		}
+		if desc {
+			opts.Desc = append(opts.Desc, col.Name)
+		}
+		if expr != "" {
+			if opts.Exprs == nil {
+				opts.Exprs = make(map[string]string)
+			}
+			opts.Exprs[col.Name] = expr
+		}
+		if where != "" {
+			opts.Where = where
+		}
+		if method != "" {
+			opts.Method = strings.ToUpper(method)
+		}
+	}
+}
+
+// createIndexSQL returns the statement creating index of table on tableName
+func (engine *Engine) createIndexSQL(table *core.Table, tableName string, index *core.Index) string {
+	if opts := engine.IndexOptions(table, index.Name); opts != nil {
+		return indexSQL(engine.dialect, tableName, index, opts)
+	}
+	// the expressions of an index read by DBMetas are its columns
+	for _, col := range index.Cols {
+		if isIndexExpr(col) {
+			return indexSQL(engine.dialect, tableName, index, new(IndexOptions))
+		}
+	}
+	return engine.dialect.CreateIndexSql(tableName, index)
+}
+
+// createIndexSQLs returns the statements creating the indexes of table on
+// tableName
+func (engine *Engine) createIndexSQLs(table *core.Table, tableName string) []string {
+	var sqls []string
+	for _, name := range sortedIndexNames(table.Indexes) {
+		sqls = append(sqls, engine.createIndexSQL(table, tableName, table.Indexes[name]))
+	}
+	return sqls
+}
+
+// indexSQL returns the CREATE INDEX statement of dialect for index with opts
+func indexSQL(dialect core.Dialect, tableName string, index *core.Index, opts *IndexOptions) string {
+	var kind, using, suffix string
+	if index.Type == core.UniqueType {
+		kind = " UNIQUE"
+	}
+	switch dialect.DBType() {
+	case core.POSTGRES:
+		if opts.Method != "" {
+			using = " USING " + opts.Method
+		}
+	case core.MYSQL:
+		switch opts.Method {
+		case "FULLTEXT", "SPATIAL":
+			kind = " " + opts.Method
+		case "":
+		default:
+			suffix = " USING " + opts.Method
+		}
+	}
+
+	var cols = make([]string, 0, len(index.Cols))
+	for _, col := range index.Cols {
+		entry := indexEntrySQL(dialect, col, opts)
+		if opts.isDesc(col) {
+			entry += " DESC"
+		}
+		cols = append(cols, entry)
+	}
+
+	if opts.Where != "" {
+		switch dialect.DBType() {
+		case core.POSTGRES, core.SQLITE, core.MSSQL:
+			suffix += " WHERE " + opts.Where
+		}
+	}
+	return fmt.Sprintf("CREATE%s INDEX %v ON %v%s (%v)%s", kind, dialect.Quote(index.XName(tableName)),
+		dialect.Quote(tableName), using, strings.Join(cols, ", "), suffix)
+}
+
+// indexEntrySQL returns col in the column list of an index, or the
+// expression indexed in its place
+func indexEntrySQL(dialect core.Dialect, col string, opts *IndexOptions) string {
+	expr, ok := opts.Exprs[col]
+	if !ok {
+		if !isIndexExpr(col) {
+			return dialect.Quote(col)
+		}
+		expr = col
+	}
+	// mysql needs the parentheses around an expression, oracle refuses them
+	if dialect.DBType() == core.ORACLE {
+		return expr
+	}
+	return "(" + expr + ")"
+}
+
+// isIndexExpr tells if an entry of the columns of an index read from the
+// database is an expression
+func isIndexExpr(col string) bool {
+	return strings.ContainsAny(col, "()+-*/|' ")
+}
+
+var indexExprCast = regexp.MustCompile(`::[a-z_]+( varying)?`)
+
+// normalizeIndexExpr returns expr without the quotes, parentheses, casts and
+// spaces the databases add when they store it, to compare it with the tags
+func normalizeIndexExpr(expr string) string {
+	expr = indexExprCast.ReplaceAllString(strings.ToLower(expr), "")
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '\t', '\n', '`', '"', '[', ']', '(', ')':
+			return -1
+		}
+		return r
+	}, expr)
+}
+
+// indexKeys returns the normalized entries of index, and those sorted in
+// descending order
+func indexKeys(index *core.Index, opts *IndexOptions) ([]string, []string) {
+	var keys, desc []string
+	for _, col := range index.Cols {
+		key := col
+		if opts != nil {
+			if expr, ok := opts.Exprs[col]; ok {
+				key = expr
+			}
+			if opts.isDesc(col) {
+				desc = append(desc, normalizeIndexExpr(key))
+			}
+		}
+		keys = append(keys, normalizeIndexExpr(key))
+	}
+	return keys, desc
+}
+
+// sameIndexCols tells if index and index2 are on the same columns or
+// expressions, in any order like core.Index.Equal
+func sameIndexCols(index *core.Index, opts *IndexOptions, index2 *core.Index, opts2 *IndexOptions) bool {
+	keys, _ := indexKeys(index, opts)
+	keys2, _ := indexKeys(index2, opts2)
+	return sliceEq(keys, keys2)
+}
+
+// sameIndexOptions tells if index and index2, on the same columns, have the
+// same type, order, predicate and method
+func sameIndexOptions(index *core.Index, opts *IndexOptions, index2 *core.Index, opts2 *IndexOptions) bool {
+	if index.Type != index2.Type {
+		return false
+	}
+	_, desc := indexKeys(index, opts)
+	_, desc2 := indexKeys(index2, opts2)
+	if !sliceEq(desc, desc2) {
+		return false
+	}
+	if opts == nil {
+		opts = new(IndexOptions)
+	}
+	if opts2 == nil {
+		opts2 = new(IndexOptions)
+	}
+	return normalizeIndexExpr(opts.Where) == normalizeIndexExpr(opts2.Where) &&
+		normalizeIndexMethod(opts.Method) == normalizeIndexMethod(opts2.Method)
+}
+
+// normalizeIndexMethod returns the method in upper case, empty for the
+// default BTREE
+func normalizeIndexMethod(method string) string {
+	method = strings.ToUpper(method)
+	if method == "BTREE" {
+		return ""
+	}
+	return method
+}
+
+// parseIndexDef parses the columns and the options of a CREATE INDEX
+// statement, as sqlite stores it and postgres' pg_get_indexdef returns it
+func parseIndexDef(def string) ([]string, *IndexOptions) {
+	var opts = new(IndexOptions)
+	on := strings.Index(strings.ToUpper(def), " ON ")
+	if on < 0 {
+		return nil, nil
+	}
+	start := strings.Index(def[on:], "(")
+	if start < 0 {
+		return nil, nil
+	}
+	start += on
+	end := closingParen(def, start)
+	if end < 0 {
+		return nil, nil
+	}
+	if i := strings.Index(strings.ToUpper(def[on:start]), " USING "); i >= 0 {
+		opts.Method = normalizeIndexMethod(strings.TrimSpace(def[on+i+len(" USING ") : start]))
+	}
+
+	var cols []string
+	for _, entry := range splitColumnDefs(def[start+1 : end]) {
+		entry = strings.TrimSpace(entry)
+		upper := strings.ToUpper(entry)
+		var desc bool
+		if strings.HasSuffix(upper, " DESC") {
+			desc = true
+			entry = strings.TrimSpace(entry[:len(entry)-len(" DESC")])
+		} else if strings.HasSuffix(upper, " ASC") {
+			entry = strings.TrimSpace(entry[:len(entry)-len(" ASC")])
+		}
+		if strings.HasPrefix(entry, "(") && closingParen(entry, 0) == len(entry)-1 {
+			entry = strings.TrimSpace(entry[1 : len(entry)-1])
+		} else if !isIndexExpr(strings.Trim(entry, "`\"[]")) {
+			entry = strings.Trim(entry, "`\"[]")
+		}
+		cols = append(cols, entry)
+		if desc {
+			opts.Desc = append(opts.Desc, entry)
+		}
+	}
+
+	if i := strings.Index(strings.ToUpper(def[end:]), " WHERE "); i >= 0 {
+		opts.Where = trimParens(def[end+i+len(" WHERE "):])
+	}
+	if opts.isEmpty() {
+		opts = nil
+	}
+	return cols, opts
+}
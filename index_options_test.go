@@ -0,0 +1,65 @@
+package xorm
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/go-xorm/core"
+)
+
+func TestParseIndexDef(t *testing.T) {
+	cols, opts := parseIndexDef(`CREATE UNIQUE INDEX "UQE_user_email" ON public."user" USING btree (lower((email)::text), created DESC) WHERE (deleted IS NULL)`)
+	if !reflect.DeepEqual(cols, []string{"lower((email)::text)", "created"}) {
+		t.Errorf("got %q", cols)
+	}
+	expected := &IndexOptions{Desc: []string{"created"}, Where: "deleted IS NULL"}
+	if !reflect.DeepEqual(opts, expected) {
+		t.Errorf("got %+v", opts)
+	}
+
+	cols, opts = parseIndexDef("CREATE INDEX `IDX_user_name` ON `user` (`name`)")
+	if !reflect.DeepEqual(cols, []string{"name"}) || opts != nil {
+		t.Errorf("got %q %+v", cols, opts)
+	}
+}
+
+func TestIndexSQL(t *testing.T) {
+	index := &core.Index{Name: "doc", Type: core.IndexType, Cols: []string{"doc", "created"}}
+	opts := &IndexOptions{Desc: []string{"created"}, Where: "deleted IS NULL", Method: "HASH"}
+	var cases = []struct {
+		dialect  core.Dialect
+		dbType   core.DbType
+		expected string
+	}{
+		{&postgres{}, core.POSTGRES, `CREATE INDEX "IDX_t_doc" ON "t" USING HASH ("doc", "created" DESC) WHERE deleted IS NULL`},
+		{&mysql{}, core.MYSQL, "CREATE INDEX `IDX_t_doc` ON `t` (`doc`, `created` DESC) USING HASH"},
+	}
+	for _, c := range cases {
+		c.dialect.Init(nil, &core.Uri{DbType: c.dbType}, "", "")
+		if got := indexSQL(c.dialect, "t", index, opts); got != c.expected {
+			t.Errorf("%v: got %v", c.dbType, got)
+		}
+	}
+
+	dialect := &mysql{}
+	dialect.Init(nil, &core.Uri{DbType: core.MYSQL}, "", "")
+	expected := "CREATE FULLTEXT INDEX `IDX_t_doc` ON `t` (`doc`, (lower(name)))"
+	got := indexSQL(dialect, "t", &core.Index{Name: "doc", Type: core.IndexType, Cols: []string{"doc", "name"}},
+		&IndexOptions{Exprs: map[string]string{"name": "lower(name)"}, Method: "FULLTEXT"})
+	if got != expected {
+		t.Errorf("got %v", got)
+	}
+}
+
+func TestSameIndex(t *testing.T) {
+	index := &core.Index{Type: core.UniqueType, Cols: []string{"email"}}
+	opts := &IndexOptions{Exprs: map[string]string{"email": "lower(email)"}, Where: "deleted IS NULL"}
+	index2 := &core.Index{Type: core.UniqueType, Cols: []string{"lower((email)::text)"}}
+	opts2 := &IndexOptions{Where: "(deleted IS NULL)", Method: "btree"}
+	if !sameIndexCols(index, opts, index2, opts2) || !sameIndexOptions(index, opts, index2, opts2) {
+		t.Errorf("indexes should be the same")
+	}
+	if sameIndexOptions(index, opts, index2, nil) {
+		t.Errorf("a partial index is not the same as a full one")
+	}
+}
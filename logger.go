@@ -5,9 +5,11 @@
 package xorm
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"log"
+	"time"
 
 	"github.com/go-xorm/core"
 )
@@ -160,3 +162,150 @@ func (s *SimpleLogger) ShowSQL(show ...bool) {
 func (s *SimpleLogger) IsShowSQL() bool {
 	return s.showSQL
 }
+
+// LogContext is what a ContextLogger receives for each statement. Duration,
+// RowsAffected and Err are set for the statements of the CRUD operations and
+// of Exec, Query and Import, which are timed when ShowExecTime is on.
+type LogContext struct {
+	SQL      string
+	Args     []interface{}
+	Duration time.Duration
+	// RowsAffected is the number of rows affected by an execution
+	RowsAffected int64
+	Err          error
+	// Table is the table of the operation, empty for raw SQL
+	Table string
+	// SessionID identifies the session which ran the statement
+	SessionID int64
+	// Context is the context of the session which ran the statement, given
+	// by Session.Context, context.Background() by default
+	Context context.Context
+}
+
+// Fields returns the fields of ctx as alternating keys and values, leaving
+// out the empty ones
+func (ctx *LogContext) Fields() []interface{} {
+	fields := []interface{}{"sql", ctx.SQL}
+	if len(ctx.Args) > 0 {
+		fields = append(fields, "args", ctx.Args)
+	}
+	if ctx.Duration > 0 {
+		fields = append(fields, "duration", ctx.Duration)
+	}
+	if ctx.RowsAffected > 0 {
+		fields = append(fields, "rows_affected", ctx.RowsAffected)
+	}
+	if ctx.Err != nil {
+		fields = append(fields, "error", ctx.Err)
+	}
+	if ctx.Table != "" {
+		fields = append(fields, "table", ctx.Table)
+	}
+	if ctx.SessionID != 0 {
+		fields = append(fields, "session_id", ctx.SessionID)
+	}
+	return fields
+}
+
+// ContextLogger is a leveled structured logger, set by
+// Engine.SetContextLogger. The statements are logged when ShowSQL is on,
+// before they run unless ShowExecTime is on.
+type ContextLogger interface {
+	// Log logs msg with the alternating keys and values of fields
+	Log(level core.LogLevel, msg string, fields ...interface{})
+	// LogSQL logs a statement before it runs, or once it ran with its
+	// duration, rows affected and error when ShowExecTime is on
+	LogSQL(ctx LogContext)
+}
+
+// LogFunc is a ContextLogger logging to a function taking alternating keys
+// and values, like the sugared loggers of most structured logging packages.
+// The statements are logged at LOG_INFO, or LOG_ERR if they failed.
+type LogFunc func(level core.LogLevel, msg string, fields ...interface{})
+
+var _ ContextLogger = LogFunc(nil)
+
+// Log implement ContextLogger
+func (f LogFunc) Log(level core.LogLevel, msg string, fields ...interface{}) {
+	f(level, msg, fields...)
+}
+
+// LogSQL implement ContextLogger
+func (f LogFunc) LogSQL(ctx LogContext) {
+	level := core.LOG_INFO
+	if ctx.Err != nil {
+		level = core.LOG_ERR
+	}
+	f(level, "sql", ctx.Fields()...)
+}
+
+// iLoggerShim logs the statements to a core.ILogger as text
+type iLoggerShim struct {
+	logger core.ILogger
+	engine *Engine
+}
+
+func (s *iLoggerShim) Log(level core.LogLevel, msg string, fields ...interface{}) {
+	v := append([]interface{}{msg}, fields...)
+	switch level {
+	case core.LOG_DEBUG:
+		s.logger.Debug(v...)
+	case core.LOG_INFO:
+		s.logger.Info(v...)
+	case core.LOG_WARNING:
+		s.logger.Warn(v...)
+	default:
+		s.logger.Error(v...)
+	}
+}
+
+func (s *iLoggerShim) LogSQL(ctx LogContext) {
+	var took string
+	if s.engine.showExecTime && ctx.Duration > 0 {
+		took = fmt.Sprintf(" - took: %v", ctx.Duration)
+	}
+	if len(ctx.Args) > 0 {
+		s.logger.Infof("[sql] %v [args] %v%s", ctx.SQL, ctx.Args, took)
+	} else {
+		s.logger.Infof("[sql] %v%s", ctx.SQL, took)
+	}
+}
+
+// contextLoggerShim lets the engine and the dialects log their messages to
+// a ContextLogger
+type contextLoggerShim struct {
+	logger  ContextLogger
+	level   core.LogLevel
+	showSQL bool
+}
+
+var _ core.ILogger = &contextLoggerShim{}
+
+func (s *contextLoggerShim) log(level core.LogLevel, msg string) {
+	if s.level <= level {
+		s.logger.Log(level, msg)
+	}
+}
+
+func (s *contextLoggerShim) Debug(v ...interface{}) { s.log(core.LOG_DEBUG, fmt.Sprint(v...)) }
+func (s *contextLoggerShim) Debugf(format string, v ...interface{}) {
+	s.log(core.LOG_DEBUG, fmt.Sprintf(format, v...))
+}
+func (s *contextLoggerShim) Error(v ...interface{}) { s.log(core.LOG_ERR, fmt.Sprint(v...)) }
+func (s *contextLoggerShim) Errorf(format string, v ...interface{}) {
+	s.log(core.LOG_ERR, fmt.Sprintf(format, v...))
+}
+func (s *contextLoggerShim) Info(v ...interface{}) { s.log(core.LOG_INFO, fmt.Sprint(v...)) }
+func (s *contextLoggerShim) Infof(format string, v ...interface{}) {
+	s.log(core.LOG_INFO, fmt.Sprintf(format, v...))
+}
+func (s *contextLoggerShim) Warn(v ...interface{}) { s.log(core.LOG_WARNING, fmt.Sprint(v...)) }
+func (s *contextLoggerShim) Warnf(format string, v ...interface{}) {
+	s.log(core.LOG_WARNING, fmt.Sprintf(format, v...))
+}
+func (s *contextLoggerShim) Level() core.LogLevel     { return s.level }
+func (s *contextLoggerShim) SetLevel(l core.LogLevel) { s.level = l }
+func (s *contextLoggerShim) ShowSQL(show ...bool) {
+	s.showSQL = len(show) == 0 || show[0]
+}
+func (s *contextLoggerShim) IsShowSQL() bool { return s.showSQL }
@@ -0,0 +1,131 @@
+package xorm
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-xorm/core"
+)
+
+func TestLogContextFields(t *testing.T) {
+	ctx := LogContext{SQL: "DELETE FROM user", Duration: time.Second, Err: errors.New("locked"), Table: "user", SessionID: 3}
+	expected := []interface{}{"sql", "DELETE FROM user", "duration", time.Second, "error", ctx.Err,
+		"table", "user", "session_id", int64(3)}
+	if fields := ctx.Fields(); !reflect.DeepEqual(fields, expected) {
+		t.Errorf("got %v", fields)
+	}
+}
+
+func TestLoggerShims(t *testing.T) {
+	var buf bytes.Buffer
+	engine := &Engine{showExecTime: true}
+	shim := &iLoggerShim{logger: NewSimpleLogger(&buf), engine: engine}
+	shim.LogSQL(LogContext{SQL: "SELECT 1", Args: []interface{}{2}, Duration: time.Millisecond})
+	if !strings.HasSuffix(buf.String(), "[sql] SELECT 1 [args] [2] - took: 1ms\n") {
+		t.Errorf("got %v", buf.String())
+	}
+
+	var msgs []string
+	logger := &contextLoggerShim{logger: LogFunc(func(level core.LogLevel, msg string, fields ...interface{}) {
+		msgs = append(msgs, msg)
+	}), level: core.LOG_INFO}
+	logger.Debugf("cache %v", 1)
+	logger.Warnf("retry %v", 2)
+	if !reflect.DeepEqual(msgs, []string{"retry 2"}) {
+		t.Errorf("got %v", msgs)
+	}
+}
+
+type LogUser struct {
+	Id   int64
+	Name string
+}
+
+func TestLogSQLTiming(t *testing.T) {
+	engine := newTestEngine(t)
+	if err := engine.Sync2(new(LogUser)); err != nil {
+		t.Fatal(err)
+	}
+
+	var logs []LogContext
+	var countAtLog int64
+	engine.SetContextLogger(&testContextLogger{logSQL: func(ctx LogContext) {
+		logs = append(logs, ctx)
+		if strings.HasPrefix(ctx.SQL, "INSERT") {
+			engine.DB().QueryRow("SELECT count(*) FROM log_user").Scan(&countAtLog)
+		}
+	}})
+	engine.ShowSQL(true)
+
+	// without ShowExecTime, the statements are logged before they run
+	if _, err := engine.Insert(&LogUser{Name: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(logs) != 1 || countAtLog != 0 {
+		t.Errorf("the insert is logged after it ran: %v", logs)
+	}
+	rows, err := engine.Rows(new(LogUser))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(logs) != 2 {
+		t.Errorf("the query of Rows isn't logged before Close: %v", logs)
+	}
+	rows.Close()
+
+	logs = nil
+	engine.ShowExecTime(true)
+	if _, err = engine.Insert(&LogUser{Name: "b"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(logs) != 1 || countAtLog != 2 || logs[0].Duration <= 0 || logs[0].RowsAffected != 1 {
+		t.Errorf("the insert isn't logged once it ran: %+v", logs)
+	}
+	if rows, err = engine.Rows(new(LogUser)); err != nil {
+		t.Fatal(err)
+	}
+	if len(logs) != 2 || logs[1].Duration <= 0 {
+		t.Errorf("the query of Rows isn't logged once it ran: %+v", logs)
+	}
+	rows.Close()
+}
+
+type testContextLogger struct {
+	logSQL func(ctx LogContext)
+}
+
+func (l *testContextLogger) Log(level core.LogLevel, msg string, fields ...interface{}) {}
+
+func (l *testContextLogger) LogSQL(ctx LogContext) {
+	l.logSQL(ctx)
+}
+
+func TestImportLogSQL(t *testing.T) {
+	engine := newTestEngine(t)
+	var logs []LogContext
+	engine.SetContextLogger(&testContextLogger{logSQL: func(ctx LogContext) {
+		logs = append(logs, ctx)
+	}})
+	engine.ShowSQL(true)
+
+	// without ShowExecTime, the statements are logged before they run
+	if _, err := engine.Import(strings.NewReader("CREATE TABLE import_user (id INTEGER); INSERT INTO missing VALUES (1);")); err == nil {
+		t.Fatal("expected an error")
+	}
+	if len(logs) != 2 || logs[1].Err != nil || logs[1].Duration != 0 {
+		t.Errorf("the statements are logged after they ran: %+v", logs)
+	}
+
+	logs = nil
+	engine.ShowExecTime(true)
+	if _, err := engine.Import(strings.NewReader("INSERT INTO missing VALUES (1)")); err == nil {
+		t.Fatal("expected an error")
+	}
+	if len(logs) != 1 || logs[0].Err == nil || logs[0].Duration <= 0 {
+		t.Errorf("the statement isn't logged once it ran: %+v", logs)
+	}
+}
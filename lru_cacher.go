@@ -3,7 +3,9 @@ package xorm
 
 import (
 	"container/list"
+	"context"
 	"fmt"
+	"reflect"
 	"sync"
 	"time"
 
@@ -21,68 +23,194 @@ type LRUCacher struct {
 	Expired    time.Duration
 	maxSize    int
 	GcInterval time.Duration
+	stats      map[string]*CacheTableStats
+	clock      Clock
+	stopGC     context.CancelFunc
+	wake       chan struct{}
+	// size is the approximate number of bytes of the cached entries
+	size int64
 }
 
+// CacheCounters are the counters of the sql or the id list of a LRUCacher
+type CacheCounters struct {
+	Hits   uint64
+	Misses uint64
+	// Evictions are the entries removed to respect Max or the byte budget
+	Evictions uint64
+	// GCRemovals are the expired entries removed by GC
+	GCRemovals uint64
+	// Entries is the current number of entries
+	Entries int
+	// Bytes is the approximate size of the entries
+	Bytes int64
+}
+
+func (c *CacheCounters) add(o CacheCounters) {
+	c.Hits += o.Hits
+	c.Misses += o.Misses
+	c.Evictions += o.Evictions
+	c.GCRemovals += o.GCRemovals
+	c.Entries += o.Entries
+	c.Bytes += o.Bytes
+}
+
+// CacheTableStats are the counters of a table, Sqls for its id lists and
+// Beans for its beans
+type CacheTableStats struct {
+	Sqls  CacheCounters
+	Beans CacheCounters
+}
+
+// CacheStats is a snapshot of the counters of a LRUCacher, it could be
+// published as is with expvar.Func or converted to metrics
+type CacheStats struct {
+	Sqls   CacheCounters
+	Beans  CacheCounters
+	Tables map[string]CacheTableStats
+}
+
+// Clock is the time source of a LRUCacher, tests could replace it to expire
+// the entries without waiting
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// NewLRUCacher returns a LRUCacher keeping at most max sql and max bean
+// entries, and, if maxSize is positive, evicting the least recently used
+// entries to keep their approximate size under maxSize bytes. Its GC runs
+// until Close is called.
 func NewLRUCacher(store core.CacheStore, expired time.Duration, maxSize int, max int) *LRUCacher {
 	cacher := &LRUCacher{store: store, idList: list.New(),
 		sqlList: list.New(), Expired: expired, maxSize: maxSize,
 		GcInterval: core.CacheGcInterval, Max: max,
 		sqlIndex: make(map[string]map[string]*list.Element),
 		idIndex:  make(map[string]map[string]*list.Element),
+		stats:    make(map[string]*CacheTableStats),
+		clock:    systemClock{},
+		wake:     make(chan struct{}, 1),
 	}
 	cacher.RunGC()
 	return cacher
 }
 
-//func NewLRUCacher3(store CacheStore, expired time.Duration, maxSize int) *LRUCacher {
-//    return newLRUCacher(store, expired, maxSize, 0)
-//}
+// NewLRUCacher2 returns a LRUCacher whose size is only bounded by max
+func NewLRUCacher2(store core.CacheStore, expired time.Duration, max int) *LRUCacher {
+	return NewLRUCacher(store, expired, 0, max)
+}
 
-// RunGC run once every m.GcInterval
+// SetClock replaces the time source of the cacher
+func (m *LRUCacher) SetClock(clock Clock) {
+	m.mutex.Lock()
+	m.clock = clock
+	m.mutex.Unlock()
+	m.wakeGC()
+}
+
+// RunGC starts the goroutine removing the entries when they expire, at most
+// once every m.GcInterval, until Close is called
 func (m *LRUCacher) RunGC() {
-	time.AfterFunc(m.GcInterval, func() {
-		m.RunGC()
-		m.GC()
-	})
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.stopGC != nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	m.stopGC = cancel
+	go m.runGC(ctx)
 }
 
-// GC check ids lit and sql list to remove all element expired
-func (m *LRUCacher) GC() {
-	//fmt.Println("begin gc ...")
-	//defer fmt.Println("end gc ...")
+// Close stops the GC, the cached entries are kept
+func (m *LRUCacher) Close() error {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
-	var removedNum int
-	for e := m.idList.Front(); e != nil; {
-		if removedNum <= core.CacheGcMaxRemoved &&
-			time.Now().Sub(e.Value.(*idNode).lastVisit) > m.Expired {
-			removedNum++
-			next := e.Next()
-			//fmt.Println("removing ...", e.Value)
-			node := e.Value.(*idNode)
-			m.delBean(node.tbName, node.id)
-			e = next
-		} else {
-			//fmt.Printf("removing %d cache nodes ..., left %d\n", removedNum, m.idList.Len())
-			break
+	if m.stopGC != nil {
+		m.stopGC()
+		m.stopGC = nil
+	}
+	return nil
+}
+
+func (m *LRUCacher) runGC(ctx context.Context) {
+	for {
+		var timer *time.Timer
+		var fire <-chan time.Time
+		if delay, ok := m.nextGC(); ok {
+			timer = time.NewTimer(delay)
+			fire = timer.C
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-m.wake:
+		case <-fire:
+			m.GC()
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if ctx.Err() != nil {
+			return
 		}
 	}
+}
 
-	removedNum = 0
-	for e := m.sqlList.Front(); e != nil; {
-		if removedNum <= core.CacheGcMaxRemoved &&
-			time.Now().Sub(e.Value.(*sqlNode).lastVisit) > m.Expired {
-			removedNum++
-			next := e.Next()
-			//fmt.Println("removing ...", e.Value)
-			node := e.Value.(*sqlNode)
-			m.delIds(node.tbName, node.sql)
-			e = next
-		} else {
-			//fmt.Printf("removing %d cache nodes ..., left %d\n", removedNum, m.sqlList.Len())
-			break
+// nextGC returns the delay until the first entry expires, ok is false if
+// there is no entry
+func (m *LRUCacher) nextGC() (delay time.Duration, ok bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	var deadline time.Time
+	if e := m.idList.Front(); e != nil {
+		deadline = e.Value.(*idNode).lastVisit.Add(m.Expired)
+	}
+	if e := m.sqlList.Front(); e != nil {
+		if d := e.Value.(*sqlNode).lastVisit.Add(m.Expired); deadline.IsZero() || d.Before(deadline) {
+			deadline = d
 		}
 	}
+	if deadline.IsZero() {
+		return 0, false
+	}
+
+	// removed once they are expired, not when they expire
+	delay = deadline.Sub(m.clock.Now()) + time.Nanosecond
+	if delay < m.GcInterval {
+		delay = m.GcInterval
+	}
+	return delay, true
+}
+
+// wakeGC makes the GC compute its next run again, as when the first entry is
+// added
+func (m *LRUCacher) wakeGC() {
+	select {
+	case m.wake <- struct{}{}:
+	default:
+	}
+}
+
+// GC removes all the expired entries
+func (m *LRUCacher) GC() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	now := m.clock.Now()
+	for e := m.idList.Front(); e != nil && now.Sub(e.Value.(*idNode).lastVisit) > m.Expired; e = m.idList.Front() {
+		node := e.Value.(*idNode)
+		m.delBean(node.tbName, node.id)
+		m.tableStats(node.tbName).Beans.GCRemovals++
+	}
+	for e := m.sqlList.Front(); e != nil && now.Sub(e.Value.(*sqlNode).lastVisit) > m.Expired; e = m.sqlList.Front() {
+		node := e.Value.(*sqlNode)
+		m.delIds(node.tbName, node.sql)
+		m.tableStats(node.tbName).Sqls.GCRemovals++
+	}
 }
 
 // Get all bean's ids according to sql and parameter from cache
@@ -94,23 +222,28 @@ func (m *LRUCacher) GetIds(tableName, sql string) interface{} {
 	}
 	if v, err := m.store.Get(sql); err == nil {
 		if el, ok := m.sqlIndex[tableName][sql]; !ok {
-			el = m.sqlList.PushBack(newSqlNode(tableName, sql))
+			el = m.sqlList.PushBack(m.newSqlNode(tableName, sql))
 			m.sqlIndex[tableName][sql] = el
+			m.resizeIds(el.Value.(*sqlNode), entrySize(sql, v))
+			m.evictToMaxSize()
 		} else {
 			lastTime := el.Value.(*sqlNode).lastVisit
 			// if expired, remove the node and return nil
-			if time.Now().Sub(lastTime) > m.Expired {
+			if m.clock.Now().Sub(lastTime) > m.Expired {
 				m.delIds(tableName, sql)
+				m.tableStats(tableName).Sqls.Misses++
 				return nil
 			}
 			m.sqlList.MoveToBack(el)
-			el.Value.(*sqlNode).lastVisit = time.Now()
+			el.Value.(*sqlNode).lastVisit = m.clock.Now()
 		}
+		m.tableStats(tableName).Sqls.Hits++
 		return v
 	} else {
 		m.delIds(tableName, sql)
 	}
 
+	m.tableStats(tableName).Sqls.Misses++
 	return nil
 }
 
@@ -126,22 +259,27 @@ func (m *LRUCacher) GetBean(tableName string, id string) interface{} {
 		if el, ok := m.idIndex[tableName][id]; ok {
 			lastTime := el.Value.(*idNode).lastVisit
 			// if expired, remove the node and return nil
-			if time.Now().Sub(lastTime) > m.Expired {
+			if m.clock.Now().Sub(lastTime) > m.Expired {
 				m.delBean(tableName, id)
 				//m.clearIds(tableName)
+				m.tableStats(tableName).Beans.Misses++
 				return nil
 			}
 			m.idList.MoveToBack(el)
-			el.Value.(*idNode).lastVisit = time.Now()
+			el.Value.(*idNode).lastVisit = m.clock.Now()
 		} else {
-			el = m.idList.PushBack(newIdNode(tableName, id))
+			el = m.idList.PushBack(m.newIdNode(tableName, id))
 			m.idIndex[tableName][id] = el
+			m.resizeBean(el.Value.(*idNode), entrySize(tid, v))
+			m.evictToMaxSize()
 		}
+		m.tableStats(tableName).Beans.Hits++
 		return v
 	} else {
 		// store bean is not exist, then remove memory's index
 		m.delBean(tableName, id)
 		//m.clearIds(tableName)
+		m.tableStats(tableName).Beans.Misses++
 		return nil
 	}
 }
@@ -150,6 +288,7 @@ func (m *LRUCacher) GetBean(tableName string, id string) interface{} {
 func (m *LRUCacher) clearIds(tableName string) {
 	if tis, ok := m.sqlIndex[tableName]; ok {
 		for sql, v := range tis {
+			m.resizeIds(v.Value.(*sqlNode), 0)
 			m.sqlList.Remove(v)
 			m.store.Del(sql)
 		}
@@ -166,6 +305,7 @@ func (m *LRUCacher) ClearIds(tableName string) {
 func (m *LRUCacher) clearBeans(tableName string) {
 	if tis, ok := m.idIndex[tableName]; ok {
 		for id, v := range tis {
+			m.resizeBean(v.Value.(*idNode), 0)
 			m.idList.Remove(v)
 			tid := genId(tableName, id)
 			m.store.Del(tid)
@@ -183,21 +323,67 @@ func (m *LRUCacher) ClearBeans(tableName string) {
 func (m *LRUCacher) PutIds(tableName, sql string, ids interface{}) {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
+	m.putIds(tableName, sql, ids, nil)
+}
+
+// PutIdsDeps puts the id list with what it depends on, so that it's kept
+// by the writes which don't change it
+func (m *LRUCacher) PutIdsDeps(tableName, sql string, ids interface{}, deps CacheIdsDeps) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.putIds(tableName, sql, ids, &deps)
+}
+
+// ClearIdsOfColumns removes the id lists of tableName depending on one of
+// cols, or whose dependencies are unknown
+func (m *LRUCacher) ClearIdsOfColumns(tableName string, cols []string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for sql, el := range m.sqlIndex[tableName] {
+		if deps := el.Value.(*sqlNode).deps; deps == nil || deps.hasColumn(cols) {
+			m.delIds(tableName, sql)
+		}
+	}
+}
+
+// ClearIdsOfBeans removes the id lists of tableName which may list one of
+// ids, or whose dependencies are unknown
+func (m *LRUCacher) ClearIdsOfBeans(tableName string, ids []string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for sql, el := range m.sqlIndex[tableName] {
+		if deps := el.Value.(*sqlNode).deps; deps == nil || deps.hasId(ids) {
+			m.delIds(tableName, sql)
+		}
+	}
+}
+
+func (m *LRUCacher) putIds(tableName, sql string, ids interface{}, deps *CacheIdsDeps) {
 	if _, ok := m.sqlIndex[tableName]; !ok {
 		m.sqlIndex[tableName] = make(map[string]*list.Element)
 	}
-	if el, ok := m.sqlIndex[tableName][sql]; !ok {
-		el = m.sqlList.PushBack(newSqlNode(tableName, sql))
+	el, ok := m.sqlIndex[tableName][sql]
+	if !ok {
+		el = m.sqlList.PushBack(m.newSqlNode(tableName, sql))
 		m.sqlIndex[tableName][sql] = el
 	} else {
-		el.Value.(*sqlNode).lastVisit = time.Now()
+		el.Value.(*sqlNode).lastVisit = m.clock.Now()
+		m.sqlList.MoveToBack(el)
+	}
+	el.Value.(*sqlNode).deps = deps
+	size := entrySize(sql, ids)
+	if deps != nil {
+		size += heapSize(reflect.ValueOf(deps), make(map[uintptr]bool))
 	}
+	m.resizeIds(el.Value.(*sqlNode), size)
 	m.store.Put(sql, ids)
 	if m.sqlList.Len() > m.Max {
 		e := m.sqlList.Front()
 		node := e.Value.(*sqlNode)
 		m.delIds(node.tbName, node.sql)
+		m.tableStats(node.tbName).Sqls.Evictions++
 	}
+	m.evictToMaxSize()
 }
 
 func (m *LRUCacher) PutBean(tableName string, id string, obj interface{}) {
@@ -206,25 +392,34 @@ func (m *LRUCacher) PutBean(tableName string, id string, obj interface{}) {
 	var el *list.Element
 	var ok bool
 
+	if _, ok = m.idIndex[tableName]; !ok {
+		m.idIndex[tableName] = make(map[string]*list.Element)
+	}
 	if el, ok = m.idIndex[tableName][id]; !ok {
-		el = m.idList.PushBack(newIdNode(tableName, id))
+		el = m.idList.PushBack(m.newIdNode(tableName, id))
 		m.idIndex[tableName][id] = el
 	} else {
-		el.Value.(*idNode).lastVisit = time.Now()
+		el.Value.(*idNode).lastVisit = m.clock.Now()
+		m.idList.MoveToBack(el)
 	}
 
-	m.store.Put(genId(tableName, id), obj)
+	tid := genId(tableName, id)
+	m.resizeBean(el.Value.(*idNode), entrySize(tid, obj))
+	m.store.Put(tid, obj)
 	if m.idList.Len() > m.Max {
 		e := m.idList.Front()
 		node := e.Value.(*idNode)
 		m.delBean(node.tbName, node.id)
+		m.tableStats(node.tbName).Beans.Evictions++
 	}
+	m.evictToMaxSize()
 }
 
 func (m *LRUCacher) delIds(tableName, sql string) {
 	if _, ok := m.sqlIndex[tableName]; ok {
 		if el, ok := m.sqlIndex[tableName][sql]; ok {
 			delete(m.sqlIndex[tableName], sql)
+			m.resizeIds(el.Value.(*sqlNode), 0)
 			m.sqlList.Remove(el)
 		}
 	}
@@ -241,8 +436,8 @@ func (m *LRUCacher) delBean(tableName string, id string) {
 	tid := genId(tableName, id)
 	if el, ok := m.idIndex[tableName][id]; ok {
 		delete(m.idIndex[tableName], id)
+		m.resizeBean(el.Value.(*idNode), 0)
 		m.idList.Remove(el)
-		m.clearIds(tableName)
 	}
 	m.store.Del(tid)
 }
@@ -253,16 +448,167 @@ func (m *LRUCacher) DelBean(tableName string, id string) {
 	m.delBean(tableName, id)
 }
 
+// resizeIds records that the entry of node uses size bytes
+func (m *LRUCacher) resizeIds(node *sqlNode, size int64) {
+	m.size += size - node.size
+	m.tableStats(node.tbName).Sqls.Bytes += size - node.size
+	node.size = size
+}
+
+// resizeBean records that the entry of node uses size bytes
+func (m *LRUCacher) resizeBean(node *idNode, size int64) {
+	m.size += size - node.size
+	m.tableStats(node.tbName).Beans.Bytes += size - node.size
+	node.size = size
+}
+
+// evictToMaxSize removes the least recently used entries, beans or id lists,
+// until the cached entries fit in maxSize bytes
+func (m *LRUCacher) evictToMaxSize() {
+	for m.maxSize > 0 && m.size > int64(m.maxSize) {
+		idFront, sqlFront := m.idList.Front(), m.sqlList.Front()
+		if idFront == nil && sqlFront == nil {
+			return
+		}
+		if sqlFront == nil || (idFront != nil &&
+			idFront.Value.(*idNode).lastVisit.Before(sqlFront.Value.(*sqlNode).lastVisit)) {
+			node := idFront.Value.(*idNode)
+			m.delBean(node.tbName, node.id)
+			m.tableStats(node.tbName).Beans.Evictions++
+		} else {
+			node := sqlFront.Value.(*sqlNode)
+			m.delIds(node.tbName, node.sql)
+			m.tableStats(node.tbName).Sqls.Evictions++
+		}
+	}
+}
+
+// Size returns the approximate number of bytes of the cached entries
+func (m *LRUCacher) Size() int64 {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.size
+}
+
+func (m *LRUCacher) tableStats(tableName string) *CacheTableStats {
+	stats, ok := m.stats[tableName]
+	if !ok {
+		stats = &CacheTableStats{}
+		m.stats[tableName] = stats
+	}
+	return stats
+}
+
+// Stats returns a snapshot of the cacher's counters, in total and by table
+func (m *LRUCacher) Stats() CacheStats {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for tableName := range m.sqlIndex {
+		m.tableStats(tableName)
+	}
+	for tableName := range m.idIndex {
+		m.tableStats(tableName)
+	}
+
+	snapshot := CacheStats{Tables: make(map[string]CacheTableStats, len(m.stats))}
+	for tableName, stats := range m.stats {
+		table := *stats
+		table.Sqls.Entries = len(m.sqlIndex[tableName])
+		table.Beans.Entries = len(m.idIndex[tableName])
+		snapshot.Sqls.add(table.Sqls)
+		snapshot.Beans.add(table.Beans)
+		snapshot.Tables[tableName] = table
+	}
+	return snapshot
+}
+
 type idNode struct {
 	tbName    string
 	id        string
 	lastVisit time.Time
+	size      int64
 }
 
 type sqlNode struct {
 	tbName    string
 	sql       string
 	lastVisit time.Time
+	size      int64
+	deps      *CacheIdsDeps
+}
+
+// lruEntryOverhead approximates the memory used by the list element, the
+// node and the index entry of a cached entry
+const lruEntryOverhead = 128
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// entrySize returns the approximate number of bytes used to cache value
+// under key
+func entrySize(key string, value interface{}) int64 {
+	size := int64(lruEntryOverhead + len(key))
+	if value != nil {
+		v := reflect.ValueOf(value)
+		size += int64(v.Type().Size()) + heapSize(v, make(map[uintptr]bool))
+	}
+	return size
+}
+
+// heapSize returns the approximate number of bytes referenced by v, the
+// pointers already seen are not counted again
+func heapSize(v reflect.Value, seen map[uintptr]bool) int64 {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() || seen[v.Pointer()] {
+			return 0
+		}
+		seen[v.Pointer()] = true
+		return int64(v.Type().Elem().Size()) + heapSize(v.Elem(), seen)
+	case reflect.Interface:
+		if v.IsNil() {
+			return 0
+		}
+		return int64(v.Elem().Type().Size()) + heapSize(v.Elem(), seen)
+	case reflect.String:
+		return int64(v.Len())
+	case reflect.Slice:
+		if v.IsNil() || seen[v.Pointer()] {
+			return 0
+		}
+		seen[v.Pointer()] = true
+		size := int64(v.Cap()) * int64(v.Type().Elem().Size())
+		for i := 0; i < v.Len(); i++ {
+			size += heapSize(v.Index(i), seen)
+		}
+		return size
+	case reflect.Array:
+		var size int64
+		for i := 0; i < v.Len(); i++ {
+			size += heapSize(v.Index(i), seen)
+		}
+		return size
+	case reflect.Map:
+		if v.IsNil() {
+			return 0
+		}
+		size := int64(v.Len()) * int64(v.Type().Key().Size()+v.Type().Elem().Size())
+		for _, key := range v.MapKeys() {
+			size += heapSize(key, seen) + heapSize(v.MapIndex(key), seen)
+		}
+		return size
+	case reflect.Struct:
+		// the location of a time is shared
+		if v.Type() == timeType {
+			return 0
+		}
+		var size int64
+		for i := 0; i < v.NumField(); i++ {
+			size += heapSize(v.Field(i), seen)
+		}
+		return size
+	}
+	return 0
 }
 
 func genSqlKey(sql string, args interface{}) string {
@@ -273,10 +619,16 @@ func genId(prefix string, id string) string {
 	return fmt.Sprintf("%v-%v", prefix, id)
 }
 
-func newIdNode(tbName string, id string) *idNode {
-	return &idNode{tbName, id, time.Now()}
+func (m *LRUCacher) newIdNode(tbName string, id string) *idNode {
+	if m.idList.Len() == 0 {
+		m.wakeGC()
+	}
+	return &idNode{tbName, id, m.clock.Now(), 0}
 }
 
-func newSqlNode(tbName, sql string) *sqlNode {
-	return &sqlNode{tbName, sql, time.Now()}
+func (m *LRUCacher) newSqlNode(tbName, sql string) *sqlNode {
+	if m.sqlList.Len() == 0 {
+		m.wakeGC()
+	}
+	return &sqlNode{tbName, sql, m.clock.Now(), 0, nil}
 }
@@ -0,0 +1,163 @@
+package xorm
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLRUCacherStats(t *testing.T) {
+	cacher := NewLRUCacher(NewMemoryStore(), time.Hour, 0, 2)
+	defer cacher.Close()
+
+	cacher.PutBean("user", "1", &cachedUser{1, "lunny"})
+	cacher.GetBean("user", "1")
+	cacher.GetBean("user", "2")
+	cacher.PutBean("user", "2", &cachedUser{2, "xiaolunwen"})
+	cacher.PutBean("user", "3", &cachedUser{3, "xorm"})
+
+	cacher.PutIds("user", "select id from user", "[[1]]")
+	cacher.GetIds("user", "select id from user")
+	cacher.GetIds("group", "select id from group")
+
+	stats := cacher.Stats()
+	user := stats.Tables["user"]
+	if user.Beans.Hits != 1 || user.Beans.Misses != 1 || user.Beans.Evictions != 1 || user.Beans.Entries != 2 {
+		t.Errorf("unexpected user beans stats %+v", user.Beans)
+	}
+	if user.Sqls.Hits != 1 || user.Sqls.Entries != 1 {
+		t.Errorf("unexpected user sqls stats %+v", user.Sqls)
+	}
+	if stats.Sqls.Misses != 1 || stats.Tables["group"].Sqls.Misses != 1 {
+		t.Errorf("unexpected sqls stats %+v", stats.Sqls)
+	}
+}
+
+func TestLRUCacherMaxSize(t *testing.T) {
+	one := entrySize(genId("user", "1"), &cachedUser{1, "lunny"})
+	cacher := NewLRUCacher(NewMemoryStore(), time.Hour, int(2*one+one/2), 100)
+	defer cacher.Close()
+
+	cacher.PutBean("user", "1", &cachedUser{1, "lunny"})
+	cacher.PutBean("user", "2", &cachedUser{2, "lunny"})
+	if cacher.Size() != 2*one {
+		t.Fatalf("expected size %d, got %d", 2*one, cacher.Size())
+	}
+	cacher.GetBean("user", "1")
+	cacher.PutBean("user", "3", &cachedUser{3, "lunny"})
+
+	if cacher.GetBean("user", "2") != nil {
+		t.Error("the least recently used bean should be evicted")
+	}
+	if cacher.GetBean("user", "1") == nil || cacher.GetBean("user", "3") == nil {
+		t.Error("the recently used beans should be kept")
+	}
+
+	stats := cacher.Stats()
+	if stats.Beans.Evictions != 1 || stats.Beans.Bytes != 2*one || cacher.Size() != 2*one {
+		t.Errorf("unexpected beans stats %+v", stats.Beans)
+	}
+
+	cacher.ClearBeans("user")
+	if cacher.Size() != 0 {
+		t.Errorf("expected size 0, got %d", cacher.Size())
+	}
+}
+
+func TestLRUCacherIdsDeps(t *testing.T) {
+	cacher := NewLRUCacher(NewMemoryStore(), time.Hour, 0, 100)
+	defer cacher.Close()
+
+	cacher.PutIdsDeps("user", "by name", "[[1]]", CacheIdsDeps{Columns: []string{"id", "name"}, Ids: []string{"[1]"}})
+	cacher.PutIdsDeps("user", "by age", "[[2]]", CacheIdsDeps{Columns: []string{"id", "age"}, Ids: []string{"[2]"}})
+	cacher.PutIdsDeps("user", "paged", "[[3]]", CacheIdsDeps{Columns: []string{"id"}})
+	cacher.PutIds("user", "unknown", "[[1]]")
+	cacher.PutBean("user", "[2]", &cachedUser{2, "lunny"})
+
+	cacher.ClearIdsOfColumns("user", []string{"Name"})
+	if cacher.GetIds("user", "by name") != nil || cacher.GetIds("user", "unknown") != nil {
+		t.Error("the lists depending on name should be removed")
+	}
+	if cacher.GetIds("user", "by age") == nil || cacher.GetIds("user", "paged") == nil {
+		t.Error("the lists not depending on name should be kept")
+	}
+
+	cacher.DelBean("user", "[2]")
+	if cacher.GetIds("user", "by age") == nil {
+		t.Error("deleting a bean should keep the lists")
+	}
+
+	cacher.ClearIdsOfBeans("user", []string{"[4]"})
+	if cacher.GetIds("user", "by age") == nil {
+		t.Error("the lists not listing the deleted ids should be kept")
+	}
+	if cacher.GetIds("user", "paged") != nil {
+		t.Error("the lists whose ids are unknown should be removed")
+	}
+	cacher.ClearIdsOfBeans("user", []string{"[2]"})
+	if cacher.GetIds("user", "by age") != nil {
+		t.Error("the lists listing the deleted ids should be removed")
+	}
+}
+
+type fakeClock struct {
+	mutex sync.Mutex
+	now   time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Add(d time.Duration) {
+	c.mutex.Lock()
+	c.now = c.now.Add(d)
+	c.mutex.Unlock()
+}
+
+func TestLRUCacherGC(t *testing.T) {
+	clock := &fakeClock{now: time.Now()}
+	cacher := NewLRUCacher(NewMemoryStore(), time.Minute, 0, 100)
+	defer cacher.Close()
+	cacher.SetClock(clock)
+	cacher.GcInterval = 0
+
+	for i := 0; i < 50; i++ {
+		cacher.PutBean("user", strconv.Itoa(i), &cachedUser{int64(i), "lunny"})
+	}
+	cacher.PutIds("user", "select id from user", "[[1]]")
+	if delay, ok := cacher.nextGC(); !ok || delay != time.Minute+time.Nanosecond {
+		t.Errorf("the next GC should be when the first entry expires, got %v", delay)
+	}
+
+	clock.Add(30 * time.Second)
+	cacher.PutBean("user", "last", &cachedUser{50, "lunny"})
+	clock.Add(31 * time.Second)
+	cacher.GC()
+
+	stats := cacher.Stats()
+	if stats.Beans.GCRemovals != 50 || stats.Beans.Entries != 1 || stats.Sqls.GCRemovals != 1 {
+		t.Errorf("all the expired entries should be removed, got %+v %+v", stats.Beans, stats.Sqls)
+	}
+	if delay, ok := cacher.nextGC(); !ok || delay != 29*time.Second+time.Nanosecond {
+		t.Errorf("the next GC should be when the last entry expires, got %v", delay)
+	}
+}
+
+func TestLRUCacherRunGC(t *testing.T) {
+	cacher := NewLRUCacher(NewMemoryStore(), 10*time.Millisecond, 0, 100)
+	defer cacher.Close()
+	cacher.GcInterval = 0
+
+	cacher.PutBean("user", "1", &cachedUser{1, "lunny"})
+	for i := 0; i < 100; i++ {
+		if cacher.Stats().Beans.GCRemovals == 1 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("the expired bean should be removed by the GC")
+}
@@ -0,0 +1,362 @@
+// Copyright 2017 The Xorm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package migrate provides versioned schema migrations on top of xorm.
+//
+// Each migration has an unique ID and an Up/Down pair of steps which are
+// either Go functions or raw SQL statements. The IDs of the applied
+// migrations are recorded in a bookkeeping table, and every step runs in
+// its own transaction together with the bookkeeping change.
+//
+//	m := migrate.New(engine, migrate.DefaultOptions, []*migrate.Migration{
+//		{
+//			ID: "201701221517",
+//			Migrate: func(sess *xorm.Session) error {
+//				return sess.Sync2(new(User))
+//			},
+//			Rollback: func(sess *xorm.Session) error {
+//				return sess.DropTable(new(User))
+//			},
+//		},
+//		{
+//			ID:      "201701231010",
+//			UpSQL:   []string{"CREATE INDEX idx_user_name ON user (name)"},
+//			DownSQL: []string{"DROP INDEX idx_user_name"},
+//		},
+//	})
+//	err := m.Migrate()
+//
+// Note that some databases, such as MySQL, implicitly commit DDL statements,
+// so a failed step may leave a partially applied schema behind.
+package migrate
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/caser789/go-xorm"
+	"github.com/go-xorm/core"
+)
+
+// MigrateFunc is the function executed when running or rolling back a
+// migration. The session is inside a transaction.
+type MigrateFunc func(*xorm.Session) error
+
+// Migration represents a database migration (a modification to be made on
+// the database).
+type Migration struct {
+	// ID is the migration identifier. Usually a timestamp like "201701221517".
+	ID string
+	// Migrate is the function executed when running this migration. When it
+	// is nil, UpSQL is executed instead.
+	Migrate MigrateFunc
+	// Rollback is the function executed when rolling back this migration.
+	// When it is nil, DownSQL is executed instead.
+	Rollback MigrateFunc
+	// UpSQL are the raw SQL statements of this migration.
+	UpSQL []string
+	// DownSQL are the raw SQL statements to roll back this migration.
+	DownSQL []string
+}
+
+// Options define options for all migrations.
+type Options struct {
+	// TableName is the migration bookkeeping table name.
+	TableName string
+	// IDColumnName is the name of column where the migration id will be stored.
+	IDColumnName string
+}
+
+// Status describes if a migration has been applied.
+type Status struct {
+	ID      string
+	Applied bool
+}
+
+var (
+	// DefaultOptions can be used if you don't want to think about options.
+	DefaultOptions = &Options{
+		TableName:    "migrations",
+		IDColumnName: "id",
+	}
+
+	// ErrRollbackImpossible is returned when trying to rollback a migration
+	// that has neither a Rollback function nor DownSQL.
+	ErrRollbackImpossible = errors.New("It's impossible to rollback this migration")
+
+	// ErrNoMigrationDefined is returned when no migration is defined.
+	ErrNoMigrationDefined = errors.New("No migration defined")
+
+	// ErrMissingID is returned when the ID of a migration is equal to "".
+	ErrMissingID = errors.New("Missing ID in migration")
+
+	// ErrNoRunnedMigration is returned when no runned migration was found.
+	ErrNoRunnedMigration = errors.New("Could not find last runned migration")
+
+	// ErrMigrationIDDoesNotExist is returned when the migration id given to
+	// RollbackTo is not one of the defined migrations.
+	ErrMigrationIDDoesNotExist = errors.New("Tried to rollback to an ID that doesn't exist")
+)
+
+// DuplicatedIDError is returned when more than one migration have the same ID.
+type DuplicatedIDError struct {
+	ID string
+}
+
+func (e *DuplicatedIDError) Error() string {
+	return fmt.Sprintf("Duplicated migration ID: %s", e.ID)
+}
+
+// Migrate represents a collection of all migrations of a database schema.
+type Migrate struct {
+	engine     *xorm.Engine
+	options    *Options
+	migrations []*Migration
+}
+
+// New returns a new Migrate.
+func New(engine *xorm.Engine, options *Options, migrations []*Migration) *Migrate {
+	if options == nil {
+		options = DefaultOptions
+	}
+	return &Migrate{
+		engine:     engine,
+		options:    options,
+		migrations: migrations,
+	}
+}
+
+// Migrate executes all migrations that did not run yet, in the order they
+// were defined.
+func (m *Migrate) Migrate() error {
+	if err := m.validate(); err != nil {
+		return err
+	}
+
+	if err := m.createMigrationTableIfNotExists(); err != nil {
+		return err
+	}
+
+	applied, err := m.appliedIDs()
+	if err != nil {
+		return err
+	}
+
+	for _, migration := range m.migrations {
+		if applied[migration.ID] {
+			continue
+		}
+		if err := m.runMigration(migration); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RollbackLast undo the last migration
+func (m *Migrate) RollbackLast() error {
+	if err := m.validate(); err != nil {
+		return err
+	}
+
+	if err := m.createMigrationTableIfNotExists(); err != nil {
+		return err
+	}
+
+	applied, err := m.appliedIDs()
+	if err != nil {
+		return err
+	}
+
+	for i := len(m.migrations) - 1; i >= 0; i-- {
+		if applied[m.migrations[i].ID] {
+			return m.rollbackMigration(m.migrations[i])
+		}
+	}
+	return ErrNoRunnedMigration
+}
+
+// RollbackTo undo, from the last one backwards, all the applied migrations
+// defined after the migration id. The migration id itself stays applied.
+func (m *Migrate) RollbackTo(id string) error {
+	if err := m.validate(); err != nil {
+		return err
+	}
+
+	var idx = -1
+	for i, migration := range m.migrations {
+		if migration.ID == id {
+			idx = i
+			break
+		}
+	}
+	if idx < 0 {
+		return ErrMigrationIDDoesNotExist
+	}
+
+	if err := m.createMigrationTableIfNotExists(); err != nil {
+		return err
+	}
+
+	applied, err := m.appliedIDs()
+	if err != nil {
+		return err
+	}
+
+	for i := len(m.migrations) - 1; i > idx; i-- {
+		if !applied[m.migrations[i].ID] {
+			continue
+		}
+		if err := m.rollbackMigration(m.migrations[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Status returns, in definition order, whether each migration was applied.
+func (m *Migrate) Status() ([]*Status, error) {
+	if err := m.validate(); err != nil {
+		return nil, err
+	}
+
+	if err := m.createMigrationTableIfNotExists(); err != nil {
+		return nil, err
+	}
+
+	applied, err := m.appliedIDs()
+	if err != nil {
+		return nil, err
+	}
+
+	var status = make([]*Status, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		status = append(status, &Status{
+			ID:      migration.ID,
+			Applied: applied[migration.ID],
+		})
+	}
+	return status, nil
+}
+
+func (m *Migrate) validate() error {
+	if len(m.migrations) == 0 {
+		return ErrNoMigrationDefined
+	}
+
+	var ids = make(map[string]bool, len(m.migrations))
+	for _, migration := range m.migrations {
+		if migration.ID == "" {
+			return ErrMissingID
+		}
+		if ids[migration.ID] {
+			return &DuplicatedIDError{migration.ID}
+		}
+		ids[migration.ID] = true
+	}
+	return nil
+}
+
+func (m *Migrate) runMigration(migration *Migration) error {
+	return m.inTransaction(func(sess *xorm.Session) error {
+		if migration.Migrate != nil {
+			if err := migration.Migrate(sess); err != nil {
+				return err
+			}
+		} else if err := execAll(sess, migration.UpSQL); err != nil {
+			return err
+		}
+
+		sqlStr := fmt.Sprintf("INSERT INTO %s (%s) VALUES (?)",
+			m.engine.Quote(m.options.TableName), m.engine.Quote(m.options.IDColumnName))
+		_, err := sess.Exec(sqlStr, migration.ID)
+		return err
+	})
+}
+
+func (m *Migrate) rollbackMigration(migration *Migration) error {
+	if migration.Rollback == nil && len(migration.DownSQL) == 0 {
+		return ErrRollbackImpossible
+	}
+
+	return m.inTransaction(func(sess *xorm.Session) error {
+		if migration.Rollback != nil {
+			if err := migration.Rollback(sess); err != nil {
+				return err
+			}
+		} else if err := execAll(sess, migration.DownSQL); err != nil {
+			return err
+		}
+
+		sqlStr := fmt.Sprintf("DELETE FROM %s WHERE %s = ?",
+			m.engine.Quote(m.options.TableName), m.engine.Quote(m.options.IDColumnName))
+		_, err := sess.Exec(sqlStr, migration.ID)
+		return err
+	})
+}
+
+func (m *Migrate) inTransaction(fn func(*xorm.Session) error) error {
+	sess := m.engine.NewSession()
+	defer sess.Close()
+
+	if err := sess.Begin(); err != nil {
+		return err
+	}
+
+	if err := fn(sess); err != nil {
+		sess.Rollback()
+		return err
+	}
+	return sess.Commit()
+}
+
+func execAll(sess *xorm.Session, sqls []string) error {
+	for _, sqlStr := range sqls {
+		if _, err := sess.Exec(sqlStr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrationTable returns the bookkeeping table, described in a way the
+// current dialect can generate its DDL.
+func (m *Migrate) migrationTable() *core.Table {
+	table := core.NewEmptyTable()
+	table.Name = m.options.TableName
+
+	col := core.NewColumn(m.options.IDColumnName, "", core.SQLType{Name: core.Varchar}, 255, 0, false)
+	col.IsPrimaryKey = true
+	table.AddColumn(col)
+	return table
+}
+
+func (m *Migrate) createMigrationTableIfNotExists() error {
+	exists, err := m.engine.IsTableExist(m.options.TableName)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+
+	sqlStr := m.engine.Dialect().CreateTableSql(m.migrationTable(), m.options.TableName, "", "")
+	_, err = m.engine.Exec(sqlStr)
+	return err
+}
+
+func (m *Migrate) appliedIDs() (map[string]bool, error) {
+	sqlStr := fmt.Sprintf("SELECT %s FROM %s",
+		m.engine.Quote(m.options.IDColumnName), m.engine.Quote(m.options.TableName))
+	results, err := m.engine.Query(sqlStr)
+	if err != nil {
+		return nil, err
+	}
+
+	var applied = make(map[string]bool, len(results))
+	for _, result := range results {
+		applied[string(result[m.options.IDColumnName])] = true
+	}
+	return applied, nil
+}
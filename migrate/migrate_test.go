@@ -0,0 +1,187 @@
+package migrate
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/caser789/go-xorm"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+type Person struct {
+	Id   int64
+	Name string
+}
+
+type Pet struct {
+	Id       int64
+	Name     string
+	PersonId int64
+}
+
+var migrations = []*Migration{
+	{
+		ID: "201608301400",
+		Migrate: func(sess *xorm.Session) error {
+			return sess.Sync2(new(Person))
+		},
+		Rollback: func(sess *xorm.Session) error {
+			return sess.DropTable(new(Person))
+		},
+	},
+	{
+		ID: "201608301430",
+		Migrate: func(sess *xorm.Session) error {
+			return sess.Sync2(new(Pet))
+		},
+		Rollback: func(sess *xorm.Session) error {
+			return sess.DropTable(new(Pet))
+		},
+	},
+	{
+		ID:      "201608301500",
+		UpSQL:   []string{"CREATE INDEX idx_pet_name ON pet (name)"},
+		DownSQL: []string{"DROP INDEX idx_pet_name"},
+	},
+}
+
+func newEngine(t *testing.T) *xorm.Engine {
+	engine, err := xorm.NewEngine("sqlite3", filepath.Join(t.TempDir(), "migrate.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { engine.Close() })
+	return engine
+}
+
+func assertApplied(t *testing.T, m *Migrate, expected ...bool) {
+	status, err := m.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, s := range status {
+		if s.Applied != expected[i] {
+			t.Errorf("migration %v applied is %v, expected %v", s.ID, s.Applied, expected[i])
+		}
+	}
+}
+
+func assertTableExist(t *testing.T, engine *xorm.Engine, table interface{}, expected bool) {
+	exist, err := engine.IsTableExist(table)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exist != expected {
+		t.Errorf("table %T exists is %v, expected %v", table, exist, expected)
+	}
+}
+
+func TestMigration(t *testing.T) {
+	engine := newEngine(t)
+	m := New(engine, DefaultOptions, migrations)
+
+	if err := m.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	assertTableExist(t, engine, new(Person), true)
+	assertTableExist(t, engine, new(Pet), true)
+	assertApplied(t, m, true, true, true)
+
+	// running again applies nothing
+	if err := m.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.RollbackLast(); err != nil {
+		t.Fatal(err)
+	}
+	assertApplied(t, m, true, true, false)
+	assertTableExist(t, engine, new(Pet), true)
+
+	if err := m.RollbackLast(); err != nil {
+		t.Fatal(err)
+	}
+	assertApplied(t, m, true, false, false)
+	assertTableExist(t, engine, new(Pet), false)
+	assertTableExist(t, engine, new(Person), true)
+
+	if err := m.RollbackLast(); err != nil {
+		t.Fatal(err)
+	}
+	assertTableExist(t, engine, new(Person), false)
+
+	if err := m.RollbackLast(); err != ErrNoRunnedMigration {
+		t.Errorf("got %v, expected ErrNoRunnedMigration", err)
+	}
+}
+
+func TestRollbackTo(t *testing.T) {
+	engine := newEngine(t)
+	m := New(engine, DefaultOptions, migrations)
+
+	if err := m.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.RollbackTo("201608301400"); err != nil {
+		t.Fatal(err)
+	}
+	assertApplied(t, m, true, false, false)
+	assertTableExist(t, engine, new(Person), true)
+	assertTableExist(t, engine, new(Pet), false)
+
+	if err := m.RollbackTo("201608301600"); err != ErrMigrationIDDoesNotExist {
+		t.Errorf("got %v, expected ErrMigrationIDDoesNotExist", err)
+	}
+}
+
+func TestMigrationErrors(t *testing.T) {
+	engine := newEngine(t)
+
+	m := New(engine, DefaultOptions, []*Migration{{ID: ""}})
+	if err := m.Migrate(); err != ErrMissingID {
+		t.Errorf("got %v, expected ErrMissingID", err)
+	}
+
+	m = New(engine, DefaultOptions, nil)
+	if err := m.Migrate(); err != ErrNoMigrationDefined {
+		t.Errorf("got %v, expected ErrNoMigrationDefined", err)
+	}
+
+	m = New(engine, DefaultOptions, []*Migration{migrations[0], migrations[0]})
+	if _, ok := m.Migrate().(*DuplicatedIDError); !ok {
+		t.Error("expected a DuplicatedIDError")
+	}
+
+	m = New(engine, DefaultOptions, []*Migration{{ID: "201608301400", UpSQL: []string{"SELECT 1"}}})
+	if err := m.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.RollbackLast(); err != ErrRollbackImpossible {
+		t.Errorf("got %v, expected ErrRollbackImpossible", err)
+	}
+}
+
+func TestMigrationFailureRollsBack(t *testing.T) {
+	engine := newEngine(t)
+	m := New(engine, DefaultOptions, []*Migration{
+		migrations[0],
+		{
+			ID:    "201608301430",
+			UpSQL: []string{"INSERT INTO person (name) VALUES ('x')", "INSERT INTO missing (name) VALUES ('x')"},
+		},
+	})
+
+	if err := m.Migrate(); err == nil {
+		t.Fatal("expected an error")
+	}
+	assertApplied(t, m, true, false)
+
+	count, err := engine.Count(new(Person))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 0 {
+		t.Errorf("the failed migration inserted %v rows", count)
+	}
+}
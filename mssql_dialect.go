@@ -5,6 +5,7 @@
 package xorm
 
 import (
+	"database/sql"
 	"errors"
 	"fmt"
 	"strconv"
@@ -269,6 +270,36 @@ func (db *mssql) SupportInsertMany() bool {
 	return true
 }
 
+// UpsertSql returns a MERGE statement whose source is a VALUES table
+func (db *mssql) UpsertSql(tableName string, colNames []string, rows [][]string, conflictCols, updateCols []string) string {
+	values := make([]string, 0, len(rows))
+	for _, places := range rows {
+		values = append(values, "("+strings.Join(places, ", ")+")")
+	}
+	source := fmt.Sprintf("(VALUES %s) AS xorm_source (%s)", strings.Join(values, ", "), quoteColumns(db, colNames))
+	// a MERGE statement must be terminated by a semicolon
+	return mergeSql(db, tableName, source, colNames, conflictCols, updateCols) + ";"
+}
+
+// ReturningSql adds an OUTPUT clause, which goes before the VALUES of an
+// INSERT, before the WHERE of an UPDATE or a DELETE and at the end of a MERGE
+func (db *mssql) ReturningSql(sqlStr string, cols []string, deleted bool) (string, bool) {
+	output := outputClause(db, cols, deleted)
+
+	if strings.HasPrefix(sqlStr, "MERGE ") {
+		return strings.TrimSuffix(sqlStr, ";") + output + ";", false
+	}
+
+	sep := " WHERE "
+	if strings.HasPrefix(sqlStr, "INSERT ") {
+		sep = " VALUES "
+	}
+	if i := strings.Index(sqlStr, sep); i >= 0 {
+		return sqlStr[:i] + output + sqlStr[i:], false
+	}
+	return sqlStr + output, false
+}
+
 func (db *mssql) IsReserved(name string) bool {
 	_, ok := mssqlReservedWords[name]
 	return ok
@@ -296,6 +327,71 @@ func (db *mssql) DropTableSql(tableName string) string {
 		"DROP TABLE \"%s\"", tableName, tableName)
 }
 
+// AlterColumnSqls returns the statements to change both the type and the
+// nullability of a column, mssql's ALTER COLUMN doesn't accept a default.
+func (db *mssql) AlterColumnSqls(tableName string, col *core.Column) []string {
+	var nullable = "NOT NULL"
+	if col.Nullable {
+		nullable = "NULL"
+	}
+	return []string{fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s %s %s",
+		db.Quote(tableName), db.Quote(col.Name), db.SqlType(col), nullable)}
+}
+
+func (db *mssql) SavepointSql(name string) string {
+	return "SAVE TRANSACTION " + name
+}
+
+// ReleaseSavepointSql returns empty, mssql releases savepoints on commit only
+func (db *mssql) ReleaseSavepointSql(name string) string {
+	return ""
+}
+
+func (db *mssql) RollbackToSavepointSql(name string) string {
+	return "ROLLBACK TRANSACTION " + name
+}
+
+// SetTransactionSqls returns the SET TRANSACTION ISOLATION LEVEL statement
+// for the odbc driver, which doesn't support sql.TxOptions. The options are
+// given to the mssql driver, which does.
+func (db *mssql) SetTransactionSqls(isolation sql.IsolationLevel, readOnly bool) ([]string, error) {
+	if readOnly {
+		return nil, errors.New("mssql does not support read-only transactions")
+	}
+	switch db.DriverName() {
+	case "mssql":
+		return nil, nil
+	case "odbc":
+	default:
+		return nil, fmt.Errorf("mssql driver %v does not support transaction options", db.DriverName())
+	}
+
+	var level string
+	switch isolation {
+	case sql.LevelDefault:
+		return []string{}, nil
+	case sql.LevelReadUncommitted:
+		level = "READ UNCOMMITTED"
+	case sql.LevelReadCommitted:
+		level = "READ COMMITTED"
+	case sql.LevelRepeatableRead:
+		level = "REPEATABLE READ"
+	case sql.LevelSnapshot:
+		level = "SNAPSHOT"
+	case sql.LevelSerializable:
+		level = "SERIALIZABLE"
+	default:
+		return nil, fmt.Errorf("mssql does not support isolation level %v", isolation)
+	}
+	return []string{"SET TRANSACTION ISOLATION LEVEL " + level}, nil
+}
+
+// ResetTransactionSqls returns the statement restoring the default isolation
+// level, which SET TRANSACTION changes for the whole connection
+func (db *mssql) ResetTransactionSqls() []string {
+	return []string{"SET TRANSACTION ISOLATION LEVEL READ COMMITTED"}
+}
+
 func (db *mssql) SupportCharset() bool {
 	return false
 }
@@ -330,8 +426,10 @@ func (db *mssql) TableCheckSql(tableName string) (string, []interface{}) {
 
 func (db *mssql) GetColumns(tableName string) ([]string, map[string]*core.Column, error) {
 	args := []interface{}{}
-	s := `select a.name as name, b.name as ctype,a.max_length,a.precision,a.scale
+	s := `select a.name as name, b.name as ctype,a.max_length,a.precision,a.scale,
+CAST(ep.value AS NVARCHAR(4000)) as comment
 from sys.columns a left join sys.types b on a.user_type_id=b.user_type_id
+left join sys.extended_properties ep on ep.major_id=a.object_id and ep.minor_id=a.column_id and ep.name='MS_Description'
 where a.object_id=object_id('` + tableName + `')`
 	db.LogSQL(s, args)
 
@@ -346,13 +444,17 @@ where a.object_id=object_id('` + tableName + `')`
 	for rows.Next() {
 		var name, ctype, precision, scale string
 		var maxLen int
-		err = rows.Scan(&name, &ctype, &maxLen, &precision, &scale)
+		var comment *string
+		err = rows.Scan(&name, &ctype, &maxLen, &precision, &scale, &comment)
 		if err != nil {
 			return nil, nil, err
 		}
 
 		col := new(core.Column)
 		col.Indexes = make(map[string]int)
+		if comment != nil {
+			col.Comment = *comment
+		}
 		col.Length = maxLen
 		col.Name = strings.Trim(name, "` ")
 
@@ -414,39 +516,57 @@ func (db *mssql) GetTables() ([]*core.Table, error) {
 }
 
 func (db *mssql) GetIndexes(tableName string) (map[string]*core.Index, error) {
+	indexes, _, err := db.indexes(tableName)
+	return indexes, err
+}
+
+// GetIndexOptions returns the options of the indexes of the table
+func (db *mssql) GetIndexOptions(tableName string) (map[string]*IndexOptions, error) {
+	_, options, err := db.indexes(tableName)
+	return options, err
+}
+
+// indexes reads the indexes of the table and their options
+func (db *mssql) indexes(tableName string) (map[string]*core.Index, map[string]*IndexOptions, error) {
 	args := []interface{}{tableName}
 	s := `SELECT
 IXS.NAME                    AS  [INDEX_NAME],
 C.NAME                      AS  [COLUMN_NAME],
-IXS.is_unique AS [IS_UNIQUE]
+IXS.is_unique AS [IS_UNIQUE],
+IXCS.is_descending_key AS [IS_DESC],
+IXS.filter_definition AS [FILTER]
 FROM SYS.INDEXES IXS
 INNER JOIN SYS.INDEX_COLUMNS   IXCS
 ON IXS.OBJECT_ID=IXCS.OBJECT_ID  AND IXS.INDEX_ID = IXCS.INDEX_ID
 INNER   JOIN SYS.COLUMNS C  ON IXS.OBJECT_ID=C.OBJECT_ID
 AND IXCS.COLUMN_ID=C.COLUMN_ID
 WHERE IXS.TYPE_DESC='NONCLUSTERED' and OBJECT_NAME(IXS.OBJECT_ID) =?
+ORDER BY IXS.NAME, IXCS.key_ordinal
 `
 	db.LogSQL(s, args)
 
 	rows, err := db.DB().Query(s, args...)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	defer rows.Close()
 
 	indexes := make(map[string]*core.Index, 0)
+	options := make(map[string]*IndexOptions)
 	for rows.Next() {
 		var indexType int
 		var indexName, colName, isUnique string
+		var isDesc bool
+		var filter *string
 
-		err = rows.Scan(&indexName, &colName, &isUnique)
+		err = rows.Scan(&indexName, &colName, &isUnique, &isDesc, &filter)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 
 		i, err := strconv.ParseBool(isUnique)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 
 		if i {
@@ -470,8 +590,56 @@ WHERE IXS.TYPE_DESC='NONCLUSTERED' and OBJECT_NAME(IXS.OBJECT_ID) =?
 			indexes[indexName] = index
 		}
 		index.AddColumn(colName)
+
+		opts := options[indexName]
+		if opts == nil {
+			opts = new(IndexOptions)
+		}
+		if isDesc {
+			opts.Desc = append(opts.Desc, colName)
+		}
+		if filter != nil {
+			opts.Where = trimParens(*filter)
+		}
+		if !opts.isEmpty() {
+			options[indexName] = opts
+		}
 	}
-	return indexes, nil
+	return indexes, options, nil
+}
+
+// GetForeignKeys returns the foreign keys of the table
+func (db *mssql) GetForeignKeys(tableName string) ([]*ForeignKey, error) {
+	args := []interface{}{tableName}
+	s := `SELECT fk.name, pc.name, rt.name, rc.name,
+fk.delete_referential_action_desc, fk.update_referential_action_desc
+FROM sys.foreign_keys fk
+INNER JOIN sys.foreign_key_columns fkc ON fkc.constraint_object_id = fk.object_id
+INNER JOIN sys.columns pc ON pc.object_id = fkc.parent_object_id AND pc.column_id = fkc.parent_column_id
+INNER JOIN sys.tables rt ON rt.object_id = fkc.referenced_object_id
+INNER JOIN sys.columns rc ON rc.object_id = fkc.referenced_object_id AND rc.column_id = fkc.referenced_column_id
+WHERE OBJECT_NAME(fk.parent_object_id) = ?
+ORDER BY fk.name, fkc.constraint_column_id`
+	db.LogSQL(s, args)
+	return queryForeignKeys(db.DB(), s, args...)
+}
+
+// GetChecks returns the check constraints of the table
+func (db *mssql) GetChecks(tableName string) ([]*Check, error) {
+	args := []interface{}{tableName}
+	s := `SELECT name, definition FROM sys.check_constraints WHERE OBJECT_NAME(parent_object_id) = ?`
+	db.LogSQL(s, args)
+	return queryChecks(db.DB(), s, args...)
+}
+
+// GetGeneratedColumns returns the computed columns of the table, stored
+// when they are persisted
+func (db *mssql) GetGeneratedColumns(tableName string) (map[string]*GeneratedColumn, error) {
+	args := []interface{}{tableName}
+	s := `SELECT name, definition, CASE WHEN is_persisted = 1 THEN 'STORED' ELSE 'VIRTUAL' END
+FROM sys.computed_columns WHERE OBJECT_NAME(object_id) = ?`
+	db.LogSQL(s, args)
+	return queryGeneratedColumns(db.DB(), s, args...)
 }
 
 func (db *mssql) CreateTableSql(table *core.Table, tableName, storeEngine, charset string) string {
@@ -515,3 +683,44 @@ func (db *mssql) ForUpdateSql(query string) string {
 func (db *mssql) Filters() []core.Filter {
 	return []core.Filter{&core.IdFilter{}, &core.QuoteFilter{}}
 }
+
+// IsRetryableError returns true when the transaction was chosen as a
+// deadlock victim (1205)
+func (db *mssql) IsRetryableError(err error) bool {
+	code, ok := driverErrorIntCode(err, "Number")
+	return ok && code == 1205
+}
+
+// ConstraintError translates unique key (2627), unique index (2601), foreign
+// key or check (547) and null column (515) violations
+func (db *mssql) ConstraintError(err error) *ConstraintError {
+	code, ok := driverErrorIntCode(err, "Number")
+	if !ok {
+		return nil
+	}
+
+	ce := &ConstraintError{Err: err}
+	msg := err.Error()
+	switch code {
+	case 2627:
+		ce.Kind = ErrUniqueViolation
+		ce.Constraint = between(msg, "constraint '", "'")
+	case 2601:
+		ce.Kind = ErrUniqueViolation
+		ce.Constraint = between(msg, "unique index '", "'")
+	case 547:
+		// the table of the message is the referenced one, so it's not used
+		if strings.Contains(msg, "CHECK constraint") {
+			ce.Kind = ErrCheckViolation
+		} else {
+			ce.Kind = ErrForeignKeyViolation
+		}
+		ce.Constraint = between(msg, "constraint \"", "\"")
+	case 515:
+		ce.Kind = ErrNotNullViolation
+		ce.Column = between(msg, "into column '", "'")
+	default:
+		return nil
+	}
+	return ce
+}
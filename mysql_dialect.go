@@ -247,6 +247,29 @@ func (db *mysql) SupportInsertMany() bool {
 	return true
 }
 
+// UpsertSql returns an INSERT ... ON DUPLICATE KEY UPDATE statement, mysql
+// checks all the unique keys so conflictCols is only used to keep the
+// existing records
+func (db *mysql) UpsertSql(tableName string, colNames []string, rows [][]string, conflictCols, updateCols []string) string {
+	return db.UpsertIdSql(tableName, colNames, rows, conflictCols, updateCols, "")
+}
+
+// UpsertIdSql returns the UpsertSql statement which also makes the id of the
+// conflicting record the last insert id, by LAST_INSERT_ID(autoIncrCol)
+func (db *mysql) UpsertIdSql(tableName string, colNames []string, rows [][]string, conflictCols, updateCols []string, autoIncrCol string) string {
+	sets := make([]string, 0, len(updateCols)+1)
+	for _, colName := range updateCols {
+		sets = append(sets, fmt.Sprintf("%s = VALUES(%s)", db.Quote(colName), db.Quote(colName)))
+	}
+	if autoIncrCol != "" {
+		sets = append(sets, fmt.Sprintf("%s = LAST_INSERT_ID(%s)", db.Quote(autoIncrCol), db.Quote(autoIncrCol)))
+	}
+	if len(sets) == 0 {
+		sets = append(sets, fmt.Sprintf("%s = %s", db.Quote(conflictCols[0]), db.Quote(conflictCols[0])))
+	}
+	return insertValuesSql(db, tableName, colNames, rows) + " ON DUPLICATE KEY UPDATE " + strings.Join(sets, ", ")
+}
+
 func (db *mysql) IsReserved(name string) bool {
 	_, ok := mysqlReservedWords[name]
 	return ok
@@ -298,7 +321,7 @@ func (db *mysql) TableCheckSql(tableName string) (string, []interface{}) {
 func (db *mysql) GetColumns(tableName string) ([]string, map[string]*core.Column, error) {
 	args := []interface{}{db.DbName, tableName}
 	s := "SELECT `COLUMN_NAME`, `IS_NULLABLE`, `COLUMN_DEFAULT`, `COLUMN_TYPE`," +
-		" `COLUMN_KEY`, `EXTRA` FROM `INFORMATION_SCHEMA`.`COLUMNS` WHERE `TABLE_SCHEMA` = ? AND `TABLE_NAME` = ?"
+		" `COLUMN_KEY`, `EXTRA`, `COLUMN_COMMENT` FROM `INFORMATION_SCHEMA`.`COLUMNS` WHERE `TABLE_SCHEMA` = ? AND `TABLE_NAME` = ?"
 	db.LogSQL(s, args)
 
 	rows, err := db.DB().Query(s, args...)
@@ -313,13 +336,14 @@ func (db *mysql) GetColumns(tableName string) ([]string, map[string]*core.Column
 		col := new(core.Column)
 		col.Indexes = make(map[string]int)
 
-		var columnName, isNullable, colType, colKey, extra string
+		var columnName, isNullable, colType, colKey, extra, comment string
 		var colDefault *string
-		err = rows.Scan(&columnName, &isNullable, &colDefault, &colType, &colKey, &extra)
+		err = rows.Scan(&columnName, &isNullable, &colDefault, &colType, &colKey, &extra, &comment)
 		if err != nil {
 			return nil, nil, err
 		}
 		col.Name = strings.Trim(columnName, "` ")
+		col.Comment = comment
 		if "YES" == isNullable {
 			col.Nullable = true
 		}
@@ -434,23 +458,48 @@ func (db *mysql) GetTables() ([]*core.Table, error) {
 }
 
 func (db *mysql) GetIndexes(tableName string) (map[string]*core.Index, error) {
+	indexes, _, err := db.indexes(tableName)
+	return indexes, err
+}
+
+// GetIndexOptions returns the options of the indexes of the table
+func (db *mysql) GetIndexOptions(tableName string) (map[string]*IndexOptions, error) {
+	_, options, err := db.indexes(tableName)
+	return options, err
+}
+
+// indexes reads the indexes of the table and their options, the functional
+// key parts of mysql 8 have an expression instead of a column
+func (db *mysql) indexes(tableName string) (map[string]*core.Index, map[string]*IndexOptions, error) {
+	hasExpr, err := db.hasInformationSchemaColumn("STATISTICS", "EXPRESSION")
+	if err != nil {
+		return nil, nil, err
+	}
+	expr := "NULL"
+	if hasExpr {
+		expr = "`EXPRESSION`"
+	}
 	args := []interface{}{db.DbName, tableName}
-	s := "SELECT `INDEX_NAME`, `NON_UNIQUE`, `COLUMN_NAME` FROM `INFORMATION_SCHEMA`.`STATISTICS` WHERE `TABLE_SCHEMA` = ? AND `TABLE_NAME` = ?"
+	s := "SELECT `INDEX_NAME`, `NON_UNIQUE`, `COLUMN_NAME`, `COLLATION`, `INDEX_TYPE`, " + expr +
+		" FROM `INFORMATION_SCHEMA`.`STATISTICS` WHERE `TABLE_SCHEMA` = ? AND `TABLE_NAME` = ?" +
+		" ORDER BY `INDEX_NAME`, `SEQ_IN_INDEX`"
 	db.LogSQL(s, args)
 
 	rows, err := db.DB().Query(s, args...)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	defer rows.Close()
 
 	indexes := make(map[string]*core.Index, 0)
+	options := make(map[string]*IndexOptions)
 	for rows.Next() {
 		var indexType int
-		var indexName, colName, nonUnique string
-		err = rows.Scan(&indexName, &nonUnique, &colName)
+		var indexName, nonUnique, method string
+		var colName, collation, colExpr *string
+		err = rows.Scan(&indexName, &nonUnique, &colName, &collation, &method, &colExpr)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 
 		if indexName == "PRIMARY" {
@@ -463,7 +512,12 @@ func (db *mysql) GetIndexes(tableName string) (map[string]*core.Index, error) {
 			indexType = core.UniqueType
 		}
 
-		colName = strings.Trim(colName, "` ")
+		var col string
+		if colName != nil {
+			col = strings.Trim(*colName, "` ")
+		} else if colExpr != nil {
+			col = trimParens(*colExpr)
+		}
 		var isRegular bool
 		if strings.HasPrefix(indexName, "IDX_"+tableName) || strings.HasPrefix(indexName, "UQE_"+tableName) {
 			indexName = indexName[5+len(tableName) : len(indexName)]
@@ -479,11 +533,127 @@ func (db *mysql) GetIndexes(tableName string) (map[string]*core.Index, error) {
 			index.Name = indexName
 			indexes[indexName] = index
 		}
-		index.AddColumn(colName)
+		index.AddColumn(col)
+
+		opts := options[indexName]
+		if opts == nil {
+			opts = new(IndexOptions)
+		}
+		if collation != nil && *collation == "D" {
+			opts.Desc = append(opts.Desc, col)
+		}
+		opts.Method = normalizeIndexMethod(method)
+		if !opts.isEmpty() {
+			options[indexName] = opts
+		}
+	}
+	return indexes, options, nil
+}
+
+// GetForeignKeys returns the foreign keys of the table
+func (db *mysql) GetForeignKeys(tableName string) ([]*ForeignKey, error) {
+	args := []interface{}{db.DbName, tableName}
+	s := "SELECT k.`CONSTRAINT_NAME`, k.`COLUMN_NAME`, k.`REFERENCED_TABLE_NAME`, k.`REFERENCED_COLUMN_NAME`, " +
+		"r.`DELETE_RULE`, r.`UPDATE_RULE` FROM `INFORMATION_SCHEMA`.`KEY_COLUMN_USAGE` k " +
+		"JOIN `INFORMATION_SCHEMA`.`REFERENTIAL_CONSTRAINTS` r ON r.`CONSTRAINT_SCHEMA` = k.`CONSTRAINT_SCHEMA` " +
+		"AND r.`CONSTRAINT_NAME` = k.`CONSTRAINT_NAME` " +
+		"WHERE k.`TABLE_SCHEMA` = ? AND k.`TABLE_NAME` = ? ORDER BY k.`CONSTRAINT_NAME`, k.`ORDINAL_POSITION`"
+	db.LogSQL(s, args)
+	return queryForeignKeys(db.DB(), s, args...)
+}
+
+// hasInformationSchemaColumn tells if the column of the information schema
+// table exists, the older versions lack the generated columns and the
+// check constraints
+func (db *mysql) hasInformationSchemaColumn(table, column string) (bool, error) {
+	args := []interface{}{table, column}
+	s := "SELECT COUNT(*) FROM `INFORMATION_SCHEMA`.`COLUMNS` WHERE `TABLE_SCHEMA` = 'information_schema'" +
+		" AND `TABLE_NAME` = ? AND `COLUMN_NAME` = ?"
+	db.LogSQL(s, args)
+
+	var count int
+	if err := db.DB().QueryRow(s, args...).Scan(&count); err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// GetChecks returns the check constraints of the table
+func (db *mysql) GetChecks(tableName string) ([]*Check, error) {
+	if ok, err := db.hasInformationSchemaColumn("CHECK_CONSTRAINTS", "CHECK_CLAUSE"); !ok || err != nil {
+		return nil, err
 	}
-	return indexes, nil
+	args := []interface{}{db.DbName, tableName}
+	s := "SELECT c.`CONSTRAINT_NAME`, c.`CHECK_CLAUSE` FROM `INFORMATION_SCHEMA`.`CHECK_CONSTRAINTS` c " +
+		"JOIN `INFORMATION_SCHEMA`.`TABLE_CONSTRAINTS` t ON t.`CONSTRAINT_SCHEMA` = c.`CONSTRAINT_SCHEMA` " +
+		"AND t.`CONSTRAINT_NAME` = c.`CONSTRAINT_NAME` " +
+		"WHERE t.`TABLE_SCHEMA` = ? AND t.`TABLE_NAME` = ? AND t.`CONSTRAINT_TYPE` = 'CHECK'"
+	db.LogSQL(s, args)
+	return queryChecks(db.DB(), s, args...)
+}
+
+// GetGeneratedColumns returns the generated columns of the table
+func (db *mysql) GetGeneratedColumns(tableName string) (map[string]*GeneratedColumn, error) {
+	if ok, err := db.hasInformationSchemaColumn("COLUMNS", "GENERATION_EXPRESSION"); !ok || err != nil {
+		return nil, err
+	}
+	args := []interface{}{db.DbName, tableName}
+	s := "SELECT `COLUMN_NAME`, `GENERATION_EXPRESSION`, " +
+		"CASE WHEN `EXTRA` LIKE 'STORED%' THEN 'STORED' ELSE 'VIRTUAL' END FROM `INFORMATION_SCHEMA`.`COLUMNS` " +
+		"WHERE `TABLE_SCHEMA` = ? AND `TABLE_NAME` = ? AND `EXTRA` LIKE '%GENERATED'"
+	db.LogSQL(s, args)
+	return queryGeneratedColumns(db.DB(), s, args...)
 }
 
 func (db *mysql) Filters() []core.Filter {
 	return []core.Filter{&core.IdFilter{}}
 }
+
+// IsRetryableError returns true for deadlocks (1213) and lock wait
+// timeouts (1205)
+func (db *mysql) IsRetryableError(err error) bool {
+	code, ok := driverErrorIntCode(err, "Number")
+	return ok && (code == 1213 || code == 1205)
+}
+
+// ConstraintError translates duplicate keys (1062), foreign key failures
+// (1451, 1452), null columns (1048, 1364) and check failures (3819)
+func (db *mysql) ConstraintError(err error) *ConstraintError {
+	code, ok := driverErrorIntCode(err, "Number")
+	if !ok {
+		return nil
+	}
+
+	ce := &ConstraintError{Err: err}
+	msg := err.Error()
+	switch code {
+	case 1062:
+		// Duplicate entry 'a' for key 'name', the key is prefixed by the
+		// table since MySQL 8.0.19
+		ce.Kind = ErrUniqueViolation
+		ce.Constraint = between(msg, "for key '", "'")
+		if dot := strings.LastIndex(ce.Constraint, "."); dot > 0 {
+			ce.Table = ce.Constraint[:dot]
+			ce.Constraint = ce.Constraint[dot+1:]
+		}
+	case 1451, 1452:
+		// a foreign key constraint fails (`db`.`table`, CONSTRAINT `fk`
+		// FOREIGN KEY (`col`) REFERENCES ...)
+		ce.Kind = ErrForeignKeyViolation
+		ce.Table = between(msg, "`.`", "`")
+		ce.Constraint = between(msg, "CONSTRAINT `", "`")
+		ce.Column = between(msg, "FOREIGN KEY (`", "`")
+	case 1048:
+		ce.Kind = ErrNotNullViolation
+		ce.Column = between(msg, "Column '", "'")
+	case 1364:
+		ce.Kind = ErrNotNullViolation
+		ce.Column = between(msg, "Field '", "'")
+	case 3819:
+		ce.Kind = ErrCheckViolation
+		ce.Constraint = between(msg, "constraint '", "'")
+	default:
+		return nil
+	}
+	return ce
+}
@@ -5,6 +5,7 @@
 package xorm
 
 import (
+	"database/sql"
 	"errors"
 	"fmt"
 	"strconv"
@@ -544,6 +545,28 @@ func (db *oracle) SupportInsertMany() bool {
 	return true
 }
 
+// UpsertSql returns a MERGE statement whose source selects the records from
+// dual
+func (db *oracle) UpsertSql(tableName string, colNames []string, rows [][]string, conflictCols, updateCols []string) string {
+	selects := make([]string, 0, len(rows))
+	for _, places := range rows {
+		fields := make([]string, 0, len(places))
+		for i, place := range places {
+			fields = append(fields, place+" "+db.Quote(colNames[i]))
+		}
+		selects = append(selects, "SELECT "+strings.Join(fields, ", ")+" FROM dual")
+	}
+	source := "(" + strings.Join(selects, " UNION ALL ") + ") xorm_source"
+	return mergeSql(db, tableName, source, colNames, conflictCols, updateCols)
+}
+
+// ReturningSql appends a RETURNING ... INTO clause, the values of a single
+// record are returned through output parameters
+func (db *oracle) ReturningSql(sqlStr string, cols []string, deleted bool) (string, bool) {
+	places := strings.TrimSuffix(strings.Repeat("?, ", len(cols)), ", ")
+	return sqlStr + returningClause(db, cols) + " INTO " + places, true
+}
+
 func (db *oracle) IsReserved(name string) bool {
 	_, ok := oracleReservedWords[name]
 	return ok
@@ -577,6 +600,44 @@ func (db *oracle) DropTableSql(tableName string) string {
 	return fmt.Sprintf("DROP TABLE `%s`", tableName)
 }
 
+// AlterColumnSqls returns the statements to change both the type and the
+// nullability of a column.
+func (db *oracle) AlterColumnSqls(tableName string, col *core.Column) []string {
+	return []string{fmt.Sprintf("ALTER TABLE %s MODIFY (%s)",
+		db.Quote(tableName), col.StringNoPk(db))}
+}
+
+func (db *oracle) SavepointSql(name string) string {
+	return "SAVEPOINT " + name
+}
+
+// ReleaseSavepointSql returns empty, oracle has no RELEASE SAVEPOINT
+func (db *oracle) ReleaseSavepointSql(name string) string {
+	return ""
+}
+
+func (db *oracle) RollbackToSavepointSql(name string) string {
+	return "ROLLBACK TO SAVEPOINT " + name
+}
+
+// SetTransactionSqls returns the SET TRANSACTION statement of the options,
+// oracle only supports the READ COMMITTED and SERIALIZABLE levels and a
+// read-only transaction is always transaction-level consistent.
+func (db *oracle) SetTransactionSqls(isolation sql.IsolationLevel, readOnly bool) ([]string, error) {
+	if readOnly {
+		return []string{"SET TRANSACTION READ ONLY"}, nil
+	}
+	switch isolation {
+	case sql.LevelDefault:
+		return []string{}, nil
+	case sql.LevelReadUncommitted, sql.LevelReadCommitted:
+		return []string{"SET TRANSACTION ISOLATION LEVEL READ COMMITTED"}, nil
+	case sql.LevelRepeatableRead, sql.LevelSnapshot, sql.LevelSerializable:
+		return []string{"SET TRANSACTION ISOLATION LEVEL SERIALIZABLE"}, nil
+	}
+	return nil, fmt.Errorf("oracle does not support isolation level %v", isolation)
+}
+
 func (b *oracle) CreateTableSql(table *core.Table, tableName, storeEngine, charset string) string {
 	var sql string
 	sql = "CREATE TABLE "
@@ -678,8 +739,9 @@ func (db *oracle) IsColumnExist(tableName, colName string) (bool, error) {
 
 func (db *oracle) GetColumns(tableName string) ([]string, map[string]*core.Column, error) {
 	args := []interface{}{tableName}
-	s := "SELECT column_name,data_default,data_type,data_length,data_precision,data_scale," +
-		"nullable FROM USER_TAB_COLUMNS WHERE table_name = :1"
+	s := "SELECT t.column_name,t.data_default,t.data_type,t.data_length,t.data_precision,t.data_scale," +
+		"t.nullable,c.comments FROM USER_TAB_COLUMNS t LEFT JOIN USER_COL_COMMENTS c " +
+		"ON c.table_name = t.table_name AND c.column_name = t.column_name WHERE t.table_name = :1"
 	db.LogSQL(s, args)
 
 	rows, err := db.DB().Query(s, args...)
@@ -694,14 +756,17 @@ func (db *oracle) GetColumns(tableName string) ([]string, map[string]*core.Colum
 		col := new(core.Column)
 		col.Indexes = make(map[string]int)
 
-		var colName, colDefault, nullable, dataType, dataPrecision, dataScale *string
+		var colName, colDefault, nullable, dataType, dataPrecision, dataScale, comment *string
 		var dataLen int
 
 		err = rows.Scan(&colName, &colDefault, &dataType, &dataLen, &dataPrecision,
-			&dataScale, &nullable)
+			&dataScale, &nullable, &comment)
 		if err != nil {
 			return nil, nil, err
 		}
+		if comment != nil {
+			col.Comment = *comment
+		}
 
 		col.Name = strings.Trim(*colName, `" `)
 		if colDefault != nil {
@@ -799,25 +864,43 @@ func (db *oracle) GetTables() ([]*core.Table, error) {
 }
 
 func (db *oracle) GetIndexes(tableName string) (map[string]*core.Index, error) {
+	indexes, _, err := db.indexes(tableName)
+	return indexes, err
+}
+
+// GetIndexOptions returns the options of the indexes of the table
+func (db *oracle) GetIndexOptions(tableName string) (map[string]*IndexOptions, error) {
+	_, options, err := db.indexes(tableName)
+	return options, err
+}
+
+// indexes reads the indexes of the table and their options. The entries of
+// the function-based indexes, including the descending columns, have their
+// expression in user_ind_expressions.
+func (db *oracle) indexes(tableName string) (map[string]*core.Index, map[string]*IndexOptions, error) {
 	args := []interface{}{tableName}
-	s := "SELECT t.column_name,i.uniqueness,i.index_name FROM user_ind_columns t,user_indexes i " +
-		"WHERE t.index_name = i.index_name and t.table_name = i.table_name and t.table_name =:1"
+	s := "SELECT t.column_name,i.uniqueness,i.index_name,t.descend,e.column_expression " +
+		"FROM user_ind_columns t JOIN user_indexes i ON t.index_name = i.index_name and t.table_name = i.table_name " +
+		"LEFT JOIN user_ind_expressions e ON e.index_name = t.index_name and e.column_position = t.column_position " +
+		"WHERE t.table_name =:1 ORDER BY t.index_name, t.column_position"
 	db.LogSQL(s, args)
 
 	rows, err := db.DB().Query(s, args...)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	defer rows.Close()
 
 	indexes := make(map[string]*core.Index, 0)
+	options := make(map[string]*IndexOptions)
 	for rows.Next() {
 		var indexType int
-		var indexName, colName, uniqueness string
+		var indexName, colName, uniqueness, descend string
+		var expr *string
 
-		err = rows.Scan(&colName, &uniqueness, &indexName)
+		err = rows.Scan(&colName, &uniqueness, &indexName, &descend, &expr)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 
 		indexName = strings.Trim(indexName, `" `)
@@ -828,6 +911,14 @@ func (db *oracle) GetIndexes(tableName string) (map[string]*core.Index, error) {
 			indexType = core.IndexType
 		}
 
+		if expr != nil {
+			// a descending column is indexed as the expression "COL"
+			colName = strings.TrimSpace(*expr)
+			if unquoted := strings.Trim(colName, `"`); !isIndexExpr(unquoted) {
+				colName = unquoted
+			}
+		}
+
 		var index *core.Index
 		var ok bool
 		if index, ok = indexes[indexName]; !ok {
@@ -837,10 +928,91 @@ func (db *oracle) GetIndexes(tableName string) (map[string]*core.Index, error) {
 			indexes[indexName] = index
 		}
 		index.AddColumn(colName)
+
+		if descend == "DESC" {
+			opts := options[indexName]
+			if opts == nil {
+				opts = new(IndexOptions)
+				options[indexName] = opts
+			}
+			opts.Desc = append(opts.Desc, colName)
+		}
 	}
-	return indexes, nil
+	return indexes, options, nil
+}
+
+// GetForeignKeys returns the foreign keys of the table, oracle has no update
+// action
+func (db *oracle) GetForeignKeys(tableName string) ([]*ForeignKey, error) {
+	args := []interface{}{tableName}
+	s := "SELECT c.constraint_name, cc.column_name, rc.table_name, rcc.column_name, c.delete_rule, 'NO ACTION' " +
+		"FROM user_constraints c " +
+		"JOIN user_cons_columns cc ON cc.constraint_name = c.constraint_name " +
+		"JOIN user_constraints rc ON rc.constraint_name = c.r_constraint_name " +
+		"JOIN user_cons_columns rcc ON rcc.constraint_name = rc.constraint_name AND rcc.position = cc.position " +
+		"WHERE c.constraint_type = 'R' AND c.table_name = :1 ORDER BY c.constraint_name, cc.position"
+	db.LogSQL(s, args)
+	return queryForeignKeys(db.DB(), s, args...)
+}
+
+// GetChecks returns the check constraints of the table, except the NOT NULL
+// ones oracle names itself
+func (db *oracle) GetChecks(tableName string) ([]*Check, error) {
+	args := []interface{}{tableName}
+	s := "SELECT constraint_name, search_condition FROM user_constraints " +
+		"WHERE table_name = :1 AND constraint_type = 'C' AND generated = 'USER NAME'"
+	db.LogSQL(s, args)
+	return queryChecks(db.DB(), s, args...)
+}
+
+// GetGeneratedColumns returns the virtual columns of the table
+func (db *oracle) GetGeneratedColumns(tableName string) (map[string]*GeneratedColumn, error) {
+	args := []interface{}{tableName}
+	s := "SELECT column_name, data_default, 'VIRTUAL' FROM user_tab_cols " +
+		"WHERE table_name = :1 AND virtual_column = 'YES' AND hidden_column = 'NO'"
+	db.LogSQL(s, args)
+	return queryGeneratedColumns(db.DB(), s, args...)
 }
 
 func (db *oracle) Filters() []core.Filter {
 	return []core.Filter{&core.QuoteFilter{}, &core.SeqFilter{":", 1}, &core.IdFilter{}}
 }
+
+// IsRetryableError returns true for deadlocks (ORA-00060) and serialization
+// failures (ORA-08177)
+func (db *oracle) IsRetryableError(err error) bool {
+	return errorContains(err, "ORA-00060", "ORA-08177")
+}
+
+// ConstraintError translates ORA-00001 (unique), ORA-02291 and ORA-02292
+// (foreign key), ORA-01400 (not null) and ORA-02290 (check)
+func (db *oracle) ConstraintError(err error) *ConstraintError {
+	ce := &ConstraintError{Err: err}
+	switch {
+	case errorContains(err, "ORA-00001"):
+		ce.Kind = ErrUniqueViolation
+	case errorContains(err, "ORA-02291", "ORA-02292"):
+		ce.Kind = ErrForeignKeyViolation
+	case errorContains(err, "ORA-02290"):
+		ce.Kind = ErrCheckViolation
+	case errorContains(err, "ORA-01400"):
+		// cannot insert NULL into ("SCHEMA"."TABLE"."COLUMN")
+		ce.Kind = ErrNotNullViolation
+		names := strings.Split(between(err.Error(), "(", ")"), ".")
+		if len(names) >= 2 {
+			ce.Table = strings.Trim(names[len(names)-2], "\"")
+			ce.Column = strings.Trim(names[len(names)-1], "\"")
+		}
+		return ce
+	default:
+		return nil
+	}
+
+	// unique constraint (SCHEMA.NAME) violated
+	name := between(err.Error(), "(", ")")
+	if dot := strings.LastIndex(name, "."); dot >= 0 {
+		name = name[dot+1:]
+	}
+	ce.Constraint = name
+	return ce
+}
@@ -827,6 +827,16 @@ func (db *postgres) SupportInsertMany() bool {
 	return true
 }
 
+// UpsertSql returns an INSERT ... ON CONFLICT statement
+func (db *postgres) UpsertSql(tableName string, colNames []string, rows [][]string, conflictCols, updateCols []string) string {
+	return insertValuesSql(db, tableName, colNames, rows) + onConflictSql(db, conflictCols, updateCols)
+}
+
+// ReturningSql appends a RETURNING clause
+func (db *postgres) ReturningSql(sqlStr string, cols []string, deleted bool) (string, bool) {
+	return sqlStr + returningClause(db, cols), false
+}
+
 func (db *postgres) IsReserved(name string) bool {
 	_, ok := postgresReservedWords[name]
 	return ok
@@ -879,6 +889,21 @@ func (db *postgres) ModifyColumnSql(tableName string, col *core.Column) string {
 		tableName, col.Name, db.SqlType(col))
 }
 
+// AlterColumnSqls returns the statements to change both the type and the
+// nullability of a column, ALTER COLUMN TYPE keeps the nullability.
+func (db *postgres) AlterColumnSqls(tableName string, col *core.Column) []string {
+	var nullable = "SET NOT NULL"
+	if col.Nullable {
+		nullable = "DROP NOT NULL"
+	}
+	return []string{
+		fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s TYPE %s",
+			db.Quote(tableName), db.Quote(col.Name), db.SqlType(col)),
+		fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s %s",
+			db.Quote(tableName), db.Quote(col.Name), nullable),
+	}
+}
+
 func (db *postgres) DropIndexSql(tableName string, index *core.Index) string {
 	quote := db.Quote
 	//var unique string
@@ -914,7 +939,8 @@ func (db *postgres) GetColumns(tableName string) ([]string, map[string]*core.Col
 	args := []interface{}{tableName, "public"}
 	s := `SELECT column_name, column_default, is_nullable, data_type, character_maximum_length, numeric_precision, numeric_precision_radix ,
     CASE WHEN p.contype = 'p' THEN true ELSE false END AS primarykey,
-    CASE WHEN p.contype = 'u' THEN true ELSE false END AS uniquekey
+    CASE WHEN p.contype = 'u' THEN true ELSE false END AS uniquekey,
+    col_description(c.oid, f.attnum) AS comment
 FROM pg_attribute f
     JOIN pg_class c ON c.oid = f.attrelid JOIN pg_type t ON t.oid = f.atttypid
     LEFT JOIN pg_attrdef d ON d.adrelid = c.oid AND d.adnum = f.attnum
@@ -939,12 +965,15 @@ WHERE c.relkind = 'r'::char AND c.relname = $1 AND s.table_schema = $2 AND f.att
 		col.Indexes = make(map[string]int)
 
 		var colName, isNullable, dataType string
-		var maxLenStr, colDefault, numPrecision, numRadix *string
+		var maxLenStr, colDefault, numPrecision, numRadix, comment *string
 		var isPK, isUnique bool
-		err = rows.Scan(&colName, &colDefault, &isNullable, &dataType, &maxLenStr, &numPrecision, &numRadix, &isPK, &isUnique)
+		err = rows.Scan(&colName, &colDefault, &isNullable, &dataType, &maxLenStr, &numPrecision, &numRadix, &isPK, &isUnique, &comment)
 		if err != nil {
 			return nil, nil, err
 		}
+		if comment != nil {
+			col.Comment = *comment
+		}
 
 		//fmt.Println(args, colName, isNullable, dataType, maxLenStr, colDefault, numPrecision, numRadix, isPK, isUnique)
 		var maxLen int
@@ -1038,6 +1067,19 @@ func (db *postgres) GetTables() ([]*core.Table, error) {
 }
 
 func (db *postgres) GetIndexes(tableName string) (map[string]*core.Index, error) {
+	indexes, _, err := db.indexes(tableName)
+	return indexes, err
+}
+
+// GetIndexOptions returns the options of the indexes of the table
+func (db *postgres) GetIndexOptions(tableName string) (map[string]*IndexOptions, error) {
+	_, options, err := db.indexes(tableName)
+	return options, err
+}
+
+// indexes parses the indexes of the table and their options from their
+// definitions
+func (db *postgres) indexes(tableName string) (map[string]*core.Index, map[string]*IndexOptions, error) {
 	// FIXME: replace the public schema to user specify schema
 	args := []interface{}{"public", tableName}
 	s := fmt.Sprintf("SELECT indexname, indexdef FROM pg_indexes WHERE schemaname=$1 AND tablename=$2")
@@ -1045,18 +1087,18 @@ func (db *postgres) GetIndexes(tableName string) (map[string]*core.Index, error)
 
 	rows, err := db.DB().Query(s, args...)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	defer rows.Close()
 
 	indexes := make(map[string]*core.Index, 0)
+	options := make(map[string]*IndexOptions)
 	for rows.Next() {
 		var indexType int
 		var indexName, indexdef string
-		var colNames []string
 		err = rows.Scan(&indexName, &indexdef)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 		indexName = strings.Trim(indexName, `" `)
 		if strings.HasSuffix(indexName, "_pkey") {
@@ -1067,8 +1109,7 @@ func (db *postgres) GetIndexes(tableName string) (map[string]*core.Index, error)
 		} else {
 			indexType = core.IndexType
 		}
-		cs := strings.Split(indexdef, "(")
-		colNames = strings.Split(cs[1][0:len(cs[1])-1], ",")
+		colNames, opts := parseIndexDef(indexdef)
 
 		if strings.HasPrefix(indexName, "IDX_"+tableName) || strings.HasPrefix(indexName, "UQE_"+tableName) {
 			newIdxName := indexName[5+len(tableName) : len(indexName)]
@@ -1078,14 +1119,93 @@ func (db *postgres) GetIndexes(tableName string) (map[string]*core.Index, error)
 		}
 
 		index := &core.Index{Name: indexName, Type: indexType, Cols: make([]string, 0)}
-		for _, colName := range colNames {
-			index.Cols = append(index.Cols, strings.Trim(colName, `" `))
-		}
+		index.Cols = append(index.Cols, colNames...)
 		indexes[index.Name] = index
+		if opts != nil {
+			options[index.Name] = opts
+		}
 	}
-	return indexes, nil
+	return indexes, options, nil
+}
+
+// GetForeignKeys returns the foreign keys of the table
+func (db *postgres) GetForeignKeys(tableName string) ([]*ForeignKey, error) {
+	// FIXME: replace the public schema to user specify schema
+	args := []interface{}{"public", tableName}
+	s := `SELECT con.conname, a.attname, rt.relname, ra.attname,
+CASE con.confdeltype WHEN 'c' THEN 'CASCADE' WHEN 'n' THEN 'SET NULL' WHEN 'd' THEN 'SET DEFAULT' WHEN 'r' THEN 'RESTRICT' ELSE 'NO ACTION' END,
+CASE con.confupdtype WHEN 'c' THEN 'CASCADE' WHEN 'n' THEN 'SET NULL' WHEN 'd' THEN 'SET DEFAULT' WHEN 'r' THEN 'RESTRICT' ELSE 'NO ACTION' END
+FROM pg_constraint con
+JOIN pg_class t ON t.oid = con.conrelid
+JOIN pg_namespace n ON n.oid = t.relnamespace
+JOIN pg_class rt ON rt.oid = con.confrelid
+CROSS JOIN LATERAL unnest(con.conkey, con.confkey) WITH ORDINALITY AS k(col, refcol, pos)
+JOIN pg_attribute a ON a.attrelid = con.conrelid AND a.attnum = k.col
+JOIN pg_attribute ra ON ra.attrelid = con.confrelid AND ra.attnum = k.refcol
+WHERE con.contype = 'f' AND n.nspname = $1 AND t.relname = $2
+ORDER BY con.conname, k.pos`
+	db.LogSQL(s, args)
+	return queryForeignKeys(db.DB(), s, args...)
+}
+
+// GetChecks returns the check constraints of the table
+func (db *postgres) GetChecks(tableName string) ([]*Check, error) {
+	// FIXME: replace the public schema to user specify schema
+	args := []interface{}{"public", tableName}
+	s := `SELECT con.conname, pg_get_constraintdef(con.oid)
+FROM pg_constraint con
+JOIN pg_class t ON t.oid = con.conrelid
+JOIN pg_namespace n ON n.oid = t.relnamespace
+WHERE con.contype = 'c' AND n.nspname = $1 AND t.relname = $2`
+	db.LogSQL(s, args)
+	return queryChecks(db.DB(), s, args...)
+}
+
+// GetGeneratedColumns returns the generated columns of the table, which
+// postgres always stores
+func (db *postgres) GetGeneratedColumns(tableName string) (map[string]*GeneratedColumn, error) {
+	// FIXME: replace the public schema to user specify schema
+	args := []interface{}{"public", tableName}
+	s := `SELECT column_name, generation_expression, 'STORED' FROM information_schema.columns
+WHERE table_schema = $1 AND table_name = $2 AND is_generated = 'ALWAYS'`
+	db.LogSQL(s, args)
+	return queryGeneratedColumns(db.DB(), s, args...)
 }
 
 func (db *postgres) Filters() []core.Filter {
 	return []core.Filter{&core.IdFilter{}, &core.QuoteFilter{}, &core.SeqFilter{"$", 1}}
 }
+
+// IsRetryableError returns true for serialization failures (40001) and
+// deadlocks (40P01)
+func (db *postgres) IsRetryableError(err error) bool {
+	code, ok := driverErrorStringCode(err, "Code")
+	return ok && (code == "40001" || code == "40P01")
+}
+
+// ConstraintError translates the integrity constraint violation SQLSTATEs,
+// the names are read from the fields of lib/pq's and pgx's errors
+func (db *postgres) ConstraintError(err error) *ConstraintError {
+	code, ok := driverErrorStringCode(err, "Code")
+	if !ok {
+		return nil
+	}
+
+	ce := &ConstraintError{Err: err}
+	switch code {
+	case "23505":
+		ce.Kind = ErrUniqueViolation
+	case "23503":
+		ce.Kind = ErrForeignKeyViolation
+	case "23502":
+		ce.Kind = ErrNotNullViolation
+	case "23514":
+		ce.Kind = ErrCheckViolation
+	default:
+		return nil
+	}
+	ce.Table = driverErrorString(err, "Table", "TableName")
+	ce.Constraint = driverErrorString(err, "Constraint", "ConstraintName")
+	ce.Column = driverErrorString(err, "Column", "ColumnName")
+	return ce
+}
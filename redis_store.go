@@ -0,0 +1,419 @@
+// Copyright 2017 The Xorm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xorm
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/caser789/go-xorm/core"
+)
+
+var _ core.CacheStore = (*RedisStore)(nil)
+
+// ErrRedisStoreClosed is returned by the operations on a closed RedisStore
+var ErrRedisStoreClosed = errors.New("redis store is closed")
+
+// RedisOptions configures a RedisStore
+type RedisOptions struct {
+	// Addr is the host:port of the server, "localhost:6379" by default
+	Addr     string
+	Password string
+	DB       int
+	// Prefix is prepended to all the keys
+	Prefix string
+	// Expiration is the time to live of the keys, 0 means no expiration
+	Expiration time.Duration
+	// Codec serializes the values, GobCodec by default
+	Codec Codec
+	// Channel is the pub/sub channel of the cache invalidations,
+	// "xorm:cache" by default
+	Channel     string
+	DialTimeout time.Duration
+	// ReadTimeout and WriteTimeout bound the reply and the sending of every
+	// command but the reading of the subscriptions, 3 seconds by default
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+	// MaxIdle is the number of idle connections kept, 4 by default
+	MaxIdle int
+}
+
+// RedisStore implements CacheStore on top of a server speaking the redis
+// protocol (RESP), so that the cache could be shared by processes. It also
+// implements CacheBus with the server's pub/sub.
+type RedisStore struct {
+	opts RedisOptions
+	idle chan *redisConn
+
+	mutex  sync.Mutex
+	closed bool
+	subs   map[*redisConn]bool
+}
+
+// NewRedisStore returns a RedisStore, the connections are opened when needed
+func NewRedisStore(opts RedisOptions) *RedisStore {
+	if opts.Addr == "" {
+		opts.Addr = "localhost:6379"
+	}
+	if opts.Codec == nil {
+		opts.Codec = GobCodec{}
+	}
+	if opts.Channel == "" {
+		opts.Channel = "xorm:cache"
+	}
+	if opts.DialTimeout <= 0 {
+		opts.DialTimeout = 5 * time.Second
+	}
+	if opts.ReadTimeout <= 0 {
+		opts.ReadTimeout = 3 * time.Second
+	}
+	if opts.WriteTimeout <= 0 {
+		opts.WriteTimeout = 3 * time.Second
+	}
+	if opts.MaxIdle <= 0 {
+		opts.MaxIdle = 4
+	}
+	return &RedisStore{
+		opts: opts,
+		idle: make(chan *redisConn, opts.MaxIdle),
+		subs: make(map[*redisConn]bool),
+	}
+}
+
+// Put implements CacheStore
+func (s *RedisStore) Put(key string, value interface{}) error {
+	data, err := s.opts.Codec.Encode(value)
+	if err != nil {
+		return err
+	}
+
+	args := []interface{}{"SET", s.opts.Prefix + key, data}
+	if s.opts.Expiration > 0 {
+		args = append(args, "PX", int64(s.opts.Expiration/time.Millisecond))
+	}
+	_, err = s.do(args...)
+	return err
+}
+
+// Get implements CacheStore
+func (s *RedisStore) Get(key string) (interface{}, error) {
+	reply, err := s.do("GET", s.opts.Prefix+key)
+	if err != nil {
+		return nil, err
+	}
+	data, ok := reply.([]byte)
+	if !ok || data == nil {
+		return nil, ErrNotExist
+	}
+	return s.opts.Codec.Decode(data)
+}
+
+// Del implements CacheStore
+func (s *RedisStore) Del(key string) error {
+	_, err := s.do("DEL", s.opts.Prefix+key)
+	return err
+}
+
+// Publish implements CacheBus
+func (s *RedisStore) Publish(message string) error {
+	_, err := s.do("PUBLISH", s.opts.Channel, message)
+	return err
+}
+
+// Subscribe implements CacheBus, handler is called by a goroutine for every
+// message published on the channel until the store is closed. The
+// subscription is reopened when the connection is lost.
+func (s *RedisStore) Subscribe(handler func(message string)) error {
+	c, err := s.subscribe()
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		for {
+			err := s.receive(c, handler)
+			s.unsubscribe(c)
+			if err == ErrRedisStoreClosed {
+				return
+			}
+			for {
+				time.Sleep(time.Second)
+				if c, err = s.subscribe(); err == nil || err == ErrRedisStoreClosed {
+					break
+				}
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// Close closes all the connections and stops the subscriptions
+func (s *RedisStore) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+
+	for drained := false; !drained; {
+		select {
+		case c := <-s.idle:
+			c.Close()
+		default:
+			drained = true
+		}
+	}
+	for c := range s.subs {
+		c.Close()
+	}
+	return nil
+}
+
+func (s *RedisStore) subscribe() (*redisConn, error) {
+	c, err := s.dial()
+	if err != nil {
+		return nil, err
+	}
+	if _, err = c.do("SUBSCRIBE", s.opts.Channel); err != nil {
+		c.Close()
+		return nil, err
+	}
+	// the messages may come at any time
+	if err = c.conn.SetDeadline(time.Time{}); err != nil {
+		c.Close()
+		return nil, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closed {
+		c.Close()
+		return nil, ErrRedisStoreClosed
+	}
+	s.subs[c] = true
+	return c, nil
+}
+
+func (s *RedisStore) unsubscribe(c *redisConn) {
+	s.mutex.Lock()
+	delete(s.subs, c)
+	s.mutex.Unlock()
+	c.Close()
+}
+
+func (s *RedisStore) receive(c *redisConn, handler func(message string)) error {
+	for {
+		reply, err := c.read()
+		if err != nil {
+			s.mutex.Lock()
+			closed := s.closed
+			s.mutex.Unlock()
+			if closed {
+				return ErrRedisStoreClosed
+			}
+			return err
+		}
+
+		// message replies are ["message", channel, payload]
+		if values, ok := reply.([]interface{}); ok && len(values) == 3 {
+			if kind, ok := values[0].([]byte); ok && string(kind) == "message" {
+				if payload, ok := values[2].([]byte); ok {
+					handler(string(payload))
+				}
+			}
+		}
+	}
+}
+
+func (s *RedisStore) do(args ...interface{}) (interface{}, error) {
+	c, err := s.get()
+	if err != nil {
+		return nil, err
+	}
+
+	reply, err := c.do(args...)
+	if _, ok := err.(redisError); err != nil && !ok {
+		c.Close()
+		return nil, err
+	}
+	s.put(c)
+	return reply, err
+}
+
+func (s *RedisStore) get() (*redisConn, error) {
+	s.mutex.Lock()
+	if s.closed {
+		s.mutex.Unlock()
+		return nil, ErrRedisStoreClosed
+	}
+	s.mutex.Unlock()
+
+	select {
+	case c := <-s.idle:
+		return c, nil
+	default:
+		return s.dial()
+	}
+}
+
+func (s *RedisStore) put(c *redisConn) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closed {
+		c.Close()
+		return
+	}
+	select {
+	case s.idle <- c:
+	default:
+		c.Close()
+	}
+}
+
+func (s *RedisStore) dial() (*redisConn, error) {
+	conn, err := net.DialTimeout("tcp", s.opts.Addr, s.opts.DialTimeout)
+	if err != nil {
+		return nil, err
+	}
+	c := &redisConn{
+		conn:         conn,
+		r:            bufio.NewReader(conn),
+		w:            bufio.NewWriter(conn),
+		readTimeout:  s.opts.ReadTimeout,
+		writeTimeout: s.opts.WriteTimeout,
+	}
+
+	if s.opts.Password != "" {
+		if _, err := c.do("AUTH", s.opts.Password); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	if s.opts.DB != 0 {
+		if _, err := c.do("SELECT", s.opts.DB); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// redisError is an error reply of the server
+type redisError string
+
+func (e redisError) Error() string {
+	return string(e)
+}
+
+// redisConn is a connection speaking RESP, the replies are string for simple
+// strings, int64 for integers, []byte for bulk strings (nil for the null
+// bulk string) and []interface{} for arrays. The timeouts bound do, not
+// read.
+type redisConn struct {
+	conn         net.Conn
+	r            *bufio.Reader
+	w            *bufio.Writer
+	readTimeout  time.Duration
+	writeTimeout time.Duration
+}
+
+func (c *redisConn) Close() error {
+	return c.conn.Close()
+}
+
+func (c *redisConn) do(args ...interface{}) (interface{}, error) {
+	if err := c.conn.SetWriteDeadline(time.Now().Add(c.writeTimeout)); err != nil {
+		return nil, err
+	}
+	if err := c.write(args...); err != nil {
+		return nil, err
+	}
+	if err := c.conn.SetReadDeadline(time.Now().Add(c.readTimeout)); err != nil {
+		return nil, err
+	}
+	return c.read()
+}
+
+func (c *redisConn) write(args ...interface{}) error {
+	fmt.Fprintf(c.w, "*%d\r\n", len(args))
+	for _, arg := range args {
+		var b []byte
+		switch v := arg.(type) {
+		case []byte:
+			b = v
+		case string:
+			b = []byte(v)
+		case int:
+			b = strconv.AppendInt(nil, int64(v), 10)
+		case int64:
+			b = strconv.AppendInt(nil, v, 10)
+		default:
+			b = []byte(fmt.Sprint(v))
+		}
+		fmt.Fprintf(c.w, "$%d\r\n", len(b))
+		c.w.Write(b)
+		c.w.WriteString("\r\n")
+	}
+	return c.w.Flush()
+}
+
+func (c *redisConn) read() (interface{}, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, fmt.Errorf("redis: invalid reply %q", line)
+	}
+	kind, line := line[0], line[1:len(line)-2]
+
+	switch kind {
+	case '+':
+		return line, nil
+	case '-':
+		return nil, redisError(line)
+	case ':':
+		return strconv.ParseInt(line, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line)
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return []byte(nil), nil
+		}
+		data := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, data); err != nil {
+			return nil, err
+		}
+		return data[:n], nil
+	case '*':
+		n, err := strconv.Atoi(line)
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		values := make([]interface{}, n)
+		for i := range values {
+			if values[i], err = c.read(); err != nil {
+				return nil, err
+			}
+		}
+		return values, nil
+	}
+	return nil, fmt.Errorf("redis: invalid reply %q", line)
+}
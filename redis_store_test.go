@@ -0,0 +1,284 @@
+package xorm
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRedis is an in-process server speaking enough of RESP for RedisStore
+type fakeRedis struct {
+	ln   net.Listener
+	mu   sync.Mutex
+	data map[string][]byte
+	subs map[string][]net.Conn
+}
+
+func newFakeRedis(t *testing.T) *fakeRedis {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeRedis{ln: ln, data: make(map[string][]byte), subs: make(map[string][]net.Conn)}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *fakeRedis) Addr() string {
+	return s.ln.Addr().String()
+}
+
+func (s *fakeRedis) Close() {
+	s.ln.Close()
+}
+
+func (s *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		args, err := readFakeCommand(r)
+		if err != nil {
+			return
+		}
+
+		s.mu.Lock()
+		switch strings.ToUpper(args[0]) {
+		case "PING":
+			io.WriteString(conn, "+PONG\r\n")
+		case "SET":
+			s.data[args[1]] = []byte(args[2])
+			io.WriteString(conn, "+OK\r\n")
+		case "GET":
+			if v, ok := s.data[args[1]]; ok {
+				fmt.Fprintf(conn, "$%d\r\n%s\r\n", len(v), v)
+			} else {
+				io.WriteString(conn, "$-1\r\n")
+			}
+		case "DEL":
+			_, ok := s.data[args[1]]
+			delete(s.data, args[1])
+			if ok {
+				io.WriteString(conn, ":1\r\n")
+			} else {
+				io.WriteString(conn, ":0\r\n")
+			}
+		case "SUBSCRIBE":
+			s.subs[args[1]] = append(s.subs[args[1]], conn)
+			fmt.Fprintf(conn, "*3\r\n$9\r\nsubscribe\r\n$%d\r\n%s\r\n:1\r\n", len(args[1]), args[1])
+		case "PUBLISH":
+			for _, sub := range s.subs[args[1]] {
+				fmt.Fprintf(sub, "*3\r\n$7\r\nmessage\r\n$%d\r\n%s\r\n$%d\r\n%s\r\n",
+					len(args[1]), args[1], len(args[2]), args[2])
+			}
+			fmt.Fprintf(conn, ":%d\r\n", len(s.subs[args[1]]))
+		default:
+			fmt.Fprintf(conn, "-ERR unknown command '%s'\r\n", args[0])
+		}
+		s.mu.Unlock()
+	}
+}
+
+func readFakeCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, n)
+	for i := range args {
+		if line, err = r.ReadString('\n'); err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+		if err != nil {
+			return nil, err
+		}
+		data := make([]byte, size+2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, err
+		}
+		args[i] = string(data[:size])
+	}
+	return args, nil
+}
+
+type cachedUser struct {
+	Id   int64
+	Name string
+}
+
+func TestRedisStoreCodecs(t *testing.T) {
+	server := newFakeRedis(t)
+	defer server.Close()
+	// as Engine.GobRegister does
+	gob.Register(new(cachedUser))
+	registerCodecType(new(cachedUser))
+
+	for _, codec := range []Codec{GobCodec{}, NewJSONCodec()} {
+		store := NewRedisStore(RedisOptions{Addr: server.Addr(), Prefix: "test:", Codec: codec})
+
+		if err := store.Put("user-1", &cachedUser{1, "lunny"}); err != nil {
+			t.Fatal(err)
+		}
+		v, err := store.Get("user-1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user, ok := v.(*cachedUser); !ok || user.Name != "lunny" {
+			t.Fatalf("%T codec: got %#v", codec, v)
+		}
+
+		if err := store.Put("ids", "[[1]]"); err != nil {
+			t.Fatal(err)
+		}
+		if v, err := store.Get("ids"); err != nil || v != "[[1]]" {
+			t.Fatalf("%T codec: got %#v, %v", codec, v, err)
+		}
+
+		if err := store.Del("user-1"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.Get("user-1"); err != ErrNotExist {
+			t.Fatalf("%T codec: expected ErrNotExist, got %v", codec, err)
+		}
+		store.Close()
+	}
+}
+
+func TestBroadcastCacherClearBeans(t *testing.T) {
+	server := newFakeRedis(t)
+	defer server.Close()
+	// as Engine.GobRegister does
+	gob.Register(new(cachedUser))
+	registerCodecType(new(cachedUser))
+
+	storeA := NewRedisStore(RedisOptions{Addr: server.Addr()})
+	defer storeA.Close()
+	storeB := NewRedisStore(RedisOptions{Addr: server.Addr()})
+	defer storeB.Close()
+
+	cacherA, err := NewBroadcastCacher(NewLRUCacher(storeA, time.Hour, 0, 100), storeA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cacherA.Close()
+	cacherB, err := NewBroadcastCacher(NewLRUCacher(storeB, time.Hour, 0, 100), storeB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cacherB.Close()
+
+	cacherB.PutBean("user", "1", &cachedUser{1, "lunny"})
+	if _, err := storeA.Get(genId("user", "1")); err != nil {
+		t.Fatal("the bean put by B should be shared:", err)
+	}
+
+	// B is the only one which put the key, A's clear must be broadcast for it
+	// to be removed from the store
+	cacherA.ClearBeans("user")
+	for i := 0; i < 100; i++ {
+		if _, err := storeB.Get(genId("user", "1")); err == ErrNotExist {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("the bean should be evicted by B")
+}
+
+func TestRedisStoreTimeout(t *testing.T) {
+	// a server which never replies
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go io.Copy(io.Discard, conn)
+		}
+	}()
+
+	store := NewRedisStore(RedisOptions{Addr: ln.Addr().String(), ReadTimeout: 50 * time.Millisecond})
+	defer store.Close()
+	start := time.Now()
+	if _, err := store.Get("user-1"); err == nil {
+		t.Fatal("expected a timeout")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("the timeout took %v", elapsed)
+	}
+}
+
+func TestRedisStoreSubscribeIdle(t *testing.T) {
+	server := newFakeRedis(t)
+	defer server.Close()
+	store := NewRedisStore(RedisOptions{Addr: server.Addr(), ReadTimeout: 20 * time.Millisecond})
+	defer store.Close()
+
+	messages := make(chan string, 1)
+	if err := store.Subscribe(func(message string) { messages <- message }); err != nil {
+		t.Fatal(err)
+	}
+	// the subscription outlives the read timeout without reconnecting
+	time.Sleep(100 * time.Millisecond)
+	if err := store.Publish("hello"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case message := <-messages:
+		if message != "hello" {
+			t.Errorf("got %q", message)
+		}
+	case <-time.After(500 * time.Millisecond):
+		t.Error("the subscription timed out")
+	}
+}
+
+// failingBus is a CacheBus whose publications fail
+type failingBus struct{}
+
+func (failingBus) Publish(message string) error {
+	return errors.New("bus is down")
+}
+
+func (failingBus) Subscribe(handler func(message string)) error {
+	return nil
+}
+
+func TestBroadcastCacherPublishError(t *testing.T) {
+	cacher, err := NewBroadcastCacher(NewLRUCacher(NewMemoryStore(), time.Hour, 0, 100), failingBus{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	cacher.SetLogger(NewSimpleLogger(&buf))
+
+	cacher.ClearBeans("user")
+	if !strings.Contains(buf.String(), "broadcast ClearBeans of user: bus is down") {
+		t.Errorf("the failed publication isn't logged: %q", buf.String())
+	}
+}
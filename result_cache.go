@@ -0,0 +1,189 @@
+// Copyright 2017 The Xorm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xorm
+
+import (
+	"encoding/gob"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-xorm/core"
+)
+
+// sqlTableName matches a table name, which may be quoted and prefixed by a
+// schema
+const sqlTableName = "((?:[`\"\\[]?\\w+[`\"\\]]?\\.)*[`\"\\[]?\\w+[`\"\\]]?)"
+
+var (
+	// sqlTableRegexp matches the first table following a keyword
+	sqlTableRegexp = regexp.MustCompile("(?i)\\b(?:from|join|update|into)\\s+" + sqlTableName)
+	// sqlNextTableRegexp matches the next table of "FROM a, b"
+	sqlNextTableRegexp = regexp.MustCompile("(?i)^\\s*(?:(?:as\\s+)?\\w+\\s*)?,\\s*" + sqlTableName)
+
+	registerResultOnce sync.Once
+)
+
+// resultEntry is a cached result, it's cached for every table of the query
+type resultEntry struct {
+	Deadline time.Time
+	Value    interface{}
+}
+
+// registerResultTypes registers the types of the cached results for the
+// stores which encode them with GobCodec
+func registerResultTypes() {
+	registerResultOnce.Do(func() {
+		gob.Register(&resultEntry{})
+		gob.Register([]map[string][]byte{})
+		gob.Register([]map[string]string{})
+		gob.Register([]float64{})
+		gob.Register([]int64{})
+	})
+}
+
+// CacheResult caches the results of Query, QueryString, Count, Sum, Sums
+// and SumsInt for ttl. They are cached by SQL and args, and are evicted by
+// the writes to any of the tables the SQL reads. The tables are found by
+// matching the SQL, and only the writes of Insert, Update, Delete, Upsert and
+// Exec on the same engine evict the results: a write by Query, by another
+// engine or process, or by a trigger is seen once the ttl expires.
+func (session *Session) CacheResult(ttl time.Duration) *Session {
+	session.Statement.resultTTL = ttl
+	return session
+}
+
+// SetResultCacher sets the cacher of the results cached with CacheResult,
+// a LRUCacher on a MemoryStore by default. The ttl of the results is bound
+// by the expiration of the cacher.
+func (engine *Engine) SetResultCacher(cacher core.Cacher) {
+	registerResultTypes()
+	engine.mutex.Lock()
+	engine.resultCacher = cacher
+	engine.mutex.Unlock()
+}
+
+// getResultCacher returns the cacher of the results, the default one is
+// created if create is true
+func (engine *Engine) getResultCacher(create bool) core.Cacher {
+	engine.mutex.Lock()
+	defer engine.mutex.Unlock()
+	if engine.resultCacher == nil && create {
+		registerResultTypes()
+		engine.resultCacher = NewLRUCacher2(NewMemoryStore(), core.CacheExpired, 10000)
+		engine.cachers = append(engine.cachers, engine.resultCacher)
+	}
+	return engine.resultCacher
+}
+
+// cachedResult returns the cached result of sqlStr, or queries and caches it
+// when the session uses CacheResult. kind tells apart the results of the
+// same SQL returned by different methods.
+func (session *Session) cachedResult(kind, sqlStr string, args []interface{}, query func() (interface{}, error)) (interface{}, error) {
+	ttl := session.Statement.resultTTL
+	tables := sqlTables(sqlStr)
+	if ttl <= 0 || len(tables) == 0 {
+		return query()
+	}
+
+	cacher := session.overlay(session.Engine.getResultCacher(true))
+	key := kind + "-" + core.GenSqlKey(sqlStr, args)
+	now := time.Now()
+
+	hit := true
+	var entry *resultEntry
+	for _, tableName := range tables {
+		e, ok := cacher.GetIds(tableName, key).(*resultEntry)
+		if !ok || !now.Before(e.Deadline) {
+			hit = false
+			break
+		}
+		entry = e
+	}
+	session.observeCache(tables[0], "result", hit)
+	if hit {
+		session.Engine.logger.Debug("[cacheResult] cache hit sql:", sqlStr, args)
+		return entry.Value, nil
+	}
+
+	value, err := query()
+	if err != nil {
+		return nil, err
+	}
+	entry = &resultEntry{Deadline: now.Add(ttl), Value: value}
+	for _, tableName := range tables {
+		cacher.PutIds(tableName, key, entry)
+	}
+	return value, nil
+}
+
+// clearResults evicts the cached results reading the tables written by
+// sqlStr
+func (session *Session) clearResults(sqlStr string) {
+	cacher := session.Engine.getResultCacher(false)
+	if cacher == nil {
+		return
+	}
+	cacher = session.overlay(cacher)
+	for _, tableName := range sqlTables(sqlStr) {
+		session.Engine.logger.Debug("[cacheResult] clear results:", tableName)
+		cacher.ClearIds(tableName)
+	}
+}
+
+// sqlTables returns the names of the tables sqlStr refers to
+func sqlTables(sqlStr string) []string {
+	var tables []string
+	seen := make(map[string]bool)
+	add := func(name string) {
+		name = strings.Trim(name, "`\"[]")
+		if i := strings.LastIndex(name, "."); i >= 0 {
+			name = strings.Trim(name[i+1:], "`\"[]")
+		}
+		if name != "" && !seen[name] {
+			seen[name] = true
+			tables = append(tables, name)
+		}
+	}
+
+	for _, match := range sqlTableRegexp.FindAllStringSubmatchIndex(sqlStr, -1) {
+		add(sqlStr[match[2]:match[3]])
+		rest := sqlStr[match[1]:]
+		for {
+			next := sqlNextTableRegexp.FindStringSubmatchIndex(rest)
+			if next == nil {
+				break
+			}
+			add(rest[next[2]:next[3]])
+			rest = rest[next[1]:]
+		}
+	}
+	return tables
+}
+
+// copyMaps returns a copy of the cached rows, so that the callers could
+// modify them
+func copyMaps(rows []map[string][]byte) []map[string][]byte {
+	copied := make([]map[string][]byte, len(rows))
+	for i, row := range rows {
+		copied[i] = make(map[string][]byte, len(row))
+		for k, v := range row {
+			copied[i][k] = append([]byte(nil), v...)
+		}
+	}
+	return copied
+}
+
+func copyStringMaps(rows []map[string]string) []map[string]string {
+	copied := make([]map[string]string, len(rows))
+	for i, row := range rows {
+		copied[i] = make(map[string]string, len(row))
+		for k, v := range row {
+			copied[i][k] = v
+		}
+	}
+	return copied
+}
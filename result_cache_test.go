@@ -0,0 +1,73 @@
+package xorm
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSqlTables(t *testing.T) {
+	var cases = []struct {
+		sql    string
+		tables []string
+	}{
+		{"SELECT count(*) FROM `user` WHERE (`name`=?)", []string{"user"}},
+		{"SELECT * FROM \"public\".\"user\" u JOIN `group` g ON u.gid = g.id", []string{"user", "group"}},
+		{"select * from user u, team as t, org where u.id = t.uid", []string{"user", "team", "org"}},
+		{"SELECT * FROM (SELECT id FROM [order]) o WHERE o.id IN (1, 2)", []string{"order"}},
+		{"INSERT INTO `user` (`name`) VALUES (?)", []string{"user"}},
+		{"UPDATE user SET from_date = ?", []string{"user"}},
+		{"SELECT 1", nil},
+	}
+
+	for _, kase := range cases {
+		tables := sqlTables(kase.sql)
+		if !sliceEq(tables, kase.tables) {
+			t.Errorf("%s: got %v, expected %v", kase.sql, tables, kase.tables)
+		}
+	}
+}
+
+type ResultUser struct {
+	Id   int64
+	Name string
+}
+
+func TestCacheResultEviction(t *testing.T) {
+	engine := newTestEngine(t)
+	if err := engine.Sync2(new(ResultUser)); err != nil {
+		t.Fatal(err)
+	}
+
+	count := func() int64 {
+		n, err := engine.CacheResult(time.Hour).Count(new(ResultUser))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+	if n := count(); n != 0 {
+		t.Fatalf("got %v records", n)
+	}
+
+	if _, err := engine.Insert(&ResultUser{Name: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	if n := count(); n != 1 {
+		t.Errorf("got %v records after Insert", n)
+	}
+
+	if _, err := engine.Exec("INSERT INTO result_user (name) VALUES ('b')"); err != nil {
+		t.Fatal(err)
+	}
+	if n := count(); n != 2 {
+		t.Errorf("got %v records after Exec", n)
+	}
+
+	// the cached count is returned until a write evicts it
+	if _, err := engine.DB().Exec("INSERT INTO result_user (name) VALUES ('c')"); err != nil {
+		t.Fatal(err)
+	}
+	if n := count(); n != 2 {
+		t.Errorf("got %v records, the result isn't cached", n)
+	}
+}
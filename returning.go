@@ -0,0 +1,188 @@
+// Copyright 2017 The Xorm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xorm
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/go-xorm/core"
+)
+
+// returningDialect is implemented by the dialects which can read back the
+// columns of the records changed by INSERT, UPDATE and DELETE statements
+type returningDialect interface {
+	// ReturningSql adds to sqlStr the clause returning cols of the inserted or
+	// updated records, or of the deleted ones when deleted is true. When
+	// outParams is true, the values are returned through sql.Out parameters
+	// appended to the arguments instead of rows.
+	ReturningSql(sqlStr string, cols []string, deleted bool) (returningSql string, outParams bool)
+}
+
+// returningResult is the result of a statement whose changed records were
+// read back, it's the number of the records
+type returningResult int64
+
+func (r returningResult) LastInsertId() (int64, error) {
+	return 0, errors.New("LastInsertId is not supported with Returning")
+}
+
+func (r returningResult) RowsAffected() (int64, error) {
+	return int64(r), nil
+}
+
+// Returning reads back cols, all the columns by default, of the records
+// changed by Insert, InsertMulti, Update and Delete into the beans. Update
+// and Delete read the first record only.
+func (session *Session) Returning(cols ...string) *Session {
+	session.Statement.returning = true
+	session.Statement.returnColumns = col2NewCols(cols...)
+	return session
+}
+
+// returningCols returns the columns to read back, the autoincrement column
+// is always read back by inserts
+func (session *Session) returningCols(isInsert bool) []string {
+	table := session.Statement.RefTable
+	cols := session.Statement.returnColumns
+	if len(cols) == 0 {
+		for _, col := range table.Columns() {
+			if col.MapType != core.ONLYTODB {
+				cols = append(cols, col.Name)
+			}
+		}
+		return cols
+	}
+
+	if isInsert && table.AutoIncrement != "" {
+		for _, col := range cols {
+			if strings.EqualFold(col, table.AutoIncrement) {
+				return cols
+			}
+		}
+		cols = append([]string{table.AutoIncrement}, cols...)
+	}
+	return cols
+}
+
+// returnsCol tells if the column colName of the changed records is read back
+func (session *Session) returnsCol(colName string) bool {
+	if !session.Statement.returning {
+		return false
+	}
+	if len(session.Statement.returnColumns) == 0 {
+		return true
+	}
+	for _, col := range session.Statement.returnColumns {
+		if strings.EqualFold(col, colName) {
+			return true
+		}
+	}
+	return false
+}
+
+// execReturning executes sqlStr. When Returning is used, the columns of the
+// i-th changed record are set into bean(i), which is nil when they should be
+// ignored.
+func (session *Session) execReturning(sqlStr string, args []interface{}, isInsert, deleted bool, bean func(i int) interface{}) (sql.Result, error) {
+	if !session.Statement.returning {
+		return session.exec(sqlStr, args...)
+	}
+
+	dialect, ok := session.Engine.dialect.(returningDialect)
+	if !ok {
+		return nil, ErrNotImplemented
+	}
+
+	table := session.Statement.RefTable
+	if table == nil {
+		return nil, errors.New("Returning needs a struct bean")
+	}
+	cols := session.returningCols(isInsert)
+	sqlStr, outParams := dialect.ReturningSql(sqlStr, cols, deleted)
+
+	if outParams {
+		scanResults := make([]interface{}, len(cols))
+		outArgs := make([]interface{}, len(args), len(args)+len(cols))
+		copy(outArgs, args)
+		for i := range cols {
+			var cell interface{}
+			scanResults[i] = &cell
+			outArgs = append(outArgs, sql.Out{Dest: &cell})
+		}
+
+		res, err := session.exec(sqlStr, outArgs...)
+		if err != nil {
+			return nil, err
+		}
+		if b := bean(0); b != nil {
+			dataStruct := rValue(b)
+			if err := session.slice2Bean(scanResults, cols, b, &dataStruct, table); err != nil {
+				return nil, err
+			}
+		}
+		return res, nil
+	}
+
+	rows, err := session.queryRows(sqlStr, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	fields, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	var count int64
+	for ; rows.Next(); count++ {
+		b := bean(int(count))
+		if b == nil {
+			continue
+		}
+		dataStruct := rValue(b)
+		if err := session._row2Bean(rows, fields, len(fields), b, &dataStruct, table); err != nil {
+			return nil, err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	session.clearResults(sqlStr)
+	return returningResult(count), nil
+}
+
+// queryRows queries sqlStr in the session's transaction if there is one
+func (session *Session) queryRows(sqlStr string, args ...interface{}) (*core.Rows, error) {
+	session.queryPreprocess(&sqlStr, args...)
+
+	if session.IsAutoCommit {
+		_, rows, err := session.innerQuery(sqlStr, args...)
+		return rows, err
+	}
+	return session.Tx.QueryContext(session.ctx, sqlStr, args...)
+}
+
+// returningClause returns the RETURNING clause of postgres and sqlite
+func returningClause(dialect core.Dialect, cols []string) string {
+	return " RETURNING " + quoteColumns(dialect, cols)
+}
+
+// outputClause returns the OUTPUT clause of mssql, which reads the inserted
+// or the deleted pseudo table
+func outputClause(dialect core.Dialect, cols []string, deleted bool) string {
+	pseudo := "INSERTED"
+	if deleted {
+		pseudo = "DELETED"
+	}
+	outputs := make([]string, 0, len(cols))
+	for _, col := range cols {
+		outputs = append(outputs, fmt.Sprintf("%s.%s", pseudo, dialect.Quote(col)))
+	}
+	return " OUTPUT " + strings.Join(outputs, ", ")
+}
@@ -0,0 +1,41 @@
+package xorm
+
+import (
+	"testing"
+)
+
+type ReturningVersion struct {
+	Id      int64
+	Name    string
+	Version int `xorm:"version"`
+}
+
+func TestUpdateReturningVersion(t *testing.T) {
+	engine := newTestEngine(t)
+	if err := engine.Sync2(new(ReturningVersion)); err != nil {
+		t.Fatal(err)
+	}
+	record := &ReturningVersion{Name: "a"}
+	if _, err := engine.Insert(record); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, cols := range [][]string{{"version"}, nil, {"name"}} {
+		version := record.Version
+		record.Name += "a"
+		if _, err := engine.Id(record.Id).Returning(cols...).Update(record); err != nil {
+			t.Fatal(err)
+		}
+		if record.Version != version+1 {
+			t.Errorf("returning %v the version went from %v to %v", cols, version, record.Version)
+		}
+	}
+
+	var got ReturningVersion
+	if _, err := engine.Id(record.Id).Get(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Version != record.Version || got.Name != "aaaa" {
+		t.Errorf("got %+v, the bean is %+v", got, record)
+	}
+}
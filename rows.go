@@ -51,29 +51,24 @@ func newRows(session *Session, bean interface{}) (*Rows, error) {
 		sqlStr = filter.Do(sqlStr, session.Engine.dialect, rows.session.Statement.RefTable)
 	}
 
-	rows.session.saveLastSQL(sqlStr, args)
+	rows.session.saveLastSQL(sqlStr, args...)
 	var err error
-	if rows.session.prepareStmt {
-		rows.stmt, err = rows.session.DB().Prepare(sqlStr)
-		if err != nil {
-			rows.lastError = err
-			rows.Close()
-			return nil, err
+	rows.stmt, rows.rows, err = session.Engine.logSQLQueryTime(rows.session.takeSQLLog(), func() (*core.Stmt, *core.Rows, error) {
+		if !rows.session.prepareStmt {
+			r, err := rows.session.DB().QueryContext(rows.session.ctx, sqlStr, args...)
+			return nil, r, err
 		}
-
-		rows.rows, err = rows.stmt.Query(args...)
-		if err != nil {
-			rows.lastError = err
-			rows.Close()
-			return nil, err
-		}
-	} else {
-		rows.rows, err = rows.session.DB().Query(sqlStr, args...)
+		stmt, err := rows.session.DB().PrepareContext(rows.session.ctx, sqlStr)
 		if err != nil {
-			rows.lastError = err
-			rows.Close()
-			return nil, err
+			return nil, nil, err
 		}
+		r, err := stmt.QueryContext(rows.session.ctx, args...)
+		return stmt, r, err
+	})
+	if err != nil {
+		rows.lastError = err
+		rows.Close()
+		return nil, err
 	}
 
 	rows.fields, err = rows.rows.Columns()
@@ -92,7 +87,9 @@ func (rows *Rows) Next() bool {
 	if rows.lastError == nil && rows.rows != nil {
 		hasNext := rows.rows.Next()
 		if !hasNext {
-			rows.lastError = sql.ErrNoRows
+			if rows.lastError = rows.rows.Err(); rows.lastError == nil {
+				rows.lastError = sql.ErrNoRows
+			}
 		}
 		return hasNext
 	}
@@ -5,6 +5,7 @@
 package xorm
 
 import (
+	"context"
 	"database/sql"
 	"database/sql/driver"
 	"encoding/json"
@@ -24,6 +25,7 @@ import (
 // kind of database operations.
 type Session struct {
 	db                     *core.DB
+	ctx                    context.Context
 	Engine                 *Engine
 	Tx                     *core.Tx
 	Statement              Statement
@@ -42,6 +44,18 @@ type Session struct {
 	afterDeleteBeans map[interface{}]*[]func(interface{})
 	// --
 
+	// savepoints of the nested transactions, the last one is the innermost
+	savepoints []*savepoint
+	// cache overlays of the transaction, by engine's cacher
+	txCachers map[core.Cacher]*txCacher
+	// statements resetting the options of the transaction before it ends
+	txResetSqls []string
+	// group is the engine group the session was created by, if any
+	group *EngineGroup
+	// replica is the db of the replica of the engine group the session
+	// reads from
+	replica *core.DB
+
 	beforeClosures []func(interface{})
 	afterClosures  []func(interface{})
 
@@ -53,8 +67,17 @@ type Session struct {
 	//beforeSQLExec func(string, ...interface{})
 	lastSQL     string
 	lastSQLArgs []interface{}
+
+	// id identifies the session in the logs
+	id int64
+	// sqlLog is the log of the last statement when ShowExecTime is on, until
+	// the session times it or runs another one
+	sqlLog *LogContext
 }
 
+// sessionIDs is the id of the last session
+var sessionIDs int64
+
 // Clone copy all the session's content and return a new session
 func (session *Session) Clone() *Session {
 	var sess = *session
@@ -70,6 +93,7 @@ func (session *Session) Init() {
 	session.IsAutoClose = false
 	session.AutoResetStatement = true
 	session.prepareStmt = false
+	session.ctx = context.Background()
 
 	// !nashtsai! is lazy init better?
 	session.afterInsertBeans = make(map[interface{}]*[]func(interface{}), 0)
@@ -77,6 +101,8 @@ func (session *Session) Init() {
 	session.afterDeleteBeans = make(map[interface{}]*[]func(interface{}), 0)
 	session.beforeClosures = make([]func(interface{}), 0)
 	session.afterClosures = make([]func(interface{}), 0)
+	session.savepoints = nil
+	session.txCachers = nil
 
 	session.lastSQL = ""
 	session.lastSQLArgs = []interface{}{}
@@ -84,6 +110,7 @@ func (session *Session) Init() {
 
 // Close release the connection from pool
 func (session *Session) Close() {
+	session.flushSQLLog()
 	for _, v := range session.stmtCache {
 		v.Close()
 	}
@@ -92,6 +119,7 @@ func (session *Session) Close() {
 		// When Close be called, if session is a transaction and do not call
 		// Commit or Rollback, then call Rollback.
 		if session.Tx != nil && !session.IsCommitedOrRollbacked {
+			session.savepoints = nil
 			session.Rollback()
 		}
 		session.Tx = nil
@@ -102,11 +130,23 @@ func (session *Session) Close() {
 }
 
 func (session *Session) resetStatement() {
+	session.flushSQLLog()
 	if session.AutoResetStatement {
 		session.Statement.Init()
 	}
 }
 
+// Context sets the context.Context used by all the queries, executions and
+// transactions of this session. When ctx is cancelled or its deadline
+// exceeded, the in-flight statement is aborted and ctx.Err() is returned.
+func (session *Session) Context(ctx context.Context) *Session {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	session.ctx = ctx
+	return session
+}
+
 // Prepare set a flag to session that should be prepare statment before execute query
 func (session *Session) Prepare() *Session {
 	session.prepareStmt = true
@@ -287,6 +327,12 @@ func (session *Session) NoAutoTime() *Session {
 	return session
 }
 
+// DoNothing makes Upsert keep the existing record instead of updating it
+func (session *Session) DoNothing() *Session {
+	session.Statement.doNothing = true
+	return session
+}
+
 // NoAutoCondition disable generate SQL condition from beans
 func (session *Session) NoAutoCondition(no ...bool) *Session {
 	session.Statement.NoAutoCondition(no...)
@@ -369,20 +415,109 @@ func (session *Session) DB() *core.DB {
 		session.db = session.Engine.db
 		session.stmtCache = make(map[uint32]*core.Stmt, 0)
 	}
+	if session.replica != nil {
+		return session.replica
+	}
 	return session.db
 }
 
-// Begin a transaction
+// Begin a transaction. When the session is already in a transaction, Begin
+// starts a nested transaction by setting a savepoint, the matching Commit and
+// Rollback then only release or roll back to this savepoint.
 func (session *Session) Begin() error {
 	if session.IsAutoCommit {
-		tx, err := session.DB().Begin()
-		if err != nil {
+		return session.begin(nil)
+	} else if !session.IsCommitedOrRollbacked {
+		return session.beginSavepoint()
+	}
+	return nil
+}
+
+// TxOptions holds the isolation level and the read-only flag of a transaction
+type TxOptions struct {
+	Isolation sql.IsolationLevel
+	ReadOnly  bool
+}
+
+// txOptionsDialect is implemented by the dialects whose drivers may not support
+// sql.TxOptions, the options are then applied by statements run after BEGIN.
+// When no statement is returned, the options are given to the driver.
+type txOptionsDialect interface {
+	SetTransactionSqls(isolation sql.IsolationLevel, readOnly bool) ([]string, error)
+}
+
+// txOptionsResetter is implemented by the txOptionsDialect dialects whose
+// statements set the options of the connection instead of the transaction.
+// They are reset before the transaction ends, since the connection then goes
+// back to the pool.
+type txOptionsResetter interface {
+	ResetTransactionSqls() []string
+}
+
+// BeginTx begins a transaction with the isolation level and read-only flag of
+// opts. Like Begin, it starts a nested transaction when the session is
+// already in one, but then the options are ignored since they can only be set
+// for the outermost transaction.
+func (session *Session) BeginTx(opts TxOptions) error {
+	if session.IsAutoCommit {
+		return session.begin(&opts)
+	} else if !session.IsCommitedOrRollbacked {
+		return session.beginSavepoint()
+	}
+	return nil
+}
+
+func (session *Session) begin(opts *TxOptions) error {
+	var txOpts *sql.TxOptions
+	var sqls []string
+	if opts != nil {
+		if d, ok := session.Engine.dialect.(txOptionsDialect); ok {
+			var err error
+			sqls, err = d.SetTransactionSqls(opts.Isolation, opts.ReadOnly)
+			if err != nil {
+				return err
+			}
+		}
+		if sqls == nil {
+			txOpts = &sql.TxOptions{Isolation: opts.Isolation, ReadOnly: opts.ReadOnly}
+		}
+	}
+
+	tx, err := session.DB().BeginTx(session.ctx, txOpts)
+	if err != nil {
+		return err
+	}
+	session.saveLastSQL("BEGIN TRANSACTION")
+
+	for _, sqlStr := range sqls {
+		session.saveLastSQL(sqlStr)
+		if _, err = tx.ExecContext(session.ctx, sqlStr); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	session.IsAutoCommit = false
+	session.IsCommitedOrRollbacked = false
+	session.Tx = tx
+	session.txCachers = nil
+	session.txResetSqls = nil
+	if r, ok := session.Engine.dialect.(txOptionsResetter); ok && len(sqls) > 0 {
+		session.txResetSqls = r.ResetTransactionSqls()
+	}
+	return nil
+}
+
+// resetTxOptions runs the statements resetting the options of the
+// transaction, before it's committed or rolled back
+func (session *Session) resetTxOptions() error {
+	sqls := session.txResetSqls
+	session.txResetSqls = nil
+	for _, sqlStr := range sqls {
+		session.saveLastSQL(sqlStr)
+		if _, err := session.Tx.ExecContext(session.ctx, sqlStr); err != nil {
 			return err
 		}
-		session.IsAutoCommit = false
-		session.IsCommitedOrRollbacked = false
-		session.Tx = tx
-		session.saveLastSQL("BEGIN TRANSACTION")
 	}
 	return nil
 }
@@ -390,9 +525,17 @@ func (session *Session) Begin() error {
 // Rollback When using transaction, you can rollback if any error
 func (session *Session) Rollback() error {
 	if !session.IsAutoCommit && !session.IsCommitedOrRollbacked {
+		if len(session.savepoints) > 0 {
+			return session.rollbackSavepoint()
+		}
+		resetErr := session.resetTxOptions()
 		session.saveLastSQL(session.Engine.dialect.RollBackStr())
 		session.IsCommitedOrRollbacked = true
-		return session.Tx.Rollback()
+		session.txCachers = nil
+		if err := session.Tx.Rollback(); err != nil {
+			return err
+		}
+		return resetErr
 	}
 	return nil
 }
@@ -400,10 +543,21 @@ func (session *Session) Rollback() error {
 // Commit When using transaction, Commit will commit all operations.
 func (session *Session) Commit() error {
 	if !session.IsAutoCommit && !session.IsCommitedOrRollbacked {
+		if len(session.savepoints) > 0 {
+			return session.releaseSavepoint()
+		}
+		if err := session.resetTxOptions(); err != nil {
+			return err
+		}
 		session.saveLastSQL("COMMIT")
 		session.IsCommitedOrRollbacked = true
 		var err error
 		if err = session.Tx.Commit(); err == nil {
+			for _, c := range session.txCachers {
+				c.commit()
+			}
+			session.txCachers = nil
+
 			// handle processors after tx committed
 
 			closureCallFunc := func(closuresPtr *[]func(interface{}), bean interface{}) {
@@ -450,6 +604,119 @@ func (session *Session) Commit() error {
 	return nil
 }
 
+// savepoint keeps the after processors' beans of the outer transaction while a
+// nested one is running
+type savepoint struct {
+	name             string
+	afterInsertBeans map[interface{}]*[]func(interface{})
+	afterUpdateBeans map[interface{}]*[]func(interface{})
+	afterDeleteBeans map[interface{}]*[]func(interface{})
+	cacheMarks       map[core.Cacher]int
+}
+
+// savepointDialect is implemented by the dialects which don't use the
+// standard SAVEPOINT statements. An empty release SQL means the dialect has no
+// statement to release a savepoint.
+type savepointDialect interface {
+	SavepointSql(name string) string
+	ReleaseSavepointSql(name string) string
+	RollbackToSavepointSql(name string) string
+}
+
+func (session *Session) savepointSQL(name string) string {
+	if d, ok := session.Engine.dialect.(savepointDialect); ok {
+		return d.SavepointSql(name)
+	}
+	return "SAVEPOINT " + name
+}
+
+func (session *Session) releaseSavepointSQL(name string) string {
+	if d, ok := session.Engine.dialect.(savepointDialect); ok {
+		return d.ReleaseSavepointSql(name)
+	}
+	return "RELEASE SAVEPOINT " + name
+}
+
+func (session *Session) rollbackToSavepointSQL(name string) string {
+	if d, ok := session.Engine.dialect.(savepointDialect); ok {
+		return d.RollbackToSavepointSql(name)
+	}
+	return "ROLLBACK TO SAVEPOINT " + name
+}
+
+func (session *Session) execSavepointSQL(sqlStr string) error {
+	if sqlStr == "" {
+		return nil
+	}
+	session.saveLastSQL(sqlStr)
+	_, err := session.Tx.ExecContext(session.ctx, sqlStr)
+	return err
+}
+
+func (session *Session) beginSavepoint() error {
+	sp := &savepoint{
+		name:             fmt.Sprintf("xorm_sp_%d", len(session.savepoints)+1),
+		afterInsertBeans: session.afterInsertBeans,
+		afterUpdateBeans: session.afterUpdateBeans,
+		afterDeleteBeans: session.afterDeleteBeans,
+		cacheMarks:       session.cacheMarks(),
+	}
+	if err := session.execSavepointSQL(session.savepointSQL(sp.name)); err != nil {
+		return err
+	}
+
+	session.savepoints = append(session.savepoints, sp)
+	session.afterInsertBeans = make(map[interface{}]*[]func(interface{}), 0)
+	session.afterUpdateBeans = make(map[interface{}]*[]func(interface{}), 0)
+	session.afterDeleteBeans = make(map[interface{}]*[]func(interface{}), 0)
+	return nil
+}
+
+// releaseSavepoint ends the innermost nested transaction, its after
+// processors are deferred until the outer transaction is committed.
+func (session *Session) releaseSavepoint() error {
+	sp := session.savepoints[len(session.savepoints)-1]
+	if err := session.execSavepointSQL(session.releaseSavepointSQL(sp.name)); err != nil {
+		return err
+	}
+	session.savepoints = session.savepoints[:len(session.savepoints)-1]
+
+	mergeFunc := func(outer, inner map[interface{}]*[]func(interface{})) map[interface{}]*[]func(interface{}) {
+		for bean, closuresPtr := range inner {
+			if outerPtr, has := outer[bean]; has && outerPtr != nil {
+				if closuresPtr != nil {
+					*outerPtr = append(*outerPtr, *closuresPtr...)
+				}
+			} else {
+				outer[bean] = closuresPtr
+			}
+		}
+		return outer
+	}
+	session.afterInsertBeans = mergeFunc(sp.afterInsertBeans, session.afterInsertBeans)
+	session.afterUpdateBeans = mergeFunc(sp.afterUpdateBeans, session.afterUpdateBeans)
+	session.afterDeleteBeans = mergeFunc(sp.afterDeleteBeans, session.afterDeleteBeans)
+	return nil
+}
+
+// rollbackSavepoint undoes the innermost nested transaction, its after
+// processors will never be called.
+func (session *Session) rollbackSavepoint() error {
+	sp := session.savepoints[len(session.savepoints)-1]
+	if err := session.execSavepointSQL(session.rollbackToSavepointSQL(sp.name)); err != nil {
+		return err
+	}
+	session.savepoints = session.savepoints[:len(session.savepoints)-1]
+
+	session.afterInsertBeans = sp.afterInsertBeans
+	session.afterUpdateBeans = sp.afterUpdateBeans
+	session.afterDeleteBeans = sp.afterDeleteBeans
+	for cacher, c := range session.txCachers {
+		c.rollbackTo(sp.cacheMarks[cacher])
+	}
+	return nil
+}
+
 func cleanupProcessorsClosures(slices *[]func(interface{})) {
 	if len(*slices) > 0 {
 		*slices = make([]func(interface{}), 0)
@@ -510,14 +777,14 @@ func (session *Session) innerExec(sqlStr string, args ...interface{}) (sql.Resul
 			return nil, err
 		}
 
-		res, err := stmt.Exec(args...)
+		res, err := stmt.ExecContext(session.ctx, args...)
 		if err != nil {
 			return nil, err
 		}
 		return res, nil
 	}
 
-	return session.DB().Exec(sqlStr, args...)
+	return session.DB().ExecContext(session.ctx, sqlStr, args...)
 }
 
 func (session *Session) exec(sqlStr string, args ...interface{}) (sql.Result, error) {
@@ -528,19 +795,23 @@ func (session *Session) exec(sqlStr string, args ...interface{}) (sql.Result, er
 
 	session.saveLastSQL(sqlStr, args...)
 
-	return session.Engine.logSQLExecutionTime(sqlStr, args, func() (sql.Result, error) {
+	res, err := session.Engine.logSQLExecutionTime(session.takeSQLLog(), func() (sql.Result, error) {
 		if session.IsAutoCommit {
 			// FIXME: oci8 can not auto commit (github.com/mattn/go-oci8)
 			if session.Engine.dialect.DBType() == core.ORACLE {
 				session.Begin()
-				r, err := session.Tx.Exec(sqlStr, args...)
+				r, err := session.Tx.ExecContext(session.ctx, sqlStr, args...)
 				session.Commit()
 				return r, err
 			}
 			return session.innerExec(sqlStr, args...)
 		}
-		return session.Tx.Exec(sqlStr, args...)
+		return session.Tx.ExecContext(session.ctx, sqlStr, args...)
 	})
+	if err == nil {
+		session.clearResults(sqlStr)
+	}
+	return res, err
 }
 
 // Exec raw sql
@@ -557,6 +828,7 @@ func (session *Session) Exec(sqlStr string, args ...interface{}) (sql.Result, er
 func (session *Session) CreateTable(bean interface{}) error {
 	v := rValue(bean)
 	session.Statement.setRefValue(v)
+	session.Statement.resolveTableName(bean, "sync")
 
 	defer session.resetStatement()
 	if session.IsAutoClose {
@@ -570,6 +842,7 @@ func (session *Session) CreateTable(bean interface{}) error {
 func (session *Session) CreateIndexes(bean interface{}) error {
 	v := rValue(bean)
 	session.Statement.setRefValue(v)
+	session.Statement.resolveTableName(bean, "sync")
 
 	defer session.resetStatement()
 	if session.IsAutoClose {
@@ -590,6 +863,7 @@ func (session *Session) CreateIndexes(bean interface{}) error {
 func (session *Session) CreateUniques(bean interface{}) error {
 	v := rValue(bean)
 	session.Statement.setRefValue(v)
+	session.Statement.resolveTableName(bean, "sync")
 
 	defer session.resetStatement()
 	if session.IsAutoClose {
@@ -609,7 +883,15 @@ func (session *Session) CreateUniques(bean interface{}) error {
 func (session *Session) createOneTable() error {
 	sqlStr := session.Statement.genCreateTableSQL()
 	_, err := session.exec(sqlStr)
-	return err
+	if err != nil {
+		return err
+	}
+	for _, sqlStr = range session.Statement.genCommentSQL() {
+		if _, err = session.exec(sqlStr); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // to be deleted
@@ -634,6 +916,7 @@ func (session *Session) createAll() error {
 func (session *Session) DropIndexes(bean interface{}) error {
 	v := rValue(bean)
 	session.Statement.setRefValue(v)
+	session.Statement.resolveTableName(bean, "sync")
 
 	defer session.resetStatement()
 	if session.IsAutoClose {
@@ -679,8 +962,8 @@ func (session *Session) canCache() bool {
 	if session.Statement.RefTable == nil ||
 		session.Statement.JoinStr != "" ||
 		session.Statement.RawSQL != "" ||
-		session.Tx != nil ||
-		len(session.Statement.selectStr) > 0 {
+		len(session.Statement.selectStr) > 0 ||
+		len(session.Statement.partitions) > 0 {
 		return false
 	}
 	return true
@@ -700,14 +983,22 @@ func (session *Session) cacheGet(bean interface{}, sqlStr string, args ...interf
 		return false, ErrCacheFailed
 	}
 
-	cacher := session.Engine.getCacher2(session.Statement.RefTable)
+	cacher := session.getCacher(session.Statement.RefTable)
 	tableName := session.Statement.TableName()
+	hit := true
+	defer func() {
+		if err == nil {
+			session.observeCache(tableName, "get", hit)
+		}
+	}()
+
 	session.Engine.logger.Debug("[cacheGet] find sql:", newsql, args)
 	ids, err := core.GetCacheSql(cacher, tableName, newsql, args)
 	table := session.Statement.RefTable
 	if err != nil {
+		hit = false
 		var res = make([]string, len(table.PrimaryKeys))
-		rows, err := session.DB().Query(newsql, args...)
+		rows, err := session.rawQuery(newsql, args...)
 		if err != nil {
 			return false, err
 		}
@@ -739,7 +1030,7 @@ func (session *Session) cacheGet(bean interface{}, sqlStr string, args ...interf
 
 		ids = []core.PK{pk}
 		session.Engine.logger.Debug("[cacheGet] cache ids:", newsql, ids)
-		err = core.PutCacheSql(cacher, ids, tableName, newsql, args)
+		err = session.putCacheIds(cacher, ids, tableName, newsql, args)
 		if err != nil {
 			return false, err
 		}
@@ -757,13 +1048,11 @@ func (session *Session) cacheGet(bean interface{}, sqlStr string, args ...interf
 		}
 		cacheBean := cacher.GetBean(tableName, sid)
 		if cacheBean == nil {
-			newSession := session.Engine.NewSession()
-			defer newSession.Close()
+			hit = false
+			newSession, release := session.newCacheSession()
+			defer release()
 			cacheBean = reflect.New(structValue.Type()).Interface()
-			newSession.Id(id).NoCache()
-			if session.Statement.AltTableName != "" {
-				newSession.Table(session.Statement.AltTableName)
-			}
+			newSession.Id(id).NoCache().Table(tableName)
 			if !session.Statement.UseCascade {
 				newSession.NoCascade()
 			}
@@ -804,10 +1093,18 @@ func (session *Session) cacheFind(t reflect.Type, sqlStr string, rowsSlicePtr in
 	tableName := session.Statement.TableName()
 
 	table := session.Statement.RefTable
-	cacher := session.Engine.getCacher2(table)
+	cacher := session.getCacher(table)
+	hit := true
+	defer func() {
+		if err == nil {
+			session.observeCache(tableName, "find", hit)
+		}
+	}()
+
 	ids, err := core.GetCacheSql(cacher, tableName, newsql, args)
 	if err != nil {
-		rows, err := session.DB().Query(newsql, args...)
+		hit = false
+		rows, err := session.rawQuery(newsql, args...)
 		if err != nil {
 			return err
 		}
@@ -846,7 +1143,7 @@ func (session *Session) cacheFind(t reflect.Type, sqlStr string, rowsSlicePtr in
 		}
 
 		session.Engine.logger.Debug("[cacheFind] cache sql:", ids, tableName, newsql, args)
-		err = core.PutCacheSql(cacher, ids, tableName, newsql, args)
+		err = session.putCacheIds(cacher, ids, tableName, newsql, args)
 		if err != nil {
 			return err
 		}
@@ -887,8 +1184,9 @@ func (session *Session) cacheFind(t reflect.Type, sqlStr string, rowsSlicePtr in
 	}
 
 	if len(ides) > 0 {
-		newSession := session.Engine.NewSession()
-		defer newSession.Close()
+		hit = false
+		newSession, release := session.newCacheSession()
+		defer release()
 
 		slices := reflect.New(reflect.SliceOf(t))
 		beans := slices.Interface()
@@ -910,7 +1208,7 @@ func (session *Session) cacheFind(t reflect.Type, sqlStr string, rowsSlicePtr in
 			}
 		}
 
-		err = newSession.NoCache().Find(beans)
+		err = newSession.NoCache().Table(tableName).Find(beans)
 		if err != nil {
 			return err
 		}
@@ -974,12 +1272,26 @@ func (session *Session) cacheFind(t reflect.Type, sqlStr string, rowsSlicePtr in
 	return nil
 }
 
+// observeCache notifies the engine's CacheObserver of a cache lookup
+func (session *Session) observeCache(tableName, op string, hit bool) {
+	observer := session.Engine.cacheObserver
+	if observer == nil {
+		return
+	}
+	if hit {
+		observer.CacheHit(tableName, op)
+	} else {
+		observer.CacheMiss(tableName, op)
+	}
+}
+
 // IterFunc only use by Iterate
 type IterFunc func(idx int, bean interface{}) error
 
 // Rows return sql.Rows compatible Rows obj, as a forward Iterator object for iterating record by record, bean's non-empty fields
 // are conditions.
 func (session *Session) Rows(bean interface{}) (*Rows, error) {
+	defer session.readReplica(session.Statement.RawSQL)()
 	return newRows(session, bean)
 }
 
@@ -1006,7 +1318,10 @@ func (session *Session) Iterate(bean interface{}, fun IterFunc) error {
 		}
 		i++
 	}
-	return err
+	if err = rows.Err(); err != sql.ErrNoRows {
+		return err
+	}
+	return nil
 }
 
 func (session *Session) doPrepare(sqlStr string) (stmt *core.Stmt, err error) {
@@ -1015,7 +1330,7 @@ func (session *Session) doPrepare(sqlStr string) (stmt *core.Stmt, err error) {
 	var has bool
 	stmt, has = session.stmtCache[crc]
 	if !has {
-		stmt, err = session.DB().Prepare(sqlStr)
+		stmt, err = session.DB().PrepareContext(session.ctx, sqlStr)
 		if err != nil {
 			return nil, err
 		}
@@ -1031,8 +1346,10 @@ func (session *Session) Get(bean interface{}) (bool, error) {
 	if session.IsAutoClose {
 		defer session.Close()
 	}
+	defer session.readReplica(session.Statement.RawSQL)()
 
 	session.Statement.setRefValue(rValue(bean))
+	session.Statement.resolveTableName(bean, "get")
 
 	var sqlStr string
 	var args []interface{}
@@ -1049,7 +1366,7 @@ func (session *Session) Get(bean interface{}) (bool, error) {
 	}
 
 	if session.Statement.JoinStr == "" {
-		if cacher := session.Engine.getCacher2(session.Statement.RefTable); cacher != nil &&
+		if cacher := session.getCacher(session.Statement.RefTable); cacher != nil &&
 			session.Statement.UseCache &&
 			!session.Statement.unscoped {
 			has, err := session.cacheGet(bean, sqlStr, args...)
@@ -1065,7 +1382,7 @@ func (session *Session) Get(bean interface{}) (bool, error) {
 	if session.IsAutoCommit {
 		_, rawRows, err = session.innerQuery(sqlStr, args...)
 	} else {
-		rawRows, err = session.Tx.Query(sqlStr, args...)
+		rawRows, err = session.Tx.QueryContext(session.ctx, sqlStr, args...)
 	}
 	if err != nil {
 		return false, err
@@ -1089,6 +1406,7 @@ func (session *Session) Count(bean interface{}) (int64, error) {
 	if session.IsAutoClose {
 		defer session.Close()
 	}
+	defer session.readReplica(session.Statement.RawSQL)()
 
 	var sqlStr string
 	var args []interface{}
@@ -1101,18 +1419,21 @@ func (session *Session) Count(bean interface{}) (int64, error) {
 
 	session.queryPreprocess(&sqlStr, args...)
 
-	var err error
-	var total int64
-	if session.IsAutoCommit {
-		err = session.DB().QueryRow(sqlStr, args...).Scan(&total)
-	} else {
-		err = session.Tx.QueryRow(sqlStr, args...).Scan(&total)
-	}
+	res, err := session.cachedResult("count", sqlStr, args, func() (interface{}, error) {
+		var err error
+		var total int64
+		if session.IsAutoCommit {
+			err = session.DB().QueryRowContext(session.ctx, sqlStr, args...).Scan(&total)
+		} else {
+			err = session.Tx.QueryRowContext(session.ctx, sqlStr, args...).Scan(&total)
+		}
+		return total, err
+	})
 	if err != nil {
 		return 0, err
 	}
 
-	return total, nil
+	return res.(int64), nil
 }
 
 // Sum call sum some column. bean's non-empty fields are conditions.
@@ -1121,6 +1442,7 @@ func (session *Session) Sum(bean interface{}, columnName string) (float64, error
 	if session.IsAutoClose {
 		defer session.Close()
 	}
+	defer session.readReplica(session.Statement.RawSQL)()
 
 	var sqlStr string
 	var args []interface{}
@@ -1133,18 +1455,21 @@ func (session *Session) Sum(bean interface{}, columnName string) (float64, error
 
 	session.queryPreprocess(&sqlStr, args...)
 
-	var err error
-	var res float64
-	if session.IsAutoCommit {
-		err = session.DB().QueryRow(sqlStr, args...).Scan(&res)
-	} else {
-		err = session.Tx.QueryRow(sqlStr, args...).Scan(&res)
-	}
+	res, err := session.cachedResult("sum", sqlStr, args, func() (interface{}, error) {
+		var err error
+		var res float64
+		if session.IsAutoCommit {
+			err = session.DB().QueryRowContext(session.ctx, sqlStr, args...).Scan(&res)
+		} else {
+			err = session.Tx.QueryRowContext(session.ctx, sqlStr, args...).Scan(&res)
+		}
+		return res, err
+	})
 	if err != nil {
 		return 0, err
 	}
 
-	return res, nil
+	return res.(float64), nil
 }
 
 // Sums call sum some columns. bean's non-empty fields are conditions.
@@ -1153,6 +1478,7 @@ func (session *Session) Sums(bean interface{}, columnNames ...string) ([]float64
 	if session.IsAutoClose {
 		defer session.Close()
 	}
+	defer session.readReplica(session.Statement.RawSQL)()
 
 	var sqlStr string
 	var args []interface{}
@@ -1165,18 +1491,23 @@ func (session *Session) Sums(bean interface{}, columnNames ...string) ([]float64
 
 	session.queryPreprocess(&sqlStr, args...)
 
-	var err error
-	var res = make([]float64, len(columnNames), len(columnNames))
-	if session.IsAutoCommit {
-		err = session.DB().QueryRow(sqlStr, args...).ScanSlice(&res)
-	} else {
-		err = session.Tx.QueryRow(sqlStr, args...).ScanSlice(&res)
-	}
+	res, err := session.cachedResult("sums", sqlStr, args, func() (interface{}, error) {
+		var err error
+		var res = make([]float64, len(columnNames), len(columnNames))
+		if session.IsAutoCommit {
+			err = session.DB().QueryRowContext(session.ctx, sqlStr, args...).ScanSlice(&res)
+		} else {
+			err = session.Tx.QueryRowContext(session.ctx, sqlStr, args...).ScanSlice(&res)
+		}
+		return res, err
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	return res, nil
+	sums := make([]float64, len(res.([]float64)))
+	copy(sums, res.([]float64))
+	return sums, nil
 }
 
 // SumsInt sum specify columns and return as []int64 instead of []float64
@@ -1185,6 +1516,7 @@ func (session *Session) SumsInt(bean interface{}, columnNames ...string) ([]int6
 	if session.IsAutoClose {
 		defer session.Close()
 	}
+	defer session.readReplica(session.Statement.RawSQL)()
 
 	var sqlStr string
 	var args []interface{}
@@ -1197,18 +1529,23 @@ func (session *Session) SumsInt(bean interface{}, columnNames ...string) ([]int6
 
 	session.queryPreprocess(&sqlStr, args...)
 
-	var err error
-	var res = make([]int64, 0, len(columnNames))
-	if session.IsAutoCommit {
-		err = session.DB().QueryRow(sqlStr, args...).ScanSlice(&res)
-	} else {
-		err = session.Tx.QueryRow(sqlStr, args...).ScanSlice(&res)
-	}
+	res, err := session.cachedResult("sumsint", sqlStr, args, func() (interface{}, error) {
+		var err error
+		var res = make([]int64, 0, len(columnNames))
+		if session.IsAutoCommit {
+			err = session.DB().QueryRowContext(session.ctx, sqlStr, args...).ScanSlice(&res)
+		} else {
+			err = session.Tx.QueryRowContext(session.ctx, sqlStr, args...).ScanSlice(&res)
+		}
+		return res, err
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	return res, nil
+	sums := make([]int64, len(res.([]int64)))
+	copy(sums, res.([]int64))
+	return sums, nil
 }
 
 // Find retrieve records from table, condiBeans's non-empty fields
@@ -1219,6 +1556,7 @@ func (session *Session) Find(rowsSlicePtr interface{}, condiBean ...interface{})
 	if session.IsAutoClose {
 		defer session.Close()
 	}
+	defer session.readReplica(session.Statement.RawSQL)()
 
 	sliceValue := reflect.Indirect(reflect.ValueOf(rowsSlicePtr))
 	if sliceValue.Kind() != reflect.Slice && sliceValue.Kind() != reflect.Map {
@@ -1232,12 +1570,14 @@ func (session *Session) Find(rowsSlicePtr interface{}, condiBean ...interface{})
 			if sliceElementType.Elem().Kind() == reflect.Struct {
 				pv := reflect.New(sliceElementType.Elem())
 				session.Statement.setRefValue(pv.Elem())
+				session.resolveFindTable(pv.Interface(), condiBean)
 			} else {
 				return errors.New("slice type")
 			}
 		} else if sliceElementType.Kind() == reflect.Struct {
 			pv := reflect.New(sliceElementType)
 			session.Statement.setRefValue(pv.Elem())
+			session.resolveFindTable(pv.Interface(), condiBean)
 		} else {
 			return errors.New("slice type")
 		}
@@ -1315,7 +1655,7 @@ func (session *Session) Find(rowsSlicePtr interface{}, condiBean ...interface{})
 
 	var err error
 	if session.Statement.JoinStr == "" {
-		if cacher := session.Engine.getCacher2(table); cacher != nil &&
+		if cacher := session.getCacher(table); cacher != nil &&
 			session.Statement.UseCache &&
 			!session.Statement.IsDistinct &&
 			!session.Statement.unscoped {
@@ -1335,7 +1675,7 @@ func (session *Session) Find(rowsSlicePtr interface{}, condiBean ...interface{})
 		if session.IsAutoCommit {
 			_, rawRows, err = session.innerQuery(sqlStr, args...)
 		} else {
-			rawRows, err = session.Tx.Query(sqlStr, args...)
+			rawRows, err = session.Tx.QueryContext(session.ctx, sqlStr, args...)
 		}
 		if err != nil {
 			return err
@@ -1439,7 +1779,7 @@ func (session *Session) Ping() error {
 		defer session.Close()
 	}
 
-	return session.DB().Ping()
+	return session.DB().PingContext(session.ctx)
 }
 
 // IsTableExist if a table is exist
@@ -1484,7 +1824,7 @@ func (session *Session) isTableEmpty(tableName string) (bool, error) {
 
 	var total int64
 	sql := fmt.Sprintf("select count(*) from %s", session.Engine.Quote(tableName))
-	err := session.DB().QueryRow(sql).Scan(&total)
+	err := session.DB().QueryRowContext(session.ctx, sql).Scan(&total)
 	session.saveLastSQL(sql)
 	if err != nil {
 		return true, err
@@ -1550,7 +1890,7 @@ func (session *Session) addIndex(tableName, idxName string) error {
 		defer session.Close()
 	}
 	index := session.Statement.RefTable.Indexes[idxName]
-	sqlStr := session.Engine.dialect.CreateIndexSql(tableName, index)
+	sqlStr := session.Engine.createIndexSQL(session.Statement.RefTable, tableName, index)
 
 	_, err := session.exec(sqlStr)
 	return err
@@ -1562,7 +1902,7 @@ func (session *Session) addUnique(tableName, uqeName string) error {
 		defer session.Close()
 	}
 	index := session.Statement.RefTable.Indexes[uqeName]
-	sqlStr := session.Engine.dialect.CreateIndexSql(tableName, index)
+	sqlStr := session.Engine.createIndexSQL(session.Statement.RefTable, tableName, index)
 	_, err := session.exec(sqlStr)
 	return err
 }
@@ -1622,7 +1962,7 @@ func (session *Session) rows2Beans(rows *core.Rows, fields []string, fieldsCount
 		}
 		sliceValueSetFunc(&newValue)
 	}
-	return nil
+	return rows.Err()
 }
 
 func (session *Session) row2Bean(rows *core.Rows, fields []string, fieldsCount int, bean interface{}) error {
@@ -1646,6 +1986,11 @@ func (session *Session) _row2Bean(rows *core.Rows, fields []string, fieldsCount
 		return err
 	}
 
+	return session.slice2Bean(scanResults, fields, bean, dataStruct, table)
+}
+
+// slice2Bean sets the scanned values of fields into bean
+func (session *Session) slice2Bean(scanResults []interface{}, fields []string, bean interface{}, dataStruct *reflect.Value, table *core.Table) error {
 	if b, hasBeforeSet := bean.(BeforeSetProcessor); hasBeforeSet {
 		for ii, key := range fields {
 			b.BeforeSet(key, Cell(scanResults[ii].(*interface{})))
@@ -2123,7 +2468,7 @@ func (session *Session) query(sqlStr string, paramStr ...interface{}) (resultsSl
 }
 
 func (session *Session) txQuery(tx *core.Tx, sqlStr string, params ...interface{}) (resultsSlice []map[string][]byte, err error) {
-	rows, err := tx.Query(sqlStr, params...)
+	rows, err := tx.QueryContext(session.ctx, sqlStr, params...)
 	if err != nil {
 		return nil, err
 	}
@@ -2140,7 +2485,7 @@ func (session *Session) innerQuery(sqlStr string, params ...interface{}) (*core.
 			if err != nil {
 				return nil, nil, err
 			}
-			rows, err := stmt.Query(params...)
+			rows, err := stmt.QueryContext(session.ctx, params...)
 			if err != nil {
 				return nil, nil, err
 			}
@@ -2148,20 +2493,29 @@ func (session *Session) innerQuery(sqlStr string, params ...interface{}) (*core.
 		}
 	} else {
 		callback = func() (*core.Stmt, *core.Rows, error) {
-			rows, err := session.DB().Query(sqlStr, params...)
+			rows, err := session.DB().QueryContext(session.ctx, sqlStr, params...)
 			if err != nil {
 				return nil, nil, err
 			}
 			return nil, rows, err
 		}
 	}
-	stmt, rows, err := session.Engine.logSQLQueryTime(sqlStr, params, callback)
+	stmt, rows, err := session.Engine.logSQLQueryTime(session.takeSQLLog(), callback)
 	if err != nil {
 		return nil, nil, err
 	}
 	return stmt, rows, nil
 }
 
+// rawQuery queries sqlStr in the session's transaction if there is one,
+// without filtering nor logging it
+func (session *Session) rawQuery(sqlStr string, args ...interface{}) (*core.Rows, error) {
+	if session.IsAutoCommit {
+		return session.DB().QueryContext(session.ctx, sqlStr, args...)
+	}
+	return session.Tx.QueryContext(session.ctx, sqlStr, args...)
+}
+
 func (session *Session) innerQuery2(sqlStr string, params ...interface{}) ([]map[string][]byte, error) {
 	_, rows, err := session.innerQuery(sqlStr, params...)
 	if rows != nil {
@@ -2179,8 +2533,38 @@ func (session *Session) Query(sqlStr string, paramStr ...interface{}) (resultsSl
 	if session.IsAutoClose {
 		defer session.Close()
 	}
+	defer session.readReplica(sqlStr)()
+
+	if session.Statement.resultTTL <= 0 {
+		return session.query(sqlStr, paramStr...)
+	}
+	res, err := session.cachedResult("query", sqlStr, paramStr, func() (interface{}, error) {
+		return session.query(sqlStr, paramStr...)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return copyMaps(res.([]map[string][]byte)), nil
+}
+
+// QueryString a raw sql and return records as []map[string]string
+func (session *Session) QueryString(sqlStr string, paramStr ...interface{}) ([]map[string]string, error) {
+	defer session.resetStatement()
+	if session.IsAutoClose {
+		defer session.Close()
+	}
+	defer session.readReplica(sqlStr)()
 
-	return session.query(sqlStr, paramStr...)
+	if session.Statement.resultTTL <= 0 {
+		return session.query2(sqlStr, paramStr...)
+	}
+	res, err := session.cachedResult("querystring", sqlStr, paramStr, func() (interface{}, error) {
+		return session.query2(sqlStr, paramStr...)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return copyStringMaps(res.([]map[string]string)), nil
 }
 
 // =============================
@@ -2190,9 +2574,9 @@ func (session *Session) query2(sqlStr string, paramStr ...interface{}) (resultsS
 	session.queryPreprocess(&sqlStr, paramStr...)
 
 	if session.IsAutoCommit {
-		return query2(session.DB(), sqlStr, paramStr...)
+		return query2(session.ctx, session.DB(), sqlStr, paramStr...)
 	}
-	return txQuery2(session.Tx, sqlStr, paramStr...)
+	return txQuery2(session.ctx, session.Tx, sqlStr, paramStr...)
 }
 
 // Insert insert one or more beans
@@ -2210,12 +2594,14 @@ func (session *Session) Insert(beans ...interface{}) (int64, error) {
 			size := sliceValue.Len()
 			if size > 0 {
 				if session.Engine.SupportInsertMany() {
-					cnt, err := session.innerInsertMulti(bean)
-					session.resetStatement()
-					if err != nil {
-						return affected, err
+					for _, part := range session.splitByTable(sliceValue) {
+						cnt, err := session.innerInsertMulti(part.Interface())
+						session.resetStatement()
+						if err != nil {
+							return affected, err
+						}
+						affected += cnt
 					}
-					affected += cnt
 				} else {
 					for i := 0; i < size; i++ {
 						cnt, err := session.innerInsert(sliceValue.Index(i).Interface())
@@ -2251,6 +2637,7 @@ func (session *Session) innerInsertMulti(rowsSlicePtr interface{}) (int64, error
 	}
 
 	session.Statement.setRefValue(sliceValue.Index(0))
+	session.Statement.resolveTableName(sliceValue.Index(0).Interface(), "insert")
 
 	if len(session.Statement.TableName()) <= 0 {
 		return 0, ErrTableNotFound
@@ -2261,6 +2648,7 @@ func (session *Session) innerInsertMulti(rowsSlicePtr interface{}) (int64, error
 
 	var colNames []string
 	var colMultiPlaces []string
+	var rowsPlaces [][]string
 	var args []interface{}
 	var cols []*core.Column
 
@@ -2390,6 +2778,7 @@ func (session *Session) innerInsertMulti(rowsSlicePtr interface{}) (int64, error
 			}
 		}
 		colMultiPlaces = append(colMultiPlaces, strings.Join(colPlaces, ", "))
+		rowsPlaces = append(rowsPlaces, colPlaces)
 	}
 	cleanupProcessorsClosures(&session.beforeClosures)
 
@@ -2400,12 +2789,25 @@ func (session *Session) innerInsertMulti(rowsSlicePtr interface{}) (int64, error
 		session.Engine.QuoteStr(),
 		strings.Join(colMultiPlaces, "),("))
 
-	res, err := session.exec(statement, args...)
+	if session.Statement.isUpsert {
+		var err error
+		statement, err = session.upsertSQL(colNames, rowsPlaces)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	res, err := session.execReturning(statement, args, true, false, func(i int) interface{} {
+		if i >= size {
+			return nil
+		}
+		return reflect.Indirect(sliceValue.Index(i)).Addr().Interface()
+	})
 	if err != nil {
-		return 0, err
+		return 0, session.constraintError(err)
 	}
 
-	if cacher := session.Engine.getCacher2(table); cacher != nil && session.Statement.UseCache {
+	if cacher := session.getCacher(table); cacher != nil && session.Statement.UseCache {
 		session.cacheInsert(session.Statement.TableName())
 	}
 
@@ -3110,6 +3512,7 @@ func (session *Session) value2Interface(col *core.Column, fieldValue reflect.Val
 
 func (session *Session) innerInsert(bean interface{}) (int64, error) {
 	session.Statement.setRefValue(rValue(bean))
+	session.Statement.resolveTableName(bean, "insert")
 	if len(session.Statement.TableName()) <= 0 {
 		return 0, ErrTableNotFound
 	}
@@ -3161,6 +3564,28 @@ func (session *Session) innerInsert(bean interface{}) (int64, error) {
 		session.Engine.QuoteStr(),
 		colPlaces)
 
+	if session.Statement.isUpsert {
+		places := make([]string, 0, len(colNames))
+		for i := 0; i < len(colNames)-len(exprColumns); i++ {
+			places = append(places, "?")
+		}
+		sqlStr, err = session.upsertSQL(colNames, [][]string{append(places, exprColVals...)})
+		if err != nil {
+			return 0, err
+		}
+		// an updated record keeps its id and its version
+		if !session.Statement.returning && (table.AutoIncrement != "" || table.Version != "") &&
+			upsertReturns(session.Engine.dialect) {
+			session.Statement.returning = true
+			session.Statement.returnColumns = nil
+			for _, colName := range []string{table.AutoIncrement, table.Version} {
+				if colName != "" {
+					session.Statement.returnColumns = append(session.Statement.returnColumns, colName)
+				}
+			}
+		}
+	}
+
 	handleAfterInsertProcessorFunc := func(bean interface{}) {
 		if session.IsAutoCommit {
 			for _, closure := range session.afterClosures {
@@ -3191,7 +3616,8 @@ func (session *Session) innerInsert(bean interface{}) (int64, error) {
 
 	// for postgres, many of them didn't implement lastInsertId, so we should
 	// implemented it ourself.
-	if session.Engine.dialect.DBType() == core.ORACLE && len(table.AutoIncrement) > 0 {
+	if session.Engine.dialect.DBType() == core.ORACLE && len(table.AutoIncrement) > 0 && !session.Statement.returning &&
+		!session.Statement.isUpsert {
 		//assert table.AutoIncrement != ""
 		res, err := session.query("select seq_atable.currval from dual", args...)
 		if err != nil {
@@ -3200,7 +3626,7 @@ func (session *Session) innerInsert(bean interface{}) (int64, error) {
 
 		handleAfterInsertProcessorFunc(bean)
 
-		if cacher := session.Engine.getCacher2(table); cacher != nil && session.Statement.UseCache {
+		if cacher := session.getCacher(table); cacher != nil && session.Statement.UseCache {
 			session.cacheInsert(session.Statement.TableName())
 		}
 
@@ -3235,17 +3661,18 @@ func (session *Session) innerInsert(bean interface{}) (int64, error) {
 		aiValue.Set(int64ToIntValue(id, aiValue.Type()))
 
 		return 1, nil
-	} else if session.Engine.dialect.DBType() == core.POSTGRES && len(table.AutoIncrement) > 0 {
+	} else if session.Engine.dialect.DBType() == core.POSTGRES && len(table.AutoIncrement) > 0 && !session.Statement.returning {
 		//assert table.AutoIncrement != ""
 		sqlStr = sqlStr + " RETURNING " + session.Engine.Quote(table.AutoIncrement)
 		res, err := session.query(sqlStr, args...)
 
 		if err != nil {
-			return 0, err
+			return 0, session.constraintError(err)
 		}
+		session.clearResults(sqlStr)
 		handleAfterInsertProcessorFunc(bean)
 
-		if cacher := session.Engine.getCacher2(table); cacher != nil && session.Statement.UseCache {
+		if cacher := session.getCacher(table); cacher != nil && session.Statement.UseCache {
 			session.cacheInsert(session.Statement.TableName())
 		}
 
@@ -3281,18 +3708,24 @@ func (session *Session) innerInsert(bean interface{}) (int64, error) {
 
 		return 1, nil
 	} else {
-		res, err := session.exec(sqlStr, args...)
+		res, err := session.execReturning(sqlStr, args, true, false, func(i int) interface{} {
+			if i > 0 {
+				return nil
+			}
+			return bean
+		})
 		if err != nil {
-			return 0, err
+			return 0, session.constraintError(err)
 		}
 
 		defer handleAfterInsertProcessorFunc(bean)
 
-		if cacher := session.Engine.getCacher2(table); cacher != nil && session.Statement.UseCache {
+		if cacher := session.getCacher(table); cacher != nil && session.Statement.UseCache {
 			session.cacheInsert(session.Statement.TableName())
 		}
 
-		if table.Version != "" && session.Statement.checkVersion {
+		if table.Version != "" && session.Statement.checkVersion && !session.returnsCol(table.Version) &&
+			!session.Statement.isUpsert {
 			verValue, err := table.VersionColumn().ValueOf(bean)
 			if err != nil {
 				session.Engine.logger.Error(err)
@@ -3304,6 +3737,9 @@ func (session *Session) innerInsert(bean interface{}) (int64, error) {
 		if table.AutoIncrement == "" {
 			return res.RowsAffected()
 		}
+		if _, ok := session.Engine.dialect.(upsertIdDialect); session.Statement.isUpsert && !ok {
+			return res.RowsAffected()
+		}
 
 		var id int64
 		id, err = res.LastInsertId()
@@ -3344,7 +3780,7 @@ func (session *Session) cacheInsert(tables ...string) error {
 	}
 
 	table := session.Statement.RefTable
-	cacher := session.Engine.getCacher2(table)
+	cacher := session.getCacher(table)
 
 	for _, t := range tables {
 		session.Engine.logger.Debug("[cache] clear sql:", t)
@@ -3355,8 +3791,7 @@ func (session *Session) cacheInsert(tables ...string) error {
 }
 
 func (session *Session) cacheUpdate(sqlStr string, args ...interface{}) error {
-	if session.Statement.RefTable == nil ||
-		session.Tx != nil {
+	if session.Statement.RefTable == nil {
 		return ErrCacheFailed
 	}
 
@@ -3379,12 +3814,12 @@ func (session *Session) cacheUpdate(sqlStr string, args ...interface{}) error {
 		}
 	}
 	table := session.Statement.RefTable
-	cacher := session.Engine.getCacher2(table)
+	cacher := session.getCacher(table)
 	tableName := session.Statement.TableName()
 	session.Engine.logger.Debug("[cacheUpdate] get cache sql", newsql, args[nStart:])
 	ids, err := core.GetCacheSql(cacher, tableName, newsql, args[nStart:])
 	if err != nil {
-		rows, err := session.DB().Query(newsql, args[nStart:]...)
+		rows, err := session.rawQuery(newsql, args[nStart:]...)
 		if err != nil {
 			return err
 		}
@@ -3509,6 +3944,11 @@ func (session *Session) Update(bean interface{}, condiBean ...interface{}) (int6
 	var isStruct = t.Kind() == reflect.Struct
 	if isStruct {
 		session.Statement.setRefValue(v)
+		if len(condiBean) > 0 {
+			session.Statement.resolveTableName(condiBean[0], "update")
+		} else {
+			session.Statement.resolveTableName(bean, "update")
+		}
 
 		if len(session.Statement.TableName()) <= 0 {
 			return 0, ErrTableNotFound
@@ -3634,20 +4074,25 @@ func (session *Session) Update(bean interface{}, condiBean ...interface{}) (int6
 			condSQL)
 	}
 
-	res, err := session.exec(sqlStr, append(args, condArgs...)...)
+	res, err := session.execReturning(sqlStr, append(args, condArgs...), false, false, func(i int) interface{} {
+		if i > 0 || !isStruct {
+			return nil
+		}
+		return bean
+	})
 	if err != nil {
-		return 0, err
-	} else if doIncVer {
+		return 0, session.constraintError(err)
+	} else if doIncVer && !session.returnsCol(table.Version) {
 		if verValue != nil && verValue.IsValid() && verValue.CanSet() {
 			verValue.SetInt(verValue.Int() + 1)
 		}
 	}
 
 	if table != nil {
-		if cacher := session.Engine.getCacher2(table); cacher != nil && session.Statement.UseCache {
-			cacher.ClearIds(session.Statement.TableName())
-			cacher.ClearBeans(session.Statement.TableName())
+		if doIncVer {
+			colNames = append(colNames, session.Engine.Quote(table.Version)+" = ?")
 		}
+		session.cacheUpdated(colNames)
 	}
 
 	// handle after update processors
@@ -3684,8 +4129,7 @@ func (session *Session) Update(bean interface{}, condiBean ...interface{}) (int6
 }
 
 func (session *Session) cacheDelete(sqlStr string, args ...interface{}) error {
-	if session.Statement.RefTable == nil ||
-		session.Tx != nil {
+	if session.Statement.RefTable == nil {
 		return ErrCacheFailed
 	}
 
@@ -3698,7 +4142,7 @@ func (session *Session) cacheDelete(sqlStr string, args ...interface{}) error {
 		return ErrCacheFailed
 	}
 
-	cacher := session.Engine.getCacher2(session.Statement.RefTable)
+	cacher := session.getCacher(session.Statement.RefTable)
 	tableName := session.Statement.TableName()
 	ids, err := core.GetCacheSql(cacher, tableName, newsql, args)
 	if err != nil {
@@ -3734,6 +4178,7 @@ func (session *Session) cacheDelete(sqlStr string, args ...interface{}) error {
 	    cacher.DelIds(tableName, genSqlKey(newsql, args))
 	}*/
 
+	sids := make([]string, 0, len(ids))
 	for _, id := range ids {
 		session.Engine.logger.Debug("[cacheDelete] delete cache obj", tableName, id)
 		sid, err := id.ToString()
@@ -3741,9 +4186,14 @@ func (session *Session) cacheDelete(sqlStr string, args ...interface{}) error {
 			return err
 		}
 		cacher.DelBean(tableName, sid)
+		sids = append(sids, sid)
+	}
+	session.Engine.logger.Debug("[cacheDelete] clear cache sql of", tableName, sids)
+	clearIdsOfBeans(cacher, tableName, sids)
+	// the soft deleted records may be selected by Unscoped queries
+	if deleted := session.Statement.RefTable.DeletedColumn(); deleted != nil && !session.Statement.unscoped {
+		clearIdsOfColumns(cacher, tableName, []string{deleted.Name})
 	}
-	session.Engine.logger.Debug("[cacheDelete] clear cache sql", tableName)
-	cacher.ClearIds(tableName)
 	return nil
 }
 
@@ -3755,6 +4205,7 @@ func (session *Session) Delete(bean interface{}) (int64, error) {
 	}
 
 	session.Statement.setRefValue(rValue(bean))
+	session.Statement.resolveTableName(bean, "delete")
 	var table = session.Statement.RefTable
 
 	// handle before delete processors
@@ -3880,13 +4331,19 @@ func (session *Session) Delete(bean interface{}) (int64, error) {
 		})
 	}
 
-	if cacher := session.Engine.getCacher2(session.Statement.RefTable); cacher != nil && session.Statement.UseCache {
+	if cacher := session.getCacher(session.Statement.RefTable); cacher != nil && session.Statement.UseCache {
 		session.cacheDelete(deleteSQL, argsForCache...)
 	}
 
-	res, err := session.exec(realSQL, condArgs...)
+	isDelete := session.Statement.unscoped || table.DeletedColumn() == nil
+	res, err := session.execReturning(realSQL, condArgs, false, isDelete, func(i int) interface{} {
+		if i > 0 {
+			return nil
+		}
+		return bean
+	})
 	if err != nil {
-		return 0, err
+		return 0, session.constraintError(err)
 	}
 
 	// handle after delete processors
@@ -3919,11 +4376,39 @@ func (session *Session) Delete(bean interface{}) (int64, error) {
 	return res.RowsAffected()
 }
 
-// saveLastSQL stores executed query information
+// saveLastSQL stores executed query information. The statement is logged
+// before its execution, or after it with its duration when ShowExecTime is
+// on.
 func (session *Session) saveLastSQL(sql string, args ...interface{}) {
 	session.lastSQL = sql
 	session.lastSQLArgs = args
-	session.Engine.logSQL(sql, args...)
+
+	session.flushSQLLog()
+	if !session.Engine.showSQL {
+		return
+	}
+	session.sqlLog = session.Engine.pendingSQLLog(LogContext{
+		SQL:       sql,
+		Args:      args,
+		Table:     session.Statement.TableName(),
+		SessionID: session.id,
+		Context:   session.ctx,
+	})
+}
+
+// takeSQLLog returns the log of the statement about to run, for the caller
+// to time and log it
+func (session *Session) takeSQLLog() *LogContext {
+	log := session.sqlLog
+	session.sqlLog = nil
+	return log
+}
+
+// flushSQLLog logs the last statement if it wasn't timed
+func (session *Session) flushSQLLog() {
+	if log := session.takeSQLLog(); log != nil {
+		session.Engine.logSQL(*log)
+	}
 }
 
 // LastSQL returns last query information
@@ -3942,194 +4427,9 @@ func (session *Session) tbNameNoSchema(table *core.Table) string {
 
 // Sync2 synchronize structs to database tables
 func (session *Session) Sync2(beans ...interface{}) error {
-	engine := session.Engine
-
-	tables, err := engine.DBMetas()
-	if err != nil {
-		return err
-	}
-
-	var structTables []*core.Table
-
-	for _, bean := range beans {
-		v := rValue(bean)
-		table := engine.mapType(v)
-		structTables = append(structTables, table)
-		var tbName = session.tbNameNoSchema(table)
-
-		var oriTable *core.Table
-		for _, tb := range tables {
-			if equalNoCase(tb.Name, tbName) {
-				oriTable = tb
-				break
-			}
-		}
-
-		if oriTable == nil {
-			err = session.StoreEngine(session.Statement.StoreEngine).CreateTable(bean)
-			if err != nil {
-				return err
-			}
-
-			err = session.CreateUniques(bean)
-			if err != nil {
-				return err
-			}
-
-			err = session.CreateIndexes(bean)
-			if err != nil {
-				return err
-			}
-		} else {
-			for _, col := range table.Columns() {
-				var oriCol *core.Column
-				for _, col2 := range oriTable.Columns() {
-					if equalNoCase(col.Name, col2.Name) {
-						oriCol = col2
-						break
-					}
-				}
-
-				if oriCol != nil {
-					expectedType := engine.dialect.SqlType(col)
-					curType := engine.dialect.SqlType(oriCol)
-					if expectedType != curType {
-						if expectedType == core.Text &&
-							strings.HasPrefix(curType, core.Varchar) {
-							// currently only support mysql & postgres
-							if engine.dialect.DBType() == core.MYSQL ||
-								engine.dialect.DBType() == core.POSTGRES {
-								engine.logger.Infof("Table %s column %s change type from %s to %s\n",
-									tbName, col.Name, curType, expectedType)
-								_, err = engine.Exec(engine.dialect.ModifyColumnSql(table.Name, col))
-							} else {
-								engine.logger.Warnf("Table %s column %s db type is %s, struct type is %s\n",
-									tbName, col.Name, curType, expectedType)
-							}
-						} else if strings.HasPrefix(curType, core.Varchar) && strings.HasPrefix(expectedType, core.Varchar) {
-							if engine.dialect.DBType() == core.MYSQL {
-								if oriCol.Length < col.Length {
-									engine.logger.Infof("Table %s column %s change type from varchar(%d) to varchar(%d)\n",
-										tbName, col.Name, oriCol.Length, col.Length)
-									_, err = engine.Exec(engine.dialect.ModifyColumnSql(table.Name, col))
-								}
-							}
-						} else {
-							if !(strings.HasPrefix(curType, expectedType) && curType[len(expectedType)] == '(') {
-								engine.logger.Warnf("Table %s column %s db type is %s, struct type is %s",
-									tbName, col.Name, curType, expectedType)
-							}
-						}
-					} else if expectedType == core.Varchar {
-						if engine.dialect.DBType() == core.MYSQL {
-							if oriCol.Length < col.Length {
-								engine.logger.Infof("Table %s column %s change type from varchar(%d) to varchar(%d)\n",
-									tbName, col.Name, oriCol.Length, col.Length)
-								_, err = engine.Exec(engine.dialect.ModifyColumnSql(table.Name, col))
-							}
-						}
-					}
-					if col.Default != oriCol.Default {
-						engine.logger.Warnf("Table %s Column %s db default is %s, struct default is %s",
-							tbName, col.Name, oriCol.Default, col.Default)
-					}
-					if col.Nullable != oriCol.Nullable {
-						engine.logger.Warnf("Table %s Column %s db nullable is %v, struct nullable is %v",
-							tbName, col.Name, oriCol.Nullable, col.Nullable)
-					}
-				} else {
-					session := engine.NewSession()
-					session.Statement.RefTable = table
-					session.Statement.tableName = tbName
-					defer session.Close()
-					err = session.addColumn(col.Name)
-				}
-				if err != nil {
-					return err
-				}
-			}
-
-			var foundIndexNames = make(map[string]bool)
-			var addedNames = make(map[string]*core.Index)
-
-			for name, index := range table.Indexes {
-				var oriIndex *core.Index
-				for name2, index2 := range oriTable.Indexes {
-					if index.Equal(index2) {
-						oriIndex = index2
-						foundIndexNames[name2] = true
-						break
-					}
-				}
-
-				if oriIndex != nil {
-					if oriIndex.Type != index.Type {
-						sql := engine.dialect.DropIndexSql(tbName, oriIndex)
-						_, err = engine.Exec(sql)
-						if err != nil {
-							return err
-						}
-						oriIndex = nil
-					}
-				}
-
-				if oriIndex == nil {
-					addedNames[name] = index
-				}
-			}
-
-			for name2, index2 := range oriTable.Indexes {
-				if _, ok := foundIndexNames[name2]; !ok {
-					sql := engine.dialect.DropIndexSql(tbName, index2)
-					_, err = engine.Exec(sql)
-					if err != nil {
-						return err
-					}
-				}
-			}
-
-			for name, index := range addedNames {
-				if index.Type == core.UniqueType {
-					session := engine.NewSession()
-					session.Statement.RefTable = table
-					session.Statement.tableName = tbName
-					defer session.Close()
-					err = session.addUnique(tbName, name)
-				} else if index.Type == core.IndexType {
-					session := engine.NewSession()
-					session.Statement.RefTable = table
-					session.Statement.tableName = tbName
-					defer session.Close()
-					err = session.addIndex(tbName, name)
-				}
-				if err != nil {
-					return err
-				}
-			}
-		}
-	}
-
-	for _, table := range tables {
-		var oriTable *core.Table
-		for _, structTable := range structTables {
-			if equalNoCase(table.Name, session.tbNameNoSchema(structTable)) {
-				oriTable = structTable
-				break
-			}
-		}
-
-		if oriTable == nil {
-			//engine.LogWarnf("Table %s has no struct to mapping it", table.Name)
-			continue
-		}
+	defer session.resetStatement()
 
-		for _, colName := range table.ColumnsSeq() {
-			if oriTable.GetColumn(colName) == nil {
-				engine.logger.Warnf("Table %s has column %s but struct has not related field", table.Name, colName)
-			}
-		}
-	}
-	return nil
+	return session.sync(sync2Options, beans...)
 }
 
 // Unscoped always disable struct tag "deleted"
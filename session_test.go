@@ -0,0 +1,231 @@
+package xorm
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/go-xorm/core"
+)
+
+type NestedTx struct {
+	Id   int64
+	Name string
+}
+
+var nestedTxInserted []string
+
+func (tx *NestedTx) AfterInsert() {
+	nestedTxInserted = append(nestedTxInserted, tx.Name)
+}
+
+func nestedTxNames(t *testing.T, engine *Engine) string {
+	var rows []NestedTx
+	if err := engine.Asc("id").Find(&rows); err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, row := range rows {
+		names = append(names, row.Name)
+	}
+	return strings.Join(names, ",")
+}
+
+func TestNestedTransactions(t *testing.T) {
+	engine := newTestEngine(t)
+	if err := engine.Sync2(new(NestedTx)); err != nil {
+		t.Fatal(err)
+	}
+	nestedTxInserted = nil
+
+	session := engine.NewSession()
+	defer session.Close()
+	insert := func(name string) {
+		if _, err := session.Insert(&NestedTx{Name: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := session.Begin(); err != nil {
+		t.Fatal(err)
+	}
+	insert("a")
+
+	if err := session.Begin(); err != nil {
+		t.Fatal(err)
+	}
+	insert("b")
+	if err := session.Begin(); err != nil {
+		t.Fatal(err)
+	}
+	insert("c")
+	// releases the savepoint of c, b's transaction still decides
+	if err := session.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if err := session.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := session.Begin(); err != nil {
+		t.Fatal(err)
+	}
+	insert("d")
+	if err := session.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if len(session.savepoints) != 0 {
+		t.Fatalf("%v savepoints left", len(session.savepoints))
+	}
+	if len(nestedTxInserted) != 0 {
+		t.Errorf("after insert called before the commit for %v", nestedTxInserted)
+	}
+
+	if err := session.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if names := nestedTxNames(t, engine); names != "a,d" {
+		t.Errorf("got rows %v, expected a,d", names)
+	}
+	sort.Strings(nestedTxInserted)
+	if strings.Join(nestedTxInserted, ",") != "a,d" {
+		t.Errorf("after insert called for %v, expected a,d", nestedTxInserted)
+	}
+}
+
+func TestNestedTransactionOuterRollback(t *testing.T) {
+	engine := newTestEngine(t)
+	if err := engine.Sync2(new(NestedTx)); err != nil {
+		t.Fatal(err)
+	}
+
+	session := engine.NewSession()
+	defer session.Close()
+	if err := session.Begin(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := session.Insert(&NestedTx{Name: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := session.Begin(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := session.Insert(&NestedTx{Name: "b"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := session.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if err := session.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	if names := nestedTxNames(t, engine); names != "" {
+		t.Errorf("got rows %v after the outer rollback", names)
+	}
+}
+
+func TestNestedTransactionFailedRollback(t *testing.T) {
+	engine := newTestEngine(t)
+	if err := engine.Sync2(new(NestedTx)); err != nil {
+		t.Fatal(err)
+	}
+
+	session := engine.NewSession()
+	defer session.Close()
+	if err := session.Begin(); err != nil {
+		t.Fatal(err)
+	}
+	if err := session.Begin(); err != nil {
+		t.Fatal(err)
+	}
+	// the savepoint is gone, so rolling back to it fails
+	if _, err := session.Exec("RELEASE SAVEPOINT " + session.savepoints[0].name); err != nil {
+		t.Fatal(err)
+	}
+	if err := session.Rollback(); err == nil {
+		t.Fatal("expected an error")
+	}
+	if len(session.savepoints) != 1 {
+		t.Errorf("the failed rollback popped the savepoint")
+	}
+}
+
+// connOptionsDialect sets a transaction option for the whole connection, as
+// mssql's SET TRANSACTION ISOLATION LEVEL does
+type connOptionsDialect struct {
+	*sqlite3
+}
+
+func (db *connOptionsDialect) SetTransactionSqls(isolation sql.IsolationLevel, readOnly bool) ([]string, error) {
+	return []string{"PRAGMA read_uncommitted = 1"}, nil
+}
+
+func (db *connOptionsDialect) ResetTransactionSqls() []string {
+	return []string{"PRAGMA read_uncommitted = 0"}
+}
+
+func TestBeginTxResetsOptions(t *testing.T) {
+	engine := newTestEngine(t)
+	engine.SetMaxOpenConns(1)
+	engine.dialect = &connOptionsDialect{engine.dialect.(*sqlite3)}
+
+	readUncommitted := func() string {
+		results, err := engine.QueryString("PRAGMA read_uncommitted")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return results[0]["read_uncommitted"]
+	}
+
+	for _, end := range []func(*Session) error{(*Session).Commit, (*Session).Rollback} {
+		session := engine.NewSession()
+		if err := session.BeginTx(TxOptions{Isolation: sql.LevelReadUncommitted}); err != nil {
+			t.Fatal(err)
+		}
+		results, err := session.QueryString("PRAGMA read_uncommitted")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if results[0]["read_uncommitted"] != "1" {
+			t.Errorf("the transaction options are not set")
+		}
+		if err = end(session); err != nil {
+			t.Fatal(err)
+		}
+		session.Close()
+
+		if got := readUncommitted(); got != "0" {
+			t.Errorf("the connection kept the transaction options")
+		}
+	}
+}
+
+func TestMssqlSetTransactionSqls(t *testing.T) {
+	var cases = []struct {
+		driverName string
+		isolation  sql.IsolationLevel
+		readOnly   bool
+		sqls       []string
+		err        bool
+	}{
+		{"odbc", sql.LevelSerializable, false, []string{"SET TRANSACTION ISOLATION LEVEL SERIALIZABLE"}, false},
+		{"odbc", sql.LevelDefault, false, []string{}, false},
+		{"odbc", sql.LevelLinearizable, false, nil, true},
+		{"odbc", sql.LevelDefault, true, nil, true},
+		{"mssql", sql.LevelSerializable, false, nil, false},
+		{"sqlserver", sql.LevelSerializable, false, nil, true},
+	}
+	for _, c := range cases {
+		dialect := new(mssql)
+		dialect.Init(nil, &core.Uri{DbType: core.MSSQL}, c.driverName, "")
+		sqls, err := dialect.SetTransactionSqls(c.isolation, c.readOnly)
+		if (err != nil) != c.err {
+			t.Errorf("%v %v: got error %v", c.driverName, c.isolation, err)
+		}
+		if fmt.Sprint(sqls) != fmt.Sprint(c.sqls) || (sqls == nil) != (c.sqls == nil) {
+			t.Errorf("%v %v: got %#v, expected %#v", c.driverName, c.isolation, sqls, c.sqls)
+		}
+	}
+}
@@ -0,0 +1,739 @@
+// Copyright 2017 The Xorm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xorm
+
+import (
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-xorm/builder"
+	"github.com/go-xorm/core"
+)
+
+// ShardTarget is where the records of a shard are, in the tables of Engine
+// whose names are suffixed by TableSuffix
+type ShardTarget struct {
+	Engine      *Engine
+	TableSuffix string
+}
+
+// ShardingRule maps the records to their shards by their sharding key
+type ShardingRule interface {
+	// Shards returns all the shards, the first one also holds the tables
+	// which aren't sharded
+	Shards() []ShardTarget
+	// KeyColumn returns the column table is sharded by, "" if it isn't
+	KeyColumn(table *core.Table) string
+	// Shard returns the shard of the records of table whose key is key
+	Shard(table *core.Table, key interface{}) (ShardTarget, error)
+}
+
+// ModShardingRule shards the tables having the column Column across
+// Targets, by the key modulo the number of targets. The string keys are
+// hashed with crc32.
+type ModShardingRule struct {
+	Column  string
+	Targets []ShardTarget
+}
+
+// Shards implements ShardingRule
+func (rule *ModShardingRule) Shards() []ShardTarget {
+	return rule.Targets
+}
+
+// KeyColumn implements ShardingRule
+func (rule *ModShardingRule) KeyColumn(table *core.Table) string {
+	if col := table.GetColumn(rule.Column); col != nil {
+		return col.Name
+	}
+	return ""
+}
+
+// Shard implements ShardingRule
+func (rule *ModShardingRule) Shard(table *core.Table, key interface{}) (ShardTarget, error) {
+	n := uint64(len(rule.Targets))
+	if n == 0 {
+		return ShardTarget{}, ErrNoShard
+	}
+
+	v := reflect.Indirect(reflect.ValueOf(key))
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i := v.Int()
+		if i < 0 {
+			i = -i
+		}
+		return rule.Targets[uint64(i)%n], nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return rule.Targets[v.Uint()%n], nil
+	case reflect.String:
+		return rule.Targets[uint64(crc32.ChecksumIEEE([]byte(v.String())))%n], nil
+	}
+	return ShardTarget{}, fmt.Errorf("unsupported sharding key %v of table %v", key, table.Name)
+}
+
+// ShardedEngine runs the operations on the shards of the records given by
+// its ShardingRule. The operations whose conditions or beans give the
+// sharding keys go to their shards only, the others are run on all the
+// shards and their results merged.
+type ShardedEngine struct {
+	rule ShardingRule
+}
+
+// NewShardedEngine creates a ShardedEngine routing with rule
+func NewShardedEngine(rule ShardingRule) *ShardedEngine {
+	return &ShardedEngine{rule: rule}
+}
+
+// Rule returns the sharding rule
+func (engine *ShardedEngine) Rule() ShardingRule {
+	return engine.rule
+}
+
+// NewSession creates a session on the shards
+func (engine *ShardedEngine) NewSession() *ShardedSession {
+	return &ShardedSession{engine: engine, conds: make(map[string][]interface{})}
+}
+
+// Where starts a session with the condition, see ShardedSession.Where
+func (engine *ShardedEngine) Where(query interface{}, args ...interface{}) *ShardedSession {
+	return engine.NewSession().Where(query, args...)
+}
+
+// In starts a session with the condition "column IN (args)"
+func (engine *ShardedEngine) In(column string, args ...interface{}) *ShardedSession {
+	return engine.NewSession().In(column, args...)
+}
+
+// ID starts a session with the condition on the primary key
+func (engine *ShardedEngine) ID(id interface{}) *ShardedSession {
+	return engine.NewSession().ID(id)
+}
+
+// Cols starts a session with the columns to select or update
+func (engine *ShardedEngine) Cols(columns ...string) *ShardedSession {
+	return engine.NewSession().Cols(columns...)
+}
+
+// OrderBy starts a session ordered by order
+func (engine *ShardedEngine) OrderBy(order string) *ShardedSession {
+	return engine.NewSession().OrderBy(order)
+}
+
+// Desc starts a session ordered by the columns descending
+func (engine *ShardedEngine) Desc(colNames ...string) *ShardedSession {
+	return engine.NewSession().Desc(colNames...)
+}
+
+// Asc starts a session ordered by the columns ascending
+func (engine *ShardedEngine) Asc(colNames ...string) *ShardedSession {
+	return engine.NewSession().Asc(colNames...)
+}
+
+// Limit starts a session returning limit records after start
+func (engine *ShardedEngine) Limit(limit int, start ...int) *ShardedSession {
+	return engine.NewSession().Limit(limit, start...)
+}
+
+// Insert inserts the beans into their shards
+func (engine *ShardedEngine) Insert(beans ...interface{}) (int64, error) {
+	return engine.NewSession().Insert(beans...)
+}
+
+// Get retrieves one record, bean's non-empty fields are conditions
+func (engine *ShardedEngine) Get(bean interface{}) (bool, error) {
+	return engine.NewSession().Get(bean)
+}
+
+// Find retrieves the records of the shards
+func (engine *ShardedEngine) Find(rowsSlicePtr interface{}, condiBean ...interface{}) error {
+	return engine.NewSession().Find(rowsSlicePtr, condiBean...)
+}
+
+// Count counts the records of the shards
+func (engine *ShardedEngine) Count(bean interface{}) (int64, error) {
+	return engine.NewSession().Count(bean)
+}
+
+// Update updates the records of the shards
+func (engine *ShardedEngine) Update(bean interface{}, condiBeans ...interface{}) (int64, error) {
+	return engine.NewSession().Update(bean, condiBeans...)
+}
+
+// Delete deletes the records of the shards
+func (engine *ShardedEngine) Delete(bean interface{}) (int64, error) {
+	return engine.NewSession().Delete(bean)
+}
+
+// ShardedSession records the conditions of an operation, which are replayed
+// on a Session of every shard the operation runs on
+type ShardedSession struct {
+	engine *ShardedEngine
+	ops    []func(*Session)
+
+	// conds are the values the conditions restrict the columns to, by
+	// lowercased column name
+	conds map[string][]interface{}
+	id    interface{}
+	// or tells the conditions have an OR, so they don't restrict the keys
+	or bool
+
+	start, limit int
+}
+
+// Where adds a condition, which could be a builder.Cond. The builder.Eq
+// conditions on the sharding key route the operation to its shards.
+func (session *ShardedSession) Where(query interface{}, args ...interface{}) *ShardedSession {
+	return session.And(query, args...)
+}
+
+// And adds a condition, see Where
+func (session *ShardedSession) And(query interface{}, args ...interface{}) *ShardedSession {
+	if eq, ok := query.(builder.Eq); ok {
+		for col, value := range eq {
+			session.addCond(col, value)
+		}
+	}
+	session.ops = append(session.ops, func(s *Session) {
+		s.And(query, args...)
+	})
+	return session
+}
+
+// Or adds a condition, the operation then runs on all the shards
+func (session *ShardedSession) Or(query interface{}, args ...interface{}) *ShardedSession {
+	session.or = true
+	session.ops = append(session.ops, func(s *Session) {
+		s.Or(query, args...)
+	})
+	return session
+}
+
+// In adds the condition "column IN (args)"
+func (session *ShardedSession) In(column string, args ...interface{}) *ShardedSession {
+	if len(args) == 1 {
+		session.addCond(column, args[0])
+	} else {
+		session.addCond(column, args)
+	}
+	session.ops = append(session.ops, func(s *Session) {
+		s.In(column, args...)
+	})
+	return session
+}
+
+// ID adds the condition on the primary key
+func (session *ShardedSession) ID(id interface{}) *ShardedSession {
+	session.id = id
+	session.ops = append(session.ops, func(s *Session) {
+		s.ID(id)
+	})
+	return session
+}
+
+// Cols sets the columns to select or update
+func (session *ShardedSession) Cols(columns ...string) *ShardedSession {
+	session.ops = append(session.ops, func(s *Session) {
+		s.Cols(columns...)
+	})
+	return session
+}
+
+// Omit sets the columns not to select or update
+func (session *ShardedSession) Omit(columns ...string) *ShardedSession {
+	session.ops = append(session.ops, func(s *Session) {
+		s.Omit(columns...)
+	})
+	return session
+}
+
+// OrderBy orders the records by order, the columns of order must be
+// mapped to fields for the records of the shards to be merged
+func (session *ShardedSession) OrderBy(order string) *ShardedSession {
+	session.ops = append(session.ops, func(s *Session) {
+		s.OrderBy(order)
+	})
+	return session
+}
+
+// Desc orders the records by the columns descending
+func (session *ShardedSession) Desc(colNames ...string) *ShardedSession {
+	session.ops = append(session.ops, func(s *Session) {
+		s.Desc(colNames...)
+	})
+	return session
+}
+
+// Asc orders the records by the columns ascending
+func (session *ShardedSession) Asc(colNames ...string) *ShardedSession {
+	session.ops = append(session.ops, func(s *Session) {
+		s.Asc(colNames...)
+	})
+	return session
+}
+
+// Limit returns limit records after start of the merged records
+func (session *ShardedSession) Limit(limit int, start ...int) *ShardedSession {
+	session.limit = limit
+	session.start = 0
+	if len(start) > 0 {
+		session.start = start[0]
+	}
+	return session
+}
+
+// addCond records the values the conditions restrict col to, the first
+// condition on a column is kept
+func (session *ShardedSession) addCond(col string, value interface{}) {
+	col = strings.ToLower(strings.Trim(col, "`\"[] "))
+	if _, ok := session.conds[col]; ok {
+		return
+	}
+	session.conds[col] = shardKeys(value)
+}
+
+// shardKeys flattens value into the keys it stands for
+func shardKeys(value interface{}) []interface{} {
+	v := reflect.ValueOf(value)
+	if v.Kind() != reflect.Slice || v.Type().Elem().Kind() == reflect.Uint8 {
+		return []interface{}{value}
+	}
+	keys := make([]interface{}, v.Len())
+	for i := range keys {
+		keys[i] = v.Index(i).Interface()
+	}
+	return keys
+}
+
+// route returns the table of bean and the shards the operation runs on,
+// the sharding keys are read from the conditions then from condiBeans
+func (session *ShardedSession) route(bean interface{}, condiBeans ...interface{}) (*core.Table, string, []ShardTarget, error) {
+	rule := session.engine.rule
+	shards := rule.Shards()
+	if len(shards) == 0 {
+		return nil, "", nil, ErrNoShard
+	}
+
+	mapper := shards[0].Engine
+	v := rValue(bean)
+	if v.Kind() != reflect.Struct {
+		return nil, "", nil, ErrParamsType
+	}
+	table := mapper.autoMapType(v)
+	tableName := mapper.tbName(reflect.ValueOf(bean))
+
+	keyCol := rule.KeyColumn(table)
+	if keyCol == "" {
+		return table, tableName, []ShardTarget{{Engine: mapper}}, nil
+	}
+
+	keys := session.keys(table, keyCol, condiBeans)
+	if keys == nil {
+		return table, tableName, shards, nil
+	}
+
+	var targets []ShardTarget
+	seen := make(map[ShardTarget]bool)
+	for _, key := range keys {
+		target, err := rule.Shard(table, key)
+		if err != nil {
+			return nil, "", nil, err
+		}
+		if !seen[target] {
+			seen[target] = true
+			targets = append(targets, target)
+		}
+	}
+	return table, tableName, targets, nil
+}
+
+// keys returns the sharding keys the operation is restricted to, nil if it
+// isn't
+func (session *ShardedSession) keys(table *core.Table, keyCol string, condiBeans []interface{}) []interface{} {
+	if session.or {
+		return nil
+	}
+	if keys, ok := session.conds[strings.ToLower(keyCol)]; ok {
+		return keys
+	}
+	if session.id != nil && len(table.PrimaryKeys) == 1 && strings.EqualFold(table.PrimaryKeys[0], keyCol) {
+		if pk, ok := session.id.(core.PK); ok && len(pk) == 1 {
+			return []interface{}{pk[0]}
+		}
+		return []interface{}{session.id}
+	}
+	for _, bean := range condiBeans {
+		if key, ok := beanShardKey(table, keyCol, bean); ok {
+			return []interface{}{key}
+		}
+	}
+	return nil
+}
+
+// beanShardKey returns the sharding key of bean, ok is false if it's empty
+func beanShardKey(table *core.Table, keyCol string, bean interface{}) (interface{}, bool) {
+	if bean == nil {
+		return nil, false
+	}
+	col := table.GetColumn(keyCol)
+	if col == nil {
+		return nil, false
+	}
+	fieldValue, err := col.ValueOf(bean)
+	if err != nil || !fieldValue.IsValid() {
+		return nil, false
+	}
+	key := fieldValue.Interface()
+	if isZero(key) {
+		return nil, false
+	}
+	return key, true
+}
+
+// shardSession creates the session of target replaying the conditions
+func (session *ShardedSession) shardSession(target ShardTarget, tableName string) *Session {
+	s := target.Engine.NewSession()
+	s.Table(tableName + target.TableSuffix)
+	for _, op := range session.ops {
+		op(s)
+	}
+	return s
+}
+
+// Insert inserts the beans into the shards of their sharding keys, the
+// slices of beans are inserted bean by bean
+func (session *ShardedSession) Insert(beans ...interface{}) (int64, error) {
+	var affected int64
+	for _, bean := range beans {
+		v := rValue(bean)
+		if v.Kind() == reflect.Slice {
+			for i := 0; i < v.Len(); i++ {
+				elem := v.Index(i)
+				if elem.Kind() == reflect.Struct {
+					elem = elem.Addr()
+				}
+				n, err := session.Insert(elem.Interface())
+				affected += n
+				if err != nil {
+					return affected, err
+				}
+			}
+			continue
+		}
+
+		table, tableName, targets, err := session.route(bean)
+		if err != nil {
+			return affected, err
+		}
+		if len(targets) > 1 {
+			// the key of an inserted bean is its field, even if it's empty
+			col := table.GetColumn(session.engine.rule.KeyColumn(table))
+			if col == nil {
+				return affected, ErrNoShardKey
+			}
+			fieldValue, err := col.ValueOf(bean)
+			if err != nil || !fieldValue.IsValid() {
+				return affected, ErrNoShardKey
+			}
+			target, err := session.engine.rule.Shard(table, fieldValue.Interface())
+			if err != nil {
+				return affected, err
+			}
+			targets = []ShardTarget{target}
+		}
+
+		s := session.shardSession(targets[0], tableName)
+		n, err := s.Insert(bean)
+		s.Close()
+		affected += n
+		if err != nil {
+			return affected, err
+		}
+	}
+	return affected, nil
+}
+
+// Get retrieves one record, bean's non-empty fields are conditions. When it
+// runs on several shards, the first record in the order is retrieved.
+func (session *ShardedSession) Get(bean interface{}) (bool, error) {
+	table, tableName, targets, err := session.route(bean, bean)
+	if err != nil {
+		return false, err
+	}
+	if len(targets) == 1 {
+		s := session.shardSession(targets[0], tableName)
+		defer s.Close()
+		return s.Get(bean)
+	}
+
+	beanValue := reflect.Indirect(reflect.ValueOf(bean))
+	found := reflect.New(reflect.SliceOf(beanValue.Type())).Elem()
+	var orderStr string
+	for _, target := range targets {
+		s := session.shardSession(target, tableName)
+		orderStr = s.Statement.OrderStr
+		record := reflect.New(beanValue.Type())
+		record.Elem().Set(beanValue)
+		has, err := s.Get(record.Interface())
+		s.Close()
+		if err != nil {
+			return false, err
+		}
+		if has {
+			found = reflect.Append(found, record.Elem())
+		}
+	}
+	if found.Len() == 0 {
+		return false, nil
+	}
+
+	if err := sortShardRecords(found, table, orderStr); err != nil {
+		return false, err
+	}
+	beanValue.Set(found.Index(0))
+	return true, nil
+}
+
+// Find retrieves the records of the shards into the slice rowsSlicePtr
+// points to. The records of several shards are merged in the order of the
+// session, then limited.
+func (session *ShardedSession) Find(rowsSlicePtr interface{}, condiBean ...interface{}) error {
+	sliceValue := reflect.Indirect(reflect.ValueOf(rowsSlicePtr))
+	if sliceValue.Kind() != reflect.Slice {
+		return errors.New("needs a pointer to a slice")
+	}
+	elemType := sliceValue.Type().Elem()
+	beanType := elemType
+	if beanType.Kind() == reflect.Ptr {
+		beanType = beanType.Elem()
+	}
+
+	table, tableName, targets, err := session.route(reflect.New(beanType).Interface(), condiBean...)
+	if err != nil {
+		return err
+	}
+	if len(targets) == 1 {
+		s := session.shardSession(targets[0], tableName)
+		defer s.Close()
+		if session.limit > 0 {
+			s.Limit(session.limit, session.start)
+		}
+		return s.Find(rowsSlicePtr, condiBean...)
+	}
+
+	merged := reflect.MakeSlice(sliceValue.Type(), 0, 0)
+	var orderStr string
+	for _, target := range targets {
+		s := session.shardSession(target, tableName)
+		orderStr = s.Statement.OrderStr
+		if session.limit > 0 {
+			// every shard could hold all the records of the window
+			s.Limit(session.start + session.limit)
+		}
+		part := reflect.New(sliceValue.Type())
+		err := s.Find(part.Interface(), condiBean...)
+		s.Close()
+		if err != nil {
+			return err
+		}
+		merged = reflect.AppendSlice(merged, part.Elem())
+	}
+
+	if err := sortShardRecords(merged, table, orderStr); err != nil {
+		return err
+	}
+	if session.limit > 0 {
+		start, end := session.start, session.start+session.limit
+		if start > merged.Len() {
+			start = merged.Len()
+		}
+		if end > merged.Len() {
+			end = merged.Len()
+		}
+		merged = merged.Slice(start, end)
+	}
+	sliceValue.Set(reflect.AppendSlice(sliceValue, merged))
+	return nil
+}
+
+// Count counts the records of the shards, bean's non-empty fields are
+// conditions
+func (session *ShardedSession) Count(bean interface{}) (int64, error) {
+	_, tableName, targets, err := session.route(bean, bean)
+	if err != nil {
+		return 0, err
+	}
+
+	var total int64
+	for _, target := range targets {
+		s := session.shardSession(target, tableName)
+		n, err := s.Count(bean)
+		s.Close()
+		if err != nil {
+			return 0, err
+		}
+		total += n
+	}
+	return total, nil
+}
+
+// Update updates the records of the shards with bean, the sharding keys are
+// read from the conditions and condiBeans only
+func (session *ShardedSession) Update(bean interface{}, condiBeans ...interface{}) (int64, error) {
+	_, tableName, targets, err := session.route(bean, condiBeans...)
+	if err != nil {
+		return 0, err
+	}
+
+	var affected int64
+	for _, target := range targets {
+		s := session.shardSession(target, tableName)
+		n, err := s.Update(bean, condiBeans...)
+		s.Close()
+		affected += n
+		if err != nil {
+			return affected, err
+		}
+	}
+	return affected, nil
+}
+
+// Delete deletes the records of the shards, bean's non-empty fields are
+// conditions
+func (session *ShardedSession) Delete(bean interface{}) (int64, error) {
+	_, tableName, targets, err := session.route(bean, bean)
+	if err != nil {
+		return 0, err
+	}
+
+	var affected int64
+	for _, target := range targets {
+		s := session.shardSession(target, tableName)
+		n, err := s.Delete(bean)
+		s.Close()
+		affected += n
+		if err != nil {
+			return affected, err
+		}
+	}
+	return affected, nil
+}
+
+// shardOrder is a term of the ORDER BY of a sharded query
+type shardOrder struct {
+	col  *core.Column
+	desc bool
+}
+
+// parseShardOrders parses orderStr into the columns of table to merge the
+// records of the shards by
+func parseShardOrders(table *core.Table, orderStr string) ([]shardOrder, error) {
+	var orders []shardOrder
+	for _, term := range strings.Split(orderStr, ",") {
+		fields := strings.Fields(term)
+		if len(fields) == 0 {
+			continue
+		}
+		name := fields[0]
+		if i := strings.LastIndex(name, "."); i >= 0 {
+			name = name[i+1:]
+		}
+		col := table.GetColumn(strings.Trim(name, "`\"[]"))
+		if col == nil {
+			return nil, fmt.Errorf("can't merge the shards ordered by %v", term)
+		}
+		desc := len(fields) > 1 && strings.EqualFold(fields[len(fields)-1], "desc")
+		orders = append(orders, shardOrder{col, desc})
+	}
+	return orders, nil
+}
+
+// sortShardRecords sorts the records of the shards by orderStr
+func sortShardRecords(records reflect.Value, table *core.Table, orderStr string) error {
+	orders, err := parseShardOrders(table, orderStr)
+	if err != nil || len(orders) == 0 {
+		return err
+	}
+
+	values := make([][]reflect.Value, records.Len())
+	for i := range values {
+		record := reflect.Indirect(records.Index(i))
+		for _, order := range orders {
+			fieldValue, err := order.col.ValueOfV(&record)
+			if err != nil {
+				return err
+			}
+			values[i] = append(values[i], reflect.Indirect(*fieldValue))
+		}
+	}
+
+	index := make([]int, len(values))
+	for i := range index {
+		index[i] = i
+	}
+	sort.SliceStable(index, func(a, b int) bool {
+		for k, order := range orders {
+			c := compareShardValues(values[index[a]][k], values[index[b]][k])
+			if c != 0 {
+				return (c < 0) != order.desc
+			}
+		}
+		return false
+	})
+
+	sorted := reflect.MakeSlice(records.Type(), records.Len(), records.Len())
+	for i, j := range index {
+		sorted.Index(i).Set(records.Index(j))
+	}
+	reflect.Copy(records, sorted)
+	return nil
+}
+
+// compareShardValues compares the field values of two records, the invalid
+// ones, as nil pointers, first
+func compareShardValues(a, b reflect.Value) int {
+	if !a.IsValid() || !b.IsValid() {
+		switch {
+		case a.IsValid():
+			return 1
+		case b.IsValid():
+			return -1
+		}
+		return 0
+	}
+
+	switch a.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return compareOrdered(a.Int() < b.Int(), a.Int() > b.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return compareOrdered(a.Uint() < b.Uint(), a.Uint() > b.Uint())
+	case reflect.Float32, reflect.Float64:
+		return compareOrdered(a.Float() < b.Float(), a.Float() > b.Float())
+	case reflect.String:
+		return strings.Compare(a.String(), b.String())
+	case reflect.Bool:
+		return compareOrdered(!a.Bool() && b.Bool(), a.Bool() && !b.Bool())
+	}
+	if at, ok := a.Interface().(time.Time); ok {
+		bt := b.Interface().(time.Time)
+		return compareOrdered(at.Before(bt), at.After(bt))
+	}
+	return 0
+}
+
+func compareOrdered(less, greater bool) int {
+	switch {
+	case less:
+		return -1
+	case greater:
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,179 @@
+package xorm
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/go-xorm/builder"
+	"github.com/go-xorm/core"
+)
+
+func TestModShardingRule(t *testing.T) {
+	a, b := &Engine{}, &Engine{}
+	rule := &ModShardingRule{Column: "tenant_id", Targets: []ShardTarget{{a, "_0"}, {b, "_1"}}}
+
+	table := core.NewEmptyTable()
+	table.AddColumn(&core.Column{Name: "tenant_id", FieldName: "TenantId"})
+	if col := rule.KeyColumn(table); col != "tenant_id" {
+		t.Errorf("got key column %q", col)
+	}
+	if col := rule.KeyColumn(core.NewEmptyTable()); col != "" {
+		t.Errorf("got key column %q of a table not sharded", col)
+	}
+
+	var cases = []struct {
+		key      interface{}
+		expected ShardTarget
+	}{
+		{int64(4), ShardTarget{a, "_0"}},
+		{-3, ShardTarget{b, "_1"}},
+		{uint8(7), ShardTarget{b, "_1"}},
+	}
+	for _, c := range cases {
+		got, err := rule.Shard(table, c.key)
+		if err != nil || got != c.expected {
+			t.Errorf("%v: got %v %v, expected %v", c.key, got, err, c.expected)
+		}
+	}
+
+	s1, _ := rule.Shard(table, "tenant")
+	s2, _ := rule.Shard(table, "tenant")
+	if s1 != s2 {
+		t.Errorf("string key mapped to %v and %v", s1, s2)
+	}
+	if _, err := rule.Shard(table, 1.5); err == nil {
+		t.Errorf("float key should not be supported")
+	}
+}
+
+func TestSortShardRecords(t *testing.T) {
+	type order struct {
+		Id     int64
+		Amount int
+	}
+	table := core.NewEmptyTable()
+	table.AddColumn(&core.Column{Name: "id", FieldName: "Id"})
+	table.AddColumn(&core.Column{Name: "amount", FieldName: "Amount"})
+
+	records := []order{{1, 5}, {2, 7}, {3, 5}, {4, 1}}
+	if err := sortShardRecords(reflect.ValueOf(records), table, "`amount` DESC, id"); err != nil {
+		t.Fatal(err)
+	}
+	var ids []int64
+	for _, r := range records {
+		ids = append(ids, r.Id)
+	}
+	if !reflect.DeepEqual(ids, []int64{2, 1, 3, 4}) {
+		t.Errorf("got ids %v", ids)
+	}
+
+	if err := sortShardRecords(reflect.ValueOf(records), table, "rand()"); err == nil {
+		t.Errorf("unmapped order should not be merged")
+	}
+}
+
+type ShardOrder struct {
+	Id       int64 `xorm:"pk"`
+	TenantId int64
+	Amount   int
+}
+
+// newTestShards returns a ShardedEngine on two sqlite3 databases, the
+// odd tenants are on the second one
+func newTestShards(t *testing.T) (*ShardedEngine, []*Engine) {
+	var engines []*Engine
+	var targets []ShardTarget
+	for _, name := range []string{"shard0", "shard1"} {
+		engine, err := NewEngine("sqlite3", filepath.Join(t.TempDir(), name+".db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { engine.Close() })
+		if err = engine.Sync2(new(ShardOrder)); err != nil {
+			t.Fatal(err)
+		}
+		engines = append(engines, engine)
+		targets = append(targets, ShardTarget{Engine: engine})
+	}
+	return NewShardedEngine(&ModShardingRule{Column: "tenant_id", Targets: targets}), engines
+}
+
+func shardOrderIds(orders []ShardOrder) []int64 {
+	var ids []int64
+	for _, order := range orders {
+		ids = append(ids, order.Id)
+	}
+	return ids
+}
+
+func TestShardedEngine(t *testing.T) {
+	sharded, engines := newTestShards(t)
+
+	n, err := sharded.Insert([]*ShardOrder{{1, 1, 5}, {2, 2, 7}, {3, 3, 5}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 {
+		t.Errorf("inserted %v records", n)
+	}
+	if _, err = sharded.Insert([]ShardOrder{{4, 4, 1}}); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, expected := range [][]int64{{2, 4}, {1, 3}} {
+		var orders []ShardOrder
+		if err = engines[i].Asc("id").Find(&orders); err != nil {
+			t.Fatal(err)
+		}
+		if ids := shardOrderIds(orders); !reflect.DeepEqual(ids, expected) {
+			t.Errorf("shard %d has the records %v, expected %v", i, ids, expected)
+		}
+	}
+
+	var orders []ShardOrder
+	if err = sharded.Desc("amount").Asc("id").Limit(2, 1).Find(&orders); err != nil {
+		t.Fatal(err)
+	}
+	if ids := shardOrderIds(orders); !reflect.DeepEqual(ids, []int64{1, 3}) {
+		t.Errorf("found %v", ids)
+	}
+
+	if n, err = sharded.Count(new(ShardOrder)); err != nil || n != 4 {
+		t.Errorf("counted %v %v", n, err)
+	}
+	if n, err = sharded.Where(builder.Eq{"tenant_id": 3}).Count(new(ShardOrder)); err != nil || n != 1 {
+		t.Errorf("counted %v %v for a tenant", n, err)
+	}
+
+	var order = ShardOrder{Id: 3}
+	has, err := sharded.Get(&order)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !has || order.TenantId != 3 {
+		t.Errorf("got %+v", order)
+	}
+	order = ShardOrder{}
+	if has, err = sharded.Desc("amount").Get(&order); err != nil || !has || order.Id != 2 {
+		t.Errorf("got %+v %v, expected the record of the highest amount", order, err)
+	}
+
+	if n, err = sharded.Where(builder.Eq{"tenant_id": 1}).Update(&ShardOrder{Amount: 9}); err != nil || n != 1 {
+		t.Errorf("updated %v %v", n, err)
+	}
+	order = ShardOrder{}
+	if has, err = engines[1].ID(1).Get(&order); err != nil || !has || order.Amount != 9 {
+		t.Errorf("got %+v %v after the update", order, err)
+	}
+
+	if n, err = sharded.Delete(&ShardOrder{TenantId: 2}); err != nil || n != 1 {
+		t.Errorf("deleted %v %v", n, err)
+	}
+	if n, err = engines[0].Count(new(ShardOrder)); err != nil || n != 1 {
+		t.Errorf("the first shard has %v records %v", n, err)
+	}
+	if n, err = engines[1].Count(new(ShardOrder)); err != nil || n != 2 {
+		t.Errorf("the second shard has %v records %v", n, err)
+	}
+}
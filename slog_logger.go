@@ -0,0 +1,64 @@
+// Copyright 2017 The Xorm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.21
+// +build go1.21
+
+package xorm
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/go-xorm/core"
+)
+
+var _ ContextLogger = &SlogLogger{}
+
+// SlogLogger is a ContextLogger writing to a log/slog logger, whose handler
+// can write JSON. The statements are logged at slog.LevelInfo, or
+// slog.LevelError if they failed, with the context of their session.
+type SlogLogger struct {
+	logger *slog.Logger
+}
+
+// NewSlogLogger returns a ContextLogger writing to logger
+func NewSlogLogger(logger *slog.Logger) *SlogLogger {
+	return &SlogLogger{logger: logger}
+}
+
+// NewSlogHandlerLogger returns a ContextLogger writing to handler
+func NewSlogHandlerLogger(handler slog.Handler) *SlogLogger {
+	return NewSlogLogger(slog.New(handler))
+}
+
+// Log implement ContextLogger
+func (s *SlogLogger) Log(level core.LogLevel, msg string, fields ...interface{}) {
+	s.logger.Log(context.Background(), slogLevel(level), msg, fields...)
+}
+
+// LogSQL implement ContextLogger
+func (s *SlogLogger) LogSQL(ctx LogContext) {
+	level := slog.LevelInfo
+	if ctx.Err != nil {
+		level = slog.LevelError
+	}
+	c := ctx.Context
+	if c == nil {
+		c = context.Background()
+	}
+	s.logger.Log(c, level, "sql", ctx.Fields()...)
+}
+
+func slogLevel(level core.LogLevel) slog.Level {
+	switch level {
+	case core.LOG_DEBUG:
+		return slog.LevelDebug
+	case core.LOG_INFO:
+		return slog.LevelInfo
+	case core.LOG_WARNING:
+		return slog.LevelWarn
+	}
+	return slog.LevelError
+}
@@ -0,0 +1,39 @@
+//go:build go1.21
+// +build go1.21
+
+package xorm
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+)
+
+type slogContextKey struct{}
+
+// contextHandler records the value of slogContextKey in the contexts of the
+// records
+type contextHandler struct {
+	slog.Handler
+	values []interface{}
+}
+
+func (h *contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	h.values = append(h.values, ctx.Value(slogContextKey{}))
+	return nil
+}
+
+func TestSlogLoggerContext(t *testing.T) {
+	engine := newTestEngine(t)
+	handler := &contextHandler{Handler: slog.Default().Handler()}
+	engine.SetContextLogger(NewSlogHandlerLogger(handler))
+	engine.ShowSQL(true)
+
+	ctx := context.WithValue(context.Background(), slogContextKey{}, "request-1")
+	if _, err := engine.Context(ctx).Exec("CREATE TABLE slog_user (id INTEGER)"); err != nil {
+		t.Fatal(err)
+	}
+	if len(handler.values) != 1 || handler.values[0] != "request-1" {
+		t.Errorf("the statement is logged with %v", handler.values)
+	}
+}
@@ -0,0 +1,160 @@
+// Copyright 2017 The Xorm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xorm
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-xorm/core"
+)
+
+// SQLiteConfig are the pragmas applied on every new connection of a SQLite
+// engine, the zero values keep the defaults of the database
+type SQLiteConfig struct {
+	// JournalMode is one of DELETE, TRUNCATE, PERSIST, MEMORY, WAL and OFF
+	JournalMode string
+	// Synchronous is one of OFF, NORMAL, FULL and EXTRA
+	Synchronous string
+	// ForeignKeys enables the foreign key constraints
+	ForeignKeys bool
+	// BusyTimeout is how long a connection waits for a locked database
+	BusyTimeout time.Duration
+	// CacheSize is the number of pages of the cache, or its size in KiB if
+	// it's negative
+	CacheSize int
+}
+
+// pragmas returns the PRAGMA statements of config, the journal mode of a
+// read-only database can't be changed
+func (config *SQLiteConfig) pragmas(readOnly bool) ([]string, error) {
+	var pragmas []string
+	if config.JournalMode != "" && !readOnly {
+		mode := strings.ToUpper(config.JournalMode)
+		switch mode {
+		case "DELETE", "TRUNCATE", "PERSIST", "MEMORY", "WAL", "OFF":
+		default:
+			return nil, fmt.Errorf("unknown journal mode %v", config.JournalMode)
+		}
+		pragmas = append(pragmas, "PRAGMA journal_mode = "+mode)
+	}
+	if config.Synchronous != "" {
+		sync := strings.ToUpper(config.Synchronous)
+		switch sync {
+		case "OFF", "NORMAL", "FULL", "EXTRA":
+		default:
+			return nil, fmt.Errorf("unknown synchronous %v", config.Synchronous)
+		}
+		pragmas = append(pragmas, "PRAGMA synchronous = "+sync)
+	}
+	if config.ForeignKeys {
+		pragmas = append(pragmas, "PRAGMA foreign_keys = ON")
+	}
+	if config.BusyTimeout > 0 {
+		pragmas = append(pragmas, fmt.Sprintf("PRAGMA busy_timeout = %d", config.BusyTimeout/time.Millisecond))
+	}
+	if config.CacheSize != 0 {
+		pragmas = append(pragmas, fmt.Sprintf("PRAGMA cache_size = %d", config.CacheSize))
+	}
+	return pragmas, nil
+}
+
+// SetSQLiteConfig applies the pragmas of config on every new connection of
+// the SQLite engine. The engine's connection pool is replaced and closed, so
+// it must be called when setting up the engine, before any session is
+// created; it fails on a private in-memory database which would be lost with
+// the pool. The settings of the pool made by the engine's SetMaxOpenConns,
+// SetMaxIdleConns and SetConnMaxLifetime are kept.
+func (engine *Engine) SetSQLiteConfig(config SQLiteConfig) error {
+	dialect, ok := engine.dialect.(*sqlite3)
+	if !ok {
+		return errors.New("SQLite config on a " + string(engine.dialect.DBType()) + " engine")
+	}
+	if dialect.dsn.Memory && !dialect.dsn.SharedCache {
+		return errors.New("SQLite config on a private in-memory database, use cache=shared")
+	}
+	pragmas, err := config.pragmas(dialect.dsn.ReadOnly)
+	if err != nil {
+		return err
+	}
+
+	old := engine.db
+	db := core.FromDB(sql.OpenDB(&pragmaConnector{
+		driver:  old.Driver(),
+		dsn:     engine.DataSourceName(),
+		pragmas: pragmas,
+	}))
+	db.Mapper = old.Mapper
+	engine.mutex.RLock()
+	for _, set := range engine.poolSettings {
+		set(db)
+	}
+	engine.mutex.RUnlock()
+	if err = db.Ping(); err != nil {
+		db.Close()
+		return err
+	}
+
+	if err = dialect.Init(db, dialect.URI(), engine.DriverName(), engine.DataSourceName()); err != nil {
+		db.Close()
+		return err
+	}
+	engine.db = db
+	engine.logger.Infof("[sqlite] %v", strings.Join(pragmas, "; "))
+	return old.Close()
+}
+
+// pragmaConnector opens the connections of driver, running the pragmas on
+// each of them
+type pragmaConnector struct {
+	driver  driver.Driver
+	dsn     string
+	pragmas []string
+}
+
+func (c *pragmaConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.driver.Open(c.dsn)
+	if err != nil {
+		return nil, err
+	}
+	for _, pragma := range c.pragmas {
+		if err = execConn(ctx, conn, pragma); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+func (c *pragmaConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+// execConn executes query without args on the driver's connection
+func execConn(ctx context.Context, conn driver.Conn, query string) error {
+	if execer, ok := conn.(driver.ExecerContext); ok {
+		_, err := execer.ExecContext(ctx, query, nil)
+		if err != driver.ErrSkip {
+			return err
+		}
+	}
+
+	stmt, err := conn.Prepare(query)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	if s, ok := stmt.(driver.StmtExecContext); ok {
+		_, err = s.ExecContext(ctx, nil)
+		return err
+	}
+	_, err = stmt.Exec(nil)
+	return err
+}
@@ -0,0 +1,110 @@
+package xorm
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseSqlite3DSN(t *testing.T) {
+	var cases = []struct {
+		dataSource string
+		expected   sqlite3DSN
+	}{
+		{"./test.db", sqlite3DSN{Path: "./test.db"}},
+		{":memory:", sqlite3DSN{Path: ":memory:", Memory: true}},
+		{"file:test.db?cache=shared&mode=memory", sqlite3DSN{Path: "test.db", Memory: true, SharedCache: true}},
+		{"file:///var/my%20data.db?mode=ro", sqlite3DSN{Path: "/var/my data.db", ReadOnly: true}},
+		{"test.db?_query_only=true&_busy_timeout=5000", sqlite3DSN{Path: "test.db", ReadOnly: true}},
+	}
+	for _, c := range cases {
+		dsn, err := parseSqlite3DSN(c.dataSource)
+		if err != nil {
+			t.Errorf("%v: %v", c.dataSource, err)
+			continue
+		}
+		dsn.Params = nil
+		if !reflect.DeepEqual(*dsn, c.expected) {
+			t.Errorf("%v: got %+v, expected %+v", c.dataSource, *dsn, c.expected)
+		}
+	}
+}
+
+func TestSQLiteConfigPragmas(t *testing.T) {
+	config := SQLiteConfig{JournalMode: "wal", Synchronous: "normal", ForeignKeys: true, BusyTimeout: 5 * time.Second, CacheSize: -2000}
+	pragmas, err := config.pragmas(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"PRAGMA journal_mode = WAL",
+		"PRAGMA synchronous = NORMAL",
+		"PRAGMA foreign_keys = ON",
+		"PRAGMA busy_timeout = 5000",
+		"PRAGMA cache_size = -2000",
+	}
+	if !reflect.DeepEqual(pragmas, expected) {
+		t.Errorf("got %v", pragmas)
+	}
+
+	if pragmas, _ = config.pragmas(true); len(pragmas) != 4 {
+		t.Errorf("journal mode set on a read-only database: %v", pragmas)
+	}
+	if _, err = (&SQLiteConfig{JournalMode: "fast"}).pragmas(false); err == nil {
+		t.Errorf("unknown journal mode should fail")
+	}
+}
+
+func TestSetSQLiteConfig(t *testing.T) {
+	engine := newTestEngine(t)
+	engine.SetMaxIdleConns(0)
+	if err := engine.SetSQLiteConfig(SQLiteConfig{ForeignKeys: true, BusyTimeout: 3 * time.Second}); err != nil {
+		t.Fatal(err)
+	}
+
+	// without idle connections, every query runs on a new connection
+	var cases = []struct {
+		pragma, column, expected string
+	}{
+		{"foreign_keys", "foreign_keys", "1"},
+		{"busy_timeout", "timeout", "3000"},
+	}
+	for _, c := range cases {
+		results, err := engine.QueryString("PRAGMA " + c.pragma)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := results[0][c.column]; got != c.expected {
+			t.Errorf("%v is %v, expected %v", c.pragma, got, c.expected)
+		}
+	}
+	if closed := engine.DB().Stats().MaxIdleClosed; closed == 0 {
+		t.Error("the max idle connections weren't kept")
+	}
+}
+
+func TestSetSQLiteConfigMemory(t *testing.T) {
+	engine, err := NewEngine("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer engine.Close()
+	if err = engine.SetSQLiteConfig(SQLiteConfig{ForeignKeys: true}); err == nil {
+		t.Error("a private in-memory database would be lost")
+	}
+
+	shared, err := NewEngine("sqlite3", "file:TestSetSQLiteConfigMemory?mode=memory&cache=shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer shared.Close()
+	if _, err = shared.Exec("CREATE TABLE kept (id INTEGER)"); err != nil {
+		t.Fatal(err)
+	}
+	if err = shared.SetSQLiteConfig(SQLiteConfig{ForeignKeys: true}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = shared.Exec("INSERT INTO kept (id) VALUES (1)"); err != nil {
+		t.Errorf("the shared in-memory database was lost: %v", err)
+	}
+}
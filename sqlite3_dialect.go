@@ -149,9 +149,20 @@ var (
 
 type sqlite3 struct {
 	core.Base
+	// dsn is the parsed data source, the data source given to the dialects
+	// of the dumps is empty
+	dsn *sqlite3DSN
 }
 
 func (db *sqlite3) Init(d *core.DB, uri *core.Uri, drivername, dataSourceName string) error {
+	dsn, err := parseSqlite3DSN(dataSourceName)
+	if err != nil {
+		return err
+	}
+	if dsn.Path == "" && uri != nil {
+		dsn.Path = uri.DbName
+	}
+	db.dsn = dsn
 	return db.Base.Init(d, db, uri, drivername, dataSourceName)
 }
 
@@ -197,6 +208,17 @@ func (db *sqlite3) SupportInsertMany() bool {
 	return true
 }
 
+// UpsertSql returns an INSERT ... ON CONFLICT statement, which needs sqlite
+// 3.24.0 or later
+func (db *sqlite3) UpsertSql(tableName string, colNames []string, rows [][]string, conflictCols, updateCols []string) string {
+	return insertValuesSql(db, tableName, colNames, rows) + onConflictSql(db, conflictCols, updateCols)
+}
+
+// ReturningSql appends a RETURNING clause, which needs sqlite 3.35.0 or later
+func (db *sqlite3) ReturningSql(sqlStr string, cols []string, deleted bool) (string, bool) {
+	return sqlStr + returningClause(db, cols), false
+}
+
 func (db *sqlite3) IsReserved(name string) bool {
 	_, ok := sqlite3ReservedWords[name]
 	return ok
@@ -251,6 +273,34 @@ func (db *sqlite3) DropIndexSql(tableName string, index *core.Index) string {
 	return fmt.Sprintf("DROP INDEX %v", quote(idxName))
 }
 
+// RebuildTableSqls returns the statements to recreate a table according to its
+// new definition, since sqlite can neither drop nor alter a column nor add a
+// constraint. The data of the columns copyCols is copied to the new table.
+func (db *sqlite3) RebuildTableSqls(tableName string, createTable func(tableName string) string, copyCols, createIndexes []string) []string {
+	quote := db.Quote
+	tmpName := tableName + "__xorm_rebuild"
+
+	var cols = make([]string, 0, len(copyCols))
+	for _, colName := range copyCols {
+		cols = append(cols, quote(colName))
+	}
+	colStr := strings.Join(cols, ", ")
+
+	var sqls = []string{
+		createTable(tmpName),
+		fmt.Sprintf("INSERT INTO %v (%v) SELECT %v FROM %v", quote(tmpName), colStr, colStr, quote(tableName)),
+		fmt.Sprintf("DROP TABLE %v", quote(tableName)),
+		fmt.Sprintf("ALTER TABLE %v RENAME TO %v", quote(tmpName), quote(tableName)),
+	}
+	return append(sqls, createIndexes...)
+}
+
+// ForeignKeysSqls returns the pragmas around a table rebuild, the foreign
+// keys can only be turned off outside of a transaction
+func (db *sqlite3) ForeignKeysSqls() (enabled, off, on, check string) {
+	return "PRAGMA foreign_keys", "PRAGMA foreign_keys = OFF", "PRAGMA foreign_keys = ON", "PRAGMA foreign_key_check"
+}
+
 func (db *sqlite3) ForUpdateSql(query string) string {
 	return query
 }
@@ -277,13 +327,15 @@ func (db *sqlite3) IsColumnExist(tableName, colName string) (bool, error) {
 	return false, nil
 }
 
-func (db *sqlite3) GetColumns(tableName string) ([]string, map[string]*core.Column, error) {
+// tableDefs returns the column and constraint definitions of the CREATE
+// TABLE statement of the table
+func (db *sqlite3) tableDefs(tableName string) ([]string, error) {
 	args := []interface{}{tableName}
 	s := "SELECT sql FROM sqlite_master WHERE type='table' and name = ?"
 	db.LogSQL(s, args)
 	rows, err := db.DB().Query(s, args...)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 	defer rows.Close()
 
@@ -291,25 +343,35 @@ func (db *sqlite3) GetColumns(tableName string) ([]string, map[string]*core.Colu
 	for rows.Next() {
 		err = rows.Scan(&name)
 		if err != nil {
-			return nil, nil, err
+			return nil, err
 		}
 		break
 	}
 
 	if name == "" {
-		return nil, nil, errors.New("no table named " + tableName)
+		return nil, errors.New("no table named " + tableName)
 	}
 
 	nStart := strings.Index(name, "(")
 	nEnd := strings.LastIndex(name, ")")
-	reg := regexp.MustCompile(`[^\(,\)]*(\([^\(]*\))?`)
-	colCreates := reg.FindAllString(name[nStart+1:nEnd], -1)
+	return splitColumnDefs(name[nStart+1 : nEnd]), nil
+}
+
+func (db *sqlite3) GetColumns(tableName string) ([]string, map[string]*core.Column, error) {
+	colCreates, err := db.tableDefs(tableName)
+	if err != nil {
+		return nil, nil, err
+	}
+
 	cols := make(map[string]*core.Column)
 	colSeq := make([]string, 0)
+	reg := regexp.MustCompile(`,\s`)
 	for _, colStr := range colCreates {
-		reg = regexp.MustCompile(`,\s`)
 		colStr = reg.ReplaceAllString(colStr, ",")
 		fields := strings.Fields(strings.TrimSpace(colStr))
+		if len(fields) == 0 || isSqlite3TableConstraint(fields[0]) {
+			continue
+		}
 		col := new(core.Column)
 		col.Indexes = make(map[string]int)
 		col.Nullable = true
@@ -337,7 +399,7 @@ func (db *sqlite3) GetColumns(tableName string) ([]string, map[string]*core.Colu
 				col.DefaultIsEmpty = false
 			}
 		}
-		if !col.SQLType.IsNumeric() && !col.DefaultIsEmpty {
+		if !col.SQLType.IsNumeric() && !col.DefaultIsEmpty && !strings.HasPrefix(col.Default, "'") {
 			col.Default = "'" + col.Default + "'"
 		}
 		cols[col.Name] = col
@@ -346,6 +408,70 @@ func (db *sqlite3) GetColumns(tableName string) ([]string, map[string]*core.Colu
 	return colSeq, cols, nil
 }
 
+// isSqlite3TableConstraint tells if the definition starting with word is a
+// table constraint instead of a column
+func isSqlite3TableConstraint(word string) bool {
+	switch strings.ToUpper(word) {
+	case "CONSTRAINT", "PRIMARY", "FOREIGN", "UNIQUE", "CHECK":
+		return true
+	}
+	return false
+}
+
+// GetChecks returns the check constraints of the table, the unnamed ones
+// have an empty name
+func (db *sqlite3) GetChecks(tableName string) ([]*Check, error) {
+	defs, err := db.tableDefs(tableName)
+	if err != nil {
+		return nil, err
+	}
+
+	var checks []*Check
+	for _, def := range defs {
+		def = strings.TrimSpace(def)
+		var name string
+		if fields := strings.Fields(def); len(fields) > 2 && strings.EqualFold(fields[0], "CONSTRAINT") {
+			name = strings.Trim(fields[1], "`\"[]")
+			def = strings.TrimSpace(def[strings.Index(def, fields[1])+len(fields[1]):])
+		}
+		if strings.HasPrefix(strings.ToUpper(def), "CHECK") {
+			checks = append(checks, &Check{Name: name, Expr: trimCheckExpr(def)})
+		}
+	}
+	return checks, nil
+}
+
+// GetGeneratedColumns returns the generated columns of the table
+func (db *sqlite3) GetGeneratedColumns(tableName string) (map[string]*GeneratedColumn, error) {
+	defs, err := db.tableDefs(tableName)
+	if err != nil {
+		return nil, err
+	}
+
+	var generated = make(map[string]*GeneratedColumn)
+	for _, def := range defs {
+		fields := strings.Fields(def)
+		if len(fields) == 0 || isSqlite3TableConstraint(fields[0]) {
+			continue
+		}
+		upper := strings.ToUpper(def)
+		as := strings.Index(upper, " AS (")
+		if as < 0 {
+			continue
+		}
+		start := as + len(" AS ")
+		end := closingParen(def, start)
+		if end < 0 {
+			continue
+		}
+		generated[columnDefName(def)] = &GeneratedColumn{
+			Expr:   strings.TrimSpace(def[start+1 : end]),
+			Stored: strings.Contains(upper[end:], "STORED"),
+		}
+	}
+	return generated, nil
+}
+
 func (db *sqlite3) GetTables() ([]*core.Table, error) {
 	args := []interface{}{}
 	s := "SELECT name FROM sqlite_master WHERE type='table'"
@@ -373,22 +499,36 @@ func (db *sqlite3) GetTables() ([]*core.Table, error) {
 }
 
 func (db *sqlite3) GetIndexes(tableName string) (map[string]*core.Index, error) {
+	indexes, _, err := db.indexes(tableName)
+	return indexes, err
+}
+
+// GetIndexOptions returns the options of the indexes of the table
+func (db *sqlite3) GetIndexOptions(tableName string) (map[string]*IndexOptions, error) {
+	_, options, err := db.indexes(tableName)
+	return options, err
+}
+
+// indexes parses the indexes of the table and their options from their
+// definitions
+func (db *sqlite3) indexes(tableName string) (map[string]*core.Index, map[string]*IndexOptions, error) {
 	args := []interface{}{tableName}
 	s := "SELECT sql FROM sqlite_master WHERE type='index' and tbl_name = ?"
 	db.LogSQL(s, args)
 
 	rows, err := db.DB().Query(s, args...)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	defer rows.Close()
 
 	indexes := make(map[string]*core.Index, 0)
+	options := make(map[string]*IndexOptions)
 	for rows.Next() {
 		var tmpSql sql.NullString
 		err = rows.Scan(&tmpSql)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 
 		if !tmpSql.Valid {
@@ -416,20 +556,104 @@ func (db *sqlite3) GetIndexes(tableName string) (map[string]*core.Index, error)
 			index.Type = core.IndexType
 		}
 
-		nStart := strings.Index(sql, "(")
-		nEnd := strings.Index(sql, ")")
-		colIndexes := strings.Split(sql[nStart+1:nEnd], ",")
-
-		index.Cols = make([]string, 0)
-		for _, col := range colIndexes {
-			index.Cols = append(index.Cols, strings.Trim(col, "` []"))
-		}
+		cols, opts := parseIndexDef(sql)
+		index.Cols = append(make([]string, 0), cols...)
 		indexes[index.Name] = index
+		if opts != nil {
+			options[index.Name] = opts
+		}
 	}
 
-	return indexes, nil
+	return indexes, options, nil
+}
+
+// GetForeignKeys returns the foreign keys of the table, sqlite keeps no name
+// for them
+func (db *sqlite3) GetForeignKeys(tableName string) ([]*ForeignKey, error) {
+	s := "PRAGMA foreign_key_list(" + db.Quote(tableName) + ")"
+	db.LogSQL(s, nil)
+
+	rows, err := db.DB().Query(s)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var fks []*ForeignKey
+	var fk *ForeignKey
+	var lastID = -1
+	for rows.Next() {
+		var id, seq int
+		var refTable, col, onUpdate, onDelete, match string
+		var refCol sql.NullString
+		err = rows.Scan(&id, &seq, &refTable, &col, &refCol, &onUpdate, &onDelete, &match)
+		if err != nil {
+			return nil, err
+		}
+		if fk == nil || id != lastID {
+			fk = &ForeignKey{
+				RefTable: refTable,
+				OnDelete: normalizeReferentialAction(onDelete),
+				OnUpdate: normalizeReferentialAction(onUpdate),
+			}
+			fks = append(fks, fk)
+			lastID = id
+		}
+		fk.Cols = append(fk.Cols, col)
+		fk.RefCols = append(fk.RefCols, refCol.String)
+	}
+	return fks, rows.Err()
 }
 
 func (db *sqlite3) Filters() []core.Filter {
 	return []core.Filter{&core.IdFilter{}}
 }
+
+// IsRetryableError returns true when the database file is locked by another
+// connection (SQLITE_BUSY)
+func (db *sqlite3) IsRetryableError(err error) bool {
+	code, ok := driverErrorIntCode(err, "Code")
+	return ok && code == 5
+}
+
+// ConstraintError translates the extended result codes of SQLITE_CONSTRAINT,
+// the table and column are read from messages like
+// "UNIQUE constraint failed: user.name"
+func (db *sqlite3) ConstraintError(err error) *ConstraintError {
+	code, ok := driverErrorIntCode(err, "ExtendedCode")
+	if !ok {
+		return nil
+	}
+
+	ce := &ConstraintError{Err: err}
+	switch code {
+	case 2067, 1555: // SQLITE_CONSTRAINT_UNIQUE, SQLITE_CONSTRAINT_PRIMARYKEY
+		ce.Kind = ErrUniqueViolation
+	case 787: // SQLITE_CONSTRAINT_FOREIGNKEY
+		ce.Kind = ErrForeignKeyViolation
+	case 1299: // SQLITE_CONSTRAINT_NOTNULL
+		ce.Kind = ErrNotNullViolation
+	case 275: // SQLITE_CONSTRAINT_CHECK
+		ce.Kind = ErrCheckViolation
+	default:
+		return nil
+	}
+
+	msg := err.Error()
+	i := strings.Index(msg, "constraint failed: ")
+	if i < 0 {
+		return ce
+	}
+	detail := msg[i+len("constraint failed: "):]
+	if ce.Kind == ErrCheckViolation {
+		ce.Constraint = detail
+		return ce
+	}
+	// only the first column of a composite key is reported
+	detail = strings.SplitN(detail, ",", 2)[0]
+	if dot := strings.Index(detail, "."); dot > 0 {
+		ce.Table = detail[:dot]
+		ce.Column = detail[dot+1:]
+	}
+	return ce
+}
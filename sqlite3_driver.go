@@ -1,6 +1,9 @@
 package xorm
 
 import (
+	"net/url"
+	"strings"
+
 	"github.com/caser789/go-xorm/core"
 )
 
@@ -12,5 +15,67 @@ type sqlite3Driver struct {
 }
 
 func (p *sqlite3Driver) Parse(driverName, dataSourceName string) (*core.Uri, error) {
-	return &core.Uri{DbType: core.SQLITE, DbName: dataSourceName}, nil
+	dsn, err := parseSqlite3DSN(dataSourceName)
+	if err != nil {
+		return nil, err
+	}
+	return &core.Uri{DbType: core.SQLITE, DbName: dsn.Path}, nil
+}
+
+// sqlite3DSN is a parsed SQLite data source as "test.db", ":memory:" or
+// "file:test.db?cache=shared&mode=ro&_busy_timeout=5000"
+type sqlite3DSN struct {
+	// Path is the path of the database file, or ":memory:"
+	Path        string
+	Memory      bool
+	SharedCache bool
+	ReadOnly    bool
+	// Params are the options of the data source, including the ones the
+	// driver applies as pragmas like "_journal_mode"
+	Params url.Values
+}
+
+func parseSqlite3DSN(dataSourceName string) (*sqlite3DSN, error) {
+	dsn := &sqlite3DSN{Params: url.Values{}}
+	path := dataSourceName
+	if i := strings.IndexByte(dataSourceName, '?'); i >= 0 {
+		params, err := url.ParseQuery(dataSourceName[i+1:])
+		if err != nil {
+			return nil, err
+		}
+		dsn.Params = params
+		path = dataSourceName[:i]
+	}
+
+	if strings.HasPrefix(path, "file:") {
+		path = strings.TrimPrefix(path, "file:")
+		// the authority of "file://localhost/path" is ignored by SQLite
+		if strings.HasPrefix(path, "//") {
+			path = path[2:]
+			if i := strings.IndexByte(path, '/'); i >= 0 {
+				path = path[i:]
+			}
+		}
+		var err error
+		if path, err = url.PathUnescape(path); err != nil {
+			return nil, err
+		}
+	}
+	dsn.Path = path
+
+	mode := dsn.Params.Get("mode")
+	dsn.Memory = path == ":memory:" || mode == "memory"
+	dsn.SharedCache = dsn.Params.Get("cache") == "shared"
+	dsn.ReadOnly = mode == "ro" || dsn.Params.Get("immutable") == "1" ||
+		isTrueParam(dsn.Params.Get("_query_only"))
+	return dsn, nil
+}
+
+// isTrueParam tells if the boolean parameter of a data source is set
+func isTrueParam(s string) bool {
+	switch strings.ToLower(s) {
+	case "1", "yes", "true", "on":
+		return true
+	}
+	return false
 }
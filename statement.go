@@ -73,6 +73,13 @@ type Statement struct {
 	decrColumns     map[string]decrParam
 	exprColumns     map[string]exprParam
 	cond            builder.Cond
+	isUpsert        bool
+	conflictColumns []string
+	doNothing       bool
+	returning       bool
+	returnColumns   []string
+	resultTTL       time.Duration
+	partitions      []string
 }
 
 // Init reset all the statment's fields
@@ -111,6 +118,13 @@ func (statement *Statement) Init() {
 	statement.decrColumns = make(map[string]decrParam)
 	statement.exprColumns = make(map[string]exprParam)
 	statement.cond = builder.NewCond()
+	statement.isUpsert = false
+	statement.conflictColumns = nil
+	statement.doNothing = false
+	statement.returning = false
+	statement.returnColumns = nil
+	statement.resultTTL = 0
+	statement.partitions = nil
 }
 
 // NoAutoCondition if you do not want convert bean's field as query condition, then use this function
@@ -246,6 +260,9 @@ func buildUpdates(engine *Engine, table *core.Table, bean interface{},
 		if col.IsDeleted && !unscoped {
 			continue
 		}
+		if col.MapType == core.ONLYFROMDB {
+			continue
+		}
 		if use, ok := columnMap[col.Name]; ok && !use {
 			continue
 		}
@@ -1011,18 +1028,20 @@ func (statement *Statement) genColumnStr() string {
 }
 
 func (statement *Statement) genCreateTableSQL() string {
-	return statement.Engine.dialect.CreateTableSql(statement.RefTable, statement.TableName(),
+	return statement.Engine.createTableSQL(statement.Engine.dialect, statement.RefTable, statement.TableName(),
 		statement.StoreEngine, statement.Charset)
 }
 
+func (statement *Statement) genCommentSQL() []string {
+	return commentSQLs(statement.Engine.dialect, statement.RefTable, statement.TableName())
+}
+
 func (s *Statement) genIndexSQL() []string {
 	var sqls []string
 	tbName := s.TableName()
-	quote := s.Engine.Quote
-	for idxName, index := range s.RefTable.Indexes {
+	for _, index := range s.RefTable.Indexes {
 		if index.Type == core.IndexType {
-			sql := fmt.Sprintf("CREATE INDEX %v ON %v (%v);", quote(indexName(tbName, idxName)),
-				quote(tbName), quote(strings.Join(index.Cols, quote(","))))
+			sql := s.Engine.createIndexSQL(s.RefTable, tbName, index)
 			sqls = append(sqls, sql)
 		}
 	}
@@ -1038,7 +1057,7 @@ func (s *Statement) genUniqueSQL() []string {
 	tbName := s.TableName()
 	for _, index := range s.RefTable.Indexes {
 		if index.Type == core.UniqueType {
-			sql := s.Engine.dialect.CreateIndexSql(tbName, index)
+			sql := s.Engine.createIndexSQL(s.RefTable, tbName, index)
 			sqls = append(sqls, sql)
 		}
 	}
@@ -1066,6 +1085,7 @@ func (s *Statement) genDelIndexSQL() []string {
 
 func (statement *Statement) genGetSql(bean interface{}) (string, []interface{}) {
 	statement.setRefValue(rValue(bean))
+	statement.resolveTableName(bean, "get")
 
 	var table = statement.RefTable
 	var addedTableName = (len(statement.JoinStr) > 0)
@@ -1113,7 +1133,7 @@ func (statement *Statement) genGetSql(bean interface{}) (string, []interface{})
 func (s *Statement) genAddColumnStr(col *core.Column) (string, []interface{}) {
 	quote := s.Engine.Quote
 	sql := fmt.Sprintf("ALTER TABLE %v ADD %v;", quote(s.TableName()),
-		col.String(s.Engine.dialect))
+		s.Engine.columnSQL(s.Engine.dialect, s.RefTable, col))
 	return sql, []interface{}{}
 }
 
@@ -1124,6 +1144,7 @@ func (statement *Statement) buildConds(table *core.Table, bean interface{}, incl
 
 func (statement *Statement) genCountSql(bean interface{}) (string, []interface{}) {
 	statement.setRefValue(rValue(bean))
+	statement.resolveTableName(bean, "count")
 
 	var autoCond builder.Cond
 	if !statement.noAutoCondition {
@@ -1143,6 +1164,7 @@ func (statement *Statement) genCountSql(bean interface{}) (string, []interface{}
 
 func (statement *Statement) genSumSql(bean interface{}, columns ...string) (string, []interface{}) {
 	statement.setRefValue(rValue(bean))
+	statement.resolveTableName(bean, "sum")
 
 	var addedTableName = (len(statement.JoinStr) > 0)
 	var autoCond builder.Cond
@@ -1183,6 +1205,12 @@ func (statement *Statement) genSelectSQL(columnStr, condSQL string) (a string) {
 	var whereStr = buf.String()
 
 	var fromStr = " FROM " + quote(statement.TableName())
+	if len(statement.partitions) > 0 {
+		fromStr = " FROM " + statement.partitionsUnion()
+		if statement.TableAlias == "" {
+			fromStr += " " + quote(statement.TableName())
+		}
+	}
 	if statement.TableAlias != "" {
 		if dialect.DBType() == core.ORACLE {
 			fromStr += " " + quote(statement.TableAlias)
@@ -0,0 +1,867 @@
+// Copyright 2017 The Xorm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xorm
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/go-xorm/core"
+)
+
+// SyncChangeType is the kind of a difference between a struct and its table
+type SyncChangeType int
+
+// all the kinds of SyncChange
+const (
+	SyncCreateTable SyncChangeType = iota + 1
+	SyncAddColumn
+	SyncModifyColumn
+	SyncColumnDefault
+	SyncColumnNullable
+	SyncExtraColumn
+	SyncAddIndex
+	SyncDropIndex
+	SyncDropColumn
+	SyncRebuildTable
+	SyncAddForeignKey
+	SyncAddCheck
+)
+
+var syncChangeTypeNames = map[SyncChangeType]string{
+	SyncCreateTable:    "create table",
+	SyncAddColumn:      "add column",
+	SyncModifyColumn:   "modify column",
+	SyncColumnDefault:  "column default",
+	SyncColumnNullable: "column nullable",
+	SyncExtraColumn:    "extra column",
+	SyncAddIndex:       "add index",
+	SyncDropIndex:      "drop index",
+	SyncDropColumn:     "drop column",
+	SyncRebuildTable:   "rebuild table",
+	SyncAddForeignKey:  "add foreign key",
+	SyncAddCheck:       "add check",
+}
+
+func (t SyncChangeType) String() string {
+	if name, ok := syncChangeTypeNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("SyncChangeType(%d)", int(t))
+}
+
+// SyncOptions enables the destructive changes Sync2 never does. Sync2 itself
+// only drops the indexes which are not in the struct any more.
+type SyncOptions struct {
+	// DropColumns drops the columns which have no related struct field
+	DropColumns bool
+	// DropIndexes drops the indexes which are not in the struct tags
+	DropIndexes bool
+	// AlterTypes changes the columns' type to the struct one
+	AlterTypes bool
+	// AlterNullability changes the columns' nullability to the struct one
+	AlterNullability bool
+	// AddConstraints adds the foreign keys and the checks of the struct on
+	// the dialects which rebuild the table to add them, as sqlite. The other
+	// dialects add them in any case.
+	AddConstraints bool
+}
+
+var sync2Options = &SyncOptions{DropIndexes: true}
+
+// tableRebuilder is implemented by the dialects which can't drop or alter a
+// column, they recreate the table and copy the data instead. createTable
+// returns the statement creating the new table under the given name,
+// copyCols are the columns whose data is copied and createIndexes the
+// statements creating the indexes of the new table. The statements run in a
+// transaction with the foreign keys off.
+type tableRebuilder interface {
+	RebuildTableSqls(tableName string, createTable func(tableName string) string, copyCols, createIndexes []string) []string
+	// ForeignKeysSqls returns the statements telling if the foreign keys are
+	// enforced, turning them off and on, and listing their violations
+	ForeignKeysSqls() (enabled, off, on, check string)
+}
+
+// columnAlterer is implemented by the dialects whose ModifyColumnSql can't
+// change both the type and the nullability of a column.
+type columnAlterer interface {
+	AlterColumnSqls(tableName string, col *core.Column) []string
+}
+
+// SyncChange is one difference found between a struct and its database table.
+// SQLs are the statements Sync executes to apply it, they are empty when
+// Sync only warns about the difference.
+type SyncChange struct {
+	Type   SyncChangeType
+	Table  string
+	Column string
+	Index  string
+	// Constraint is the name of the constraint of a foreign key or a check
+	// change
+	Constraint string
+	// From is the database side and To the struct side of a column change
+	From string
+	To   string
+	SQLs []string
+	// Rebuild is true when the change is applied by the SyncRebuildTable
+	// change of its table instead of its own SQLs
+	Rebuild bool
+
+	table *core.Table
+}
+
+// IsWarning returns true if Sync will not change the database for this change
+func (change *SyncChange) IsWarning() bool {
+	return len(change.SQLs) == 0 && !change.Rebuild
+}
+
+func (change *SyncChange) String() string {
+	switch change.Type {
+	case SyncCreateTable:
+		return fmt.Sprintf("Table %s does not exist", change.Table)
+	case SyncAddColumn:
+		return fmt.Sprintf("Table %s has no column %s", change.Table, change.Column)
+	case SyncModifyColumn:
+		return fmt.Sprintf("Table %s column %s db type is %s, struct type is %s",
+			change.Table, change.Column, change.From, change.To)
+	case SyncColumnDefault:
+		return fmt.Sprintf("Table %s Column %s db default is %s, struct default is %s",
+			change.Table, change.Column, change.From, change.To)
+	case SyncColumnNullable:
+		return fmt.Sprintf("Table %s Column %s db nullable is %s, struct nullable is %s",
+			change.Table, change.Column, change.From, change.To)
+	case SyncExtraColumn:
+		return fmt.Sprintf("Table %s has column %s but struct has not related field", change.Table, change.Column)
+	case SyncAddIndex:
+		return fmt.Sprintf("Table %s has no index %s", change.Table, change.Index)
+	case SyncDropIndex:
+		return fmt.Sprintf("Table %s index %s is not in struct", change.Table, change.Index)
+	case SyncDropColumn:
+		return fmt.Sprintf("Table %s column %s is dropped", change.Table, change.Column)
+	case SyncRebuildTable:
+		return fmt.Sprintf("Table %s is rebuilt", change.Table)
+	case SyncAddForeignKey:
+		return fmt.Sprintf("Table %s has no foreign key %s", change.Table, change.Constraint)
+	case SyncAddCheck:
+		return fmt.Sprintf("Table %s has no check %s", change.Table, change.Constraint)
+	}
+	return fmt.Sprintf("Table %s %v", change.Table, change.Type)
+}
+
+// SyncPlan is the list of changes, in execution order, which Sync2 would do
+// to synchronize the structs to the database.
+type SyncPlan struct {
+	Changes []*SyncChange
+}
+
+// SQLs returns all the statements of the plan in execution order
+func (plan *SyncPlan) SQLs() []string {
+	var sqls []string
+	for _, change := range plan.Changes {
+		sqls = append(sqls, change.SQLs...)
+	}
+	return sqls
+}
+
+// Warnings returns the changes Sync2 only warns about
+func (plan *SyncPlan) Warnings() []*SyncChange {
+	var changes []*SyncChange
+	for _, change := range plan.Changes {
+		if change.IsWarning() {
+			changes = append(changes, change)
+		}
+	}
+	return changes
+}
+
+func (plan *SyncPlan) add(change *SyncChange) {
+	plan.Changes = append(plan.Changes, change)
+}
+
+// SyncPlan compares the structs with the database tables and returns the
+// changes Sync2 would apply, without executing anything.
+func (session *Session) SyncPlan(beans ...interface{}) (*SyncPlan, error) {
+	return session.SyncPlanWithOptions(*sync2Options, beans...)
+}
+
+// SyncPlanWithOptions returns the changes SyncWithOptions would apply,
+// without executing anything.
+func (session *Session) SyncPlanWithOptions(opts SyncOptions, beans ...interface{}) (*SyncPlan, error) {
+	defer session.resetStatement()
+	if session.IsAutoClose {
+		defer session.Close()
+	}
+
+	return session.syncPlan(&opts, beans...)
+}
+
+// SyncWithOptions synchronizes structs to database tables like Sync2, and
+// also applies the destructive changes enabled by opts.
+func (session *Session) SyncWithOptions(opts SyncOptions, beans ...interface{}) error {
+	defer session.resetStatement()
+	if session.IsAutoClose {
+		defer session.Close()
+	}
+
+	return session.sync(&opts, beans...)
+}
+
+func (session *Session) sync(opts *SyncOptions, beans ...interface{}) error {
+	plan, err := session.syncPlan(opts, beans...)
+	if err != nil {
+		return err
+	}
+
+	for _, change := range plan.Changes {
+		if err = session.applySyncChange(change); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (session *Session) syncPlan(opts *SyncOptions, beans ...interface{}) (*SyncPlan, error) {
+	engine := session.Engine
+	rebuilder, canRebuild := engine.dialect.(tableRebuilder)
+
+	tables, err := engine.DBMetas()
+	if err != nil {
+		return nil, err
+	}
+
+	var plan = new(SyncPlan)
+
+	for _, target := range session.syncTables(beans) {
+		v := rValue(target.bean)
+		table := engine.mapType(v)
+		var tbName = session.tbNameNoSchema(table)
+		if target.tableName != "" {
+			tbName = target.tableName
+		}
+
+		var oriTable *core.Table
+		for _, tb := range tables {
+			if equalNoCase(tb.Name, tbName) {
+				oriTable = tb
+				break
+			}
+		}
+
+		var statement = session.Statement
+		statement.RefTable = table
+		statement.tableName = engine.tbName(v)
+		if target.tableName != "" {
+			statement.AltTableName = target.tableName
+		}
+
+		if oriTable == nil {
+			sqls := []string{statement.genCreateTableSQL()}
+			sqls = append(sqls, statement.genCommentSQL()...)
+			sqls = append(sqls, statement.genUniqueSQL()...)
+			sqls = append(sqls, statement.genIndexSQL()...)
+			plan.add(session.newSyncChange(&SyncChange{
+				Type:  SyncCreateTable,
+				Table: tbName,
+				SQLs:  sqls,
+			}, table))
+			continue
+		}
+
+		statement.tableName = tbName
+		var tableChanges = len(plan.Changes)
+		var needRebuild bool
+		var alter = func(change *SyncChange, col *core.Column) {
+			if canRebuild {
+				change.Rebuild = true
+				needRebuild = true
+			} else {
+				change.SQLs = session.alterColumnSQLs(tbName, col)
+			}
+		}
+
+		for _, colName := range table.ColumnsSeq() {
+			col := table.GetColumn(colName)
+			var oriCol *core.Column
+			for _, col2 := range oriTable.Columns() {
+				if equalNoCase(col.Name, col2.Name) {
+					oriCol = col2
+					break
+				}
+			}
+
+			if oriCol == nil {
+				sqlStr, _ := statement.genAddColumnStr(col)
+				plan.add(session.newSyncChange(&SyncChange{
+					Type:   SyncAddColumn,
+					Table:  tbName,
+					Column: col.Name,
+					SQLs:   append([]string{sqlStr}, columnCommentSQL(engine.dialect, tbName, col)...),
+				}, table))
+				continue
+			}
+
+			if change := session.syncColumnType(table, tbName, col, oriCol); change != nil {
+				if opts.AlterTypes && len(change.SQLs) == 0 {
+					alter(change, col)
+					session.newSyncChange(change, table)
+				}
+				plan.add(change)
+			}
+			if col.Default != oriCol.Default {
+				plan.add(session.newSyncChange(&SyncChange{
+					Type:   SyncColumnDefault,
+					Table:  tbName,
+					Column: col.Name,
+					From:   oriCol.Default,
+					To:     col.Default,
+				}, table))
+			}
+			if col.Nullable != oriCol.Nullable {
+				change := &SyncChange{
+					Type:   SyncColumnNullable,
+					Table:  tbName,
+					Column: col.Name,
+					From:   fmt.Sprintf("%v", oriCol.Nullable),
+					To:     fmt.Sprintf("%v", col.Nullable),
+				}
+				if opts.AlterNullability {
+					alter(change, col)
+				}
+				plan.add(session.newSyncChange(change, table))
+			}
+		}
+
+		for _, colName := range oriTable.ColumnsSeq() {
+			if table.GetColumn(colName) != nil {
+				continue
+			}
+			change := &SyncChange{
+				Type:   SyncExtraColumn,
+				Table:  tbName,
+				Column: colName,
+			}
+			if opts.DropColumns {
+				change.Type = SyncDropColumn
+				if canRebuild {
+					change.Rebuild = true
+					needRebuild = true
+				} else {
+					change.SQLs = []string{fmt.Sprintf("ALTER TABLE %v DROP COLUMN %v",
+						engine.Quote(tbName), engine.Quote(colName))}
+				}
+			}
+			plan.add(session.newSyncChange(change, table))
+		}
+
+		var foundIndexNames = make(map[string]bool)
+		var addedNames = make(map[string]*core.Index)
+
+		oriIndexNames := sortedIndexNames(oriTable.Indexes)
+		for _, name := range sortedIndexNames(table.Indexes) {
+			index := table.Indexes[name]
+			idxOpts := engine.IndexOptions(table, name)
+			var oriIndex *core.Index
+			var oriIdxOpts *IndexOptions
+			for _, name2 := range oriIndexNames {
+				index2 := oriTable.Indexes[name2]
+				oriIdxOpts = engine.IndexOptions(oriTable, name2)
+				if sameIndexCols(index, idxOpts, index2, oriIdxOpts) {
+					oriIndex = index2
+					foundIndexNames[name2] = true
+					break
+				}
+			}
+
+			if oriIndex != nil && !sameIndexOptions(index, idxOpts, oriIndex, oriIdxOpts) {
+				plan.add(session.newSyncChange(&SyncChange{
+					Type:  SyncDropIndex,
+					Table: tbName,
+					Index: oriIndex.Name,
+					SQLs:  []string{engine.dialect.DropIndexSql(tbName, oriIndex)},
+				}, table))
+				oriIndex = nil
+			}
+
+			if oriIndex == nil {
+				addedNames[name] = index
+			}
+		}
+
+		for _, name2 := range oriIndexNames {
+			if foundIndexNames[name2] {
+				continue
+			}
+			change := &SyncChange{
+				Type:  SyncDropIndex,
+				Table: tbName,
+				Index: name2,
+			}
+			if opts.DropIndexes {
+				change.SQLs = []string{engine.dialect.DropIndexSql(tbName, oriTable.Indexes[name2])}
+			}
+			plan.add(session.newSyncChange(change, table))
+		}
+
+		for _, name := range sortedIndexNames(addedNames) {
+			index := addedNames[name]
+			if index.Type != core.UniqueType && index.Type != core.IndexType {
+				continue
+			}
+			plan.add(session.newSyncChange(&SyncChange{
+				Type:  SyncAddIndex,
+				Table: tbName,
+				Index: name,
+				SQLs:  []string{engine.createIndexSQL(table, tbName, index)},
+			}, table))
+		}
+
+		oriForeignKeys := engine.ForeignKeys(oriTable)
+		for _, fk := range engine.ForeignKeys(table) {
+			var found bool
+			for _, oriFk := range oriForeignKeys {
+				if fk.Equal(oriFk) {
+					found = true
+					break
+				}
+			}
+			if found {
+				continue
+			}
+			change := &SyncChange{
+				Type:       SyncAddForeignKey,
+				Table:      tbName,
+				Constraint: fk.ConstraintName(tbName),
+			}
+			if !canRebuild {
+				change.SQLs = []string{engine.addForeignKeySQL(tbName, fk)}
+			} else if opts.AddConstraints {
+				change.Rebuild = true
+				needRebuild = true
+			}
+			plan.add(session.newSyncChange(change, table))
+		}
+
+		oriChecks := engine.Checks(oriTable)
+		for _, check := range engine.Checks(table) {
+			var found bool
+			for _, oriCheck := range oriChecks {
+				if equalNoCase(check.ConstraintName(tbName), oriCheck.Name) {
+					found = true
+					break
+				}
+			}
+			if found {
+				continue
+			}
+			change := &SyncChange{
+				Type:       SyncAddCheck,
+				Table:      tbName,
+				Constraint: check.ConstraintName(tbName),
+			}
+			if !canRebuild {
+				change.SQLs = []string{engine.addCheckSQL(tbName, check)}
+			} else if opts.AddConstraints {
+				change.Rebuild = true
+				needRebuild = true
+			}
+			plan.add(session.newSyncChange(change, table))
+		}
+
+		if needRebuild {
+			rebuilt, schema := engine.rebuiltTable(table, oriTable, opts)
+			// the columns added by the plan exist when the table is rebuilt
+			var copyCols []string
+			for _, colName := range rebuilt.ColumnsSeq() {
+				if schema.generated[strings.ToLower(colName)] == nil {
+					copyCols = append(copyCols, colName)
+				}
+			}
+			createTable := func(name string) string {
+				return engine.createTableSQLAs(engine.dialect, rebuilt, schema, name, tbName, "", "")
+			}
+
+			createIndexes := engine.createIndexSQLs(table, tbName)
+			for _, name2 := range oriIndexNames {
+				index2 := oriTable.Indexes[name2]
+				if !foundIndexNames[name2] && !opts.DropIndexes && hasIndexCols(rebuilt, index2) {
+					createIndexes = append(createIndexes, engine.createIndexSQL(oriTable, tbName, index2))
+				}
+			}
+			// the rebuild creates the indexes and the constraints of the new
+			// table itself
+			for _, change := range plan.Changes[tableChanges:] {
+				switch change.Type {
+				case SyncAddIndex, SyncDropIndex:
+					change.Rebuild = len(change.SQLs) > 0
+					change.SQLs = nil
+				case SyncAddForeignKey, SyncAddCheck:
+					change.Rebuild = true
+				}
+			}
+
+			plan.add(session.newSyncChange(&SyncChange{
+				Type:  SyncRebuildTable,
+				Table: tbName,
+				SQLs:  rebuilder.RebuildTableSqls(tbName, createTable, copyCols, createIndexes),
+			}, table))
+		}
+	}
+
+	return plan, nil
+}
+
+// rebuiltTable returns the table and the schema created by the rebuild of
+// oriTable for table. They keep the columns of oriTable unless opts drops
+// them, the types and nullability of its columns unless opts alters them,
+// and its constraints on the kept columns.
+func (engine *Engine) rebuiltTable(table, oriTable *core.Table, opts *SyncOptions) (*core.Table, *tableSchema) {
+	schema, oriSchema := engine.tableSchema(table), engine.tableSchema(oriTable)
+	var rebuilt = core.NewEmptyTable()
+	rebuilt.Name = table.Name
+	var rebuiltSchema = &tableSchema{
+		foreignKeys: append([]*ForeignKey(nil), schema.foreignKeys...),
+		checks:      append([]*Check(nil), schema.checks...),
+		generated:   make(map[string]*GeneratedColumn),
+	}
+
+	for _, col := range table.Columns() {
+		if oriCol := oriTable.GetColumn(col.Name); oriCol != nil {
+			col = rebuiltColumn(col, oriCol, opts)
+		}
+		rebuilt.AddColumn(col)
+		if gen := schema.generated[strings.ToLower(col.Name)]; gen != nil {
+			rebuiltSchema.generated[strings.ToLower(col.Name)] = gen
+		}
+	}
+	if !opts.DropColumns {
+		for _, oriCol := range oriTable.Columns() {
+			if table.GetColumn(oriCol.Name) != nil {
+				continue
+			}
+			rebuilt.AddColumn(oriCol)
+			if gen := oriSchema.generated[strings.ToLower(oriCol.Name)]; gen != nil {
+				rebuiltSchema.generated[strings.ToLower(oriCol.Name)] = gen
+			}
+		}
+	}
+
+	for _, oriFk := range oriSchema.foreignKeys {
+		var found bool
+		for _, fk := range schema.foreignKeys {
+			if fk.Equal(oriFk) {
+				found = true
+				break
+			}
+		}
+		if !found && hasCols(rebuilt, oriFk.Cols) {
+			rebuiltSchema.foreignKeys = append(rebuiltSchema.foreignKeys, oriFk)
+		}
+	}
+
+	var droppedCols []string
+	for _, oriCol := range oriTable.Columns() {
+		if rebuilt.GetColumn(oriCol.Name) == nil {
+			droppedCols = append(droppedCols, oriCol.Name)
+		}
+	}
+	for _, oriCheck := range oriSchema.checks {
+		var found bool
+		for _, check := range schema.checks {
+			if equalNoCase(check.ConstraintName(oriTable.Name), oriCheck.Name) {
+				found = true
+				break
+			}
+		}
+		if !found && !refersToCols(oriCheck.Expr, droppedCols) {
+			rebuiltSchema.checks = append(rebuiltSchema.checks, oriCheck)
+		}
+	}
+	return rebuilt, rebuiltSchema
+}
+
+// rebuiltColumn returns col as created by a rebuild, with the type and the
+// nullability of oriCol unless opts alters them. The default is always the
+// one of oriCol, since Sync never changes it.
+func rebuiltColumn(col, oriCol *core.Column, opts *SyncOptions) *core.Column {
+	var rebuilt = *col
+	if !opts.AlterTypes {
+		rebuilt.SQLType, rebuilt.Length, rebuilt.Length2 = oriCol.SQLType, oriCol.Length, oriCol.Length2
+	}
+	if !opts.AlterNullability {
+		rebuilt.Nullable = oriCol.Nullable
+	}
+	rebuilt.Default, rebuilt.DefaultIsEmpty = oriCol.Default, oriCol.DefaultIsEmpty
+	return &rebuilt
+}
+
+// hasIndexCols tells if the columns of index are in table
+func hasIndexCols(table *core.Table, index *core.Index) bool {
+	for _, col := range index.Cols {
+		if !isIndexExpr(col) && table.GetColumn(col) == nil {
+			return false
+		}
+	}
+	return true
+}
+
+// refersToCols tells if the expression expr refers to one of the columns
+// cols
+func refersToCols(expr string, cols []string) bool {
+	for _, col := range cols {
+		if regexp.MustCompile(`(?i)\b` + regexp.QuoteMeta(col) + `\b`).MatchString(expr) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasCols tells if the columns cols are in table
+func hasCols(table *core.Table, cols []string) bool {
+	for _, col := range cols {
+		if table.GetColumn(col) == nil {
+			return false
+		}
+	}
+	return true
+}
+
+// sortedIndexNames returns the names of indexes in alphabetical order, for the
+// changes of a plan not to depend on the order of a map
+func sortedIndexNames(indexes map[string]*core.Index) []string {
+	var names = make([]string, 0, len(indexes))
+	for name := range indexes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// alterColumnSQLs returns the statements to change a column's type and
+// nullability to the struct ones
+func (session *Session) alterColumnSQLs(tableName string, col *core.Column) []string {
+	if alterer, ok := session.Engine.dialect.(columnAlterer); ok {
+		return alterer.AlterColumnSqls(tableName, col)
+	}
+	return []string{session.Engine.dialect.ModifyColumnSql(tableName, col)}
+}
+
+// syncColumnType compares the struct column's type with the database one, it
+// returns nil when there is nothing to report.
+func (session *Session) syncColumnType(table *core.Table, tbName string, col, oriCol *core.Column) *SyncChange {
+	engine := session.Engine
+	expectedType := engine.dialect.SqlType(col)
+	curType := engine.dialect.SqlType(oriCol)
+
+	var change = &SyncChange{
+		Type:   SyncModifyColumn,
+		Table:  tbName,
+		Column: col.Name,
+		From:   curType,
+		To:     expectedType,
+	}
+	var modify = []string{engine.dialect.ModifyColumnSql(tbName, col)}
+
+	if expectedType != curType {
+		if expectedType == core.Text &&
+			strings.HasPrefix(curType, core.Varchar) {
+			// currently only support mysql & postgres
+			if engine.dialect.DBType() == core.MYSQL ||
+				engine.dialect.DBType() == core.POSTGRES {
+				change.SQLs = modify
+			}
+			return session.newSyncChange(change, table)
+		} else if strings.HasPrefix(curType, core.Varchar) && strings.HasPrefix(expectedType, core.Varchar) {
+			if engine.dialect.DBType() == core.MYSQL && oriCol.Length < col.Length {
+				change.SQLs = modify
+				return session.newSyncChange(change, table)
+			}
+		} else if !(strings.HasPrefix(curType, expectedType) && curType[len(expectedType)] == '(') {
+			return session.newSyncChange(change, table)
+		}
+	} else if expectedType == core.Varchar {
+		if engine.dialect.DBType() == core.MYSQL && oriCol.Length < col.Length {
+			change.From = fmt.Sprintf("%s(%d)", curType, oriCol.Length)
+			change.To = fmt.Sprintf("%s(%d)", expectedType, col.Length)
+			change.SQLs = modify
+			return session.newSyncChange(change, table)
+		}
+	}
+	return nil
+}
+
+// newSyncChange runs the dialect's filters on the change's SQLs, so that they
+// are exactly what will be sent to the database.
+func (session *Session) newSyncChange(change *SyncChange, table *core.Table) *SyncChange {
+	change.table = table
+	for i, sqlStr := range change.SQLs {
+		for _, filter := range session.Engine.dialect.Filters() {
+			sqlStr = filter.Do(sqlStr, session.Engine.dialect, table)
+		}
+		change.SQLs[i] = sqlStr
+	}
+	return change
+}
+
+// applySyncChange executes the change's SQLs, or logs a warning if it has none
+func (session *Session) applySyncChange(change *SyncChange) error {
+	if change.IsWarning() {
+		session.Engine.logger.Warn(change.String())
+		return nil
+	}
+
+	if change.Type == SyncModifyColumn {
+		session.Engine.logger.Infof("Table %s column %s change type from %s to %s",
+			change.Table, change.Column, change.From, change.To)
+	}
+
+	session.Statement.RefTable = change.table
+	if change.Type == SyncRebuildTable {
+		return session.rebuildTable(change)
+	}
+	for _, sqlStr := range change.SQLs {
+		if _, err := session.exec(sqlStr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sqlConn is the connection or the transaction a table rebuild runs on
+type sqlConn interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// rebuildTable executes the SQLs of a table rebuild the way sqlite documents
+// it. Dropping the table would delete or update the rows referencing it, so
+// the foreign keys are turned off outside of a transaction, the SQLs run in a
+// transaction which is committed once the foreign keys are checked, and the
+// foreign keys are turned back on. In the session's transaction, where they
+// can't be turned off, the rebuild is refused unless they are off already.
+func (session *Session) rebuildTable(change *SyncChange) (err error) {
+	enabledSQL, offSQL, onSQL, checkSQL := session.Engine.dialect.(tableRebuilder).ForeignKeysSqls()
+
+	if !session.IsAutoCommit {
+		enabled, err := session.foreignKeysEnabled(session.Tx.Tx, enabledSQL)
+		if err != nil {
+			return err
+		}
+		if enabled {
+			return fmt.Errorf("table %s can't be rebuilt in a transaction with the foreign keys on", change.Table)
+		}
+		return session.execOn(session.Tx.Tx, change.SQLs...)
+	}
+
+	conn, err := session.DB().Conn(session.ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	enabled, err := session.foreignKeysEnabled(conn, enabledSQL)
+	if err != nil {
+		return err
+	}
+	if enabled {
+		if err = session.execOn(conn, offSQL); err != nil {
+			return err
+		}
+		defer func() {
+			if err2 := session.execOn(conn, onSQL); err == nil {
+				err = err2
+			}
+		}()
+	}
+
+	tx, err := conn.BeginTx(session.ctx, nil)
+	if err != nil {
+		return err
+	}
+	session.saveLastSQL("BEGIN TRANSACTION")
+	err = session.execOn(tx, change.SQLs...)
+	if err == nil && enabled {
+		err = session.checkForeignKeys(tx, checkSQL)
+	}
+	if err != nil {
+		session.saveLastSQL("ROLLBACK")
+		tx.Rollback()
+		return err
+	}
+	session.saveLastSQL("COMMIT")
+	return tx.Commit()
+}
+
+// execOn executes sqls on conn as exec does on the session's connection
+func (session *Session) execOn(conn sqlConn, sqls ...string) error {
+	for _, sqlStr := range sqls {
+		session.saveLastSQL(sqlStr)
+		_, err := session.Engine.logSQLExecutionTime(session.takeSQLLog(), func() (sql.Result, error) {
+			return conn.ExecContext(session.ctx, sqlStr)
+		})
+		if err != nil {
+			return err
+		}
+		session.clearResults(sqlStr)
+	}
+	return nil
+}
+
+// foreignKeysEnabled tells if the foreign keys are enforced on conn
+func (session *Session) foreignKeysEnabled(conn sqlConn, sqlStr string) (bool, error) {
+	session.saveLastSQL(sqlStr)
+	session.flushSQLLog()
+	rows, err := conn.QueryContext(session.ctx, sqlStr)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	var enabled bool
+	if rows.Next() {
+		if err = rows.Scan(&enabled); err != nil {
+			return false, err
+		}
+	}
+	return enabled, rows.Err()
+}
+
+// checkForeignKeys returns a ConstraintError if the query sqlStr lists a
+// violation of the foreign keys on conn, its first column is the table of
+// the violating row
+func (session *Session) checkForeignKeys(conn sqlConn, sqlStr string) error {
+	session.saveLastSQL(sqlStr)
+	session.flushSQLLog()
+	rows, err := conn.QueryContext(session.ctx, sqlStr)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return rows.Err()
+	}
+	cols, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	var values = make([]interface{}, len(cols))
+	var tableName string
+	values[0] = &tableName
+	for i := 1; i < len(values); i++ {
+		values[i] = new(interface{})
+	}
+	if err = rows.Scan(values...); err != nil {
+		return err
+	}
+	return &ConstraintError{
+		Kind:  ErrForeignKeyViolation,
+		Table: tableName,
+		Err:   fmt.Errorf("table %s has rows violating its foreign keys", tableName),
+	}
+}
@@ -0,0 +1,374 @@
+package xorm
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/go-xorm/core"
+)
+
+type SyncPlanIndexes struct {
+	Id int64
+	A  string `xorm:"index(A)"`
+	B  string `xorm:"index(B)"`
+	C  string `xorm:"unique(C)"`
+	D  string `xorm:"index(D)"`
+}
+
+func TestSyncPlanIndexOrder(t *testing.T) {
+	engine := newTestEngine(t)
+	if _, err := engine.Exec("CREATE TABLE sync_plan_indexes (id INTEGER PRIMARY KEY, a TEXT, b TEXT, c TEXT, d TEXT, e TEXT)"); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"Z", "Y", "X"} {
+		if _, err := engine.Exec("CREATE INDEX IDX_sync_plan_indexes_" + name + " ON sync_plan_indexes (e)"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var expected []string
+	for i := 0; i < 10; i++ {
+		plan, err := engine.SyncPlan(new(SyncPlanIndexes))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var indexes []string
+		for _, change := range plan.Changes {
+			if change.Type == SyncAddIndex || change.Type == SyncDropIndex {
+				indexes = append(indexes, change.String())
+			}
+		}
+		if expected == nil {
+			expected = indexes
+			continue
+		}
+		if fmt.Sprint(indexes) != fmt.Sprint(expected) {
+			t.Fatalf("plan changed from %v to %v", expected, indexes)
+		}
+	}
+	if len(expected) != 7 {
+		t.Errorf("unexpected index changes %v", expected)
+	}
+}
+
+type SyncRebuild struct {
+	Id    int64
+	Name  string
+	Title string
+}
+
+func TestSyncRebuildKeepsTable(t *testing.T) {
+	engine := newTestEngine(t)
+	for _, sql := range []string{
+		"CREATE TABLE sync_rebuild (id INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL, name TEXT NOT NULL, title INTEGER, legacy TEXT DEFAULT 'none')",
+		"CREATE INDEX IDX_sync_rebuild_legacy ON sync_rebuild (legacy)",
+		"INSERT INTO sync_rebuild (name, title, legacy) VALUES ('a', 1, 'keep me')",
+	} {
+		if _, err := engine.Exec(sql); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := engine.SyncWithOptions(SyncOptions{AlterTypes: true}, new(SyncRebuild)); err != nil {
+		t.Fatal(err)
+	}
+	results, err := engine.QueryString("SELECT name, title, legacy FROM sync_rebuild")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0]["legacy"] != "keep me" || results[0]["title"] != "1" {
+		t.Errorf("unexpected rows %v", results)
+	}
+
+	tables, err := engine.DBMetas()
+	if err != nil {
+		t.Fatal(err)
+	}
+	table := tables[0]
+	if col := table.GetColumn("title"); col == nil || col.SQLType.Name != "TEXT" {
+		t.Errorf("title is not altered to TEXT: %+v", col)
+	}
+	if col := table.GetColumn("name"); col == nil || col.Nullable {
+		t.Error("name became nullable without AlterNullability")
+	}
+	if col := table.GetColumn("legacy"); col == nil || col.Default != "'none'" {
+		t.Errorf("legacy lost its default: %+v", col)
+	}
+	if _, ok := table.Indexes["legacy"]; !ok {
+		t.Errorf("index on legacy dropped without DropIndexes: %v", table.Indexes)
+	}
+
+	if err = engine.SyncWithOptions(SyncOptions{DropColumns: true, DropIndexes: true}, new(SyncRebuild)); err != nil {
+		t.Fatal(err)
+	}
+	tables, err = engine.DBMetas()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tables[0].GetColumn("legacy") != nil || len(tables[0].Indexes) != 0 {
+		t.Errorf("legacy is not dropped: %v %v", tables[0].ColumnsSeq(), tables[0].Indexes)
+	}
+	var rebuilt SyncRebuild
+	if has, err := engine.Get(&rebuilt); err != nil || !has || rebuilt.Name != "a" {
+		t.Errorf("lost the row: %v %v %+v", has, err, rebuilt)
+	}
+}
+
+type SyncFk struct {
+	Id       int64
+	ParentId int64 `xorm:"fk(sync_fk_parent.id)"`
+}
+
+func TestSyncAddForeignKey(t *testing.T) {
+	engine := newTestEngine(t)
+	for _, sql := range []string{
+		"CREATE TABLE sync_fk_parent (id INTEGER PRIMARY KEY)",
+		"CREATE TABLE sync_fk_other (id INTEGER PRIMARY KEY)",
+		"CREATE TABLE sync_fk (id INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL, parent_id INTEGER, legacy TEXT, other_id INTEGER REFERENCES sync_fk_other (id))",
+		"CREATE INDEX idx_legacy ON sync_fk (legacy)",
+		"INSERT INTO sync_fk (parent_id, legacy) VALUES (1, 'keep me')",
+	} {
+		if _, err := engine.Exec(sql); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// sqlite adds a foreign key by rebuilding the table, which Sync2 doesn't
+	plan, err := engine.SyncPlan(new(SyncFk))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, change := range plan.Changes {
+		if change.Type == SyncRebuildTable || (change.Type == SyncAddForeignKey && !change.IsWarning()) {
+			t.Errorf("Sync2 would rebuild the table: %v", change)
+		}
+	}
+
+	if err = engine.SyncWithOptions(SyncOptions{AddConstraints: true}, new(SyncFk)); err != nil {
+		t.Fatal(err)
+	}
+	results, err := engine.QueryString("SELECT parent_id, legacy FROM sync_fk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0]["legacy"] != "keep me" || results[0]["parent_id"] != "1" {
+		t.Errorf("unexpected rows %v", results)
+	}
+
+	fks, err := engine.dialect.(*sqlite3).GetForeignKeys("sync_fk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var refTables []string
+	for _, fk := range fks {
+		refTables = append(refTables, fk.RefTable)
+	}
+	sort.Strings(refTables)
+	if fmt.Sprint(refTables) != "[sync_fk_other sync_fk_parent]" {
+		t.Errorf("got the foreign keys to %v", refTables)
+	}
+
+	indexes, err := engine.dialect.GetIndexes("sync_fk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(indexes) != 1 {
+		t.Errorf("the index on legacy isn't kept: %v", indexes)
+	}
+}
+
+type SyncCheck struct {
+	Id  int64
+	Age int `xorm:"check(age >= 0)"`
+}
+
+func TestSyncAddCheck(t *testing.T) {
+	engine := newTestEngine(t)
+	for _, sql := range []string{
+		"CREATE TABLE sync_check (id INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL, age INTEGER, legacy TEXT, " +
+			"CHECK (legacy <> 'bad'), CONSTRAINT CK_legacy_length CHECK (length(legacy) < 10))",
+		"INSERT INTO sync_check (age, legacy) VALUES (1, 'keep me')",
+	} {
+		if _, err := engine.Exec(sql); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	plan, err := engine.SyncPlan(new(SyncCheck))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, change := range plan.Changes {
+		if change.Type == SyncRebuildTable || (change.Type == SyncAddCheck && !change.IsWarning()) {
+			t.Errorf("Sync2 would rebuild the table: %v", change)
+		}
+	}
+
+	if err = engine.SyncWithOptions(SyncOptions{AddConstraints: true}, new(SyncCheck)); err != nil {
+		t.Fatal(err)
+	}
+	results, err := engine.QueryString("SELECT age, legacy FROM sync_check")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0]["legacy"] != "keep me" {
+		t.Errorf("unexpected rows %v", results)
+	}
+	for _, sql := range []string{
+		"INSERT INTO sync_check (age) VALUES (-1)",
+		"INSERT INTO sync_check (age, legacy) VALUES (1, 'bad')",
+		"INSERT INTO sync_check (age, legacy) VALUES (1, 'far too long')",
+	} {
+		if _, err = engine.Exec(sql); err == nil {
+			t.Errorf("%v doesn't fail a check", sql)
+		}
+	}
+
+	// the checks of a dropped column are dropped with it
+	if err = engine.SyncWithOptions(SyncOptions{AddConstraints: true, DropColumns: true}, new(SyncCheck)); err != nil {
+		t.Fatal(err)
+	}
+	checks, err := engine.dialect.(*sqlite3).GetChecks("sync_check")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(checks) != 1 || checks[0].Name != "CK_sync_check_age" {
+		t.Errorf("got the checks %v", checks)
+	}
+}
+
+// alterDialect hides the table rebuild of sqlite, to plan the ALTER
+// statements of the other dialects
+type alterDialect struct {
+	core.Dialect
+}
+
+type SyncPlanColumns struct {
+	Id    int64
+	Name  string
+	Title string
+}
+
+func TestSyncPlanColumns(t *testing.T) {
+	engine := newTestEngine(t)
+	if _, err := engine.Exec("CREATE TABLE sync_plan_columns (id INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL, name TEXT NOT NULL, title INTEGER, legacy TEXT)"); err != nil {
+		t.Fatal(err)
+	}
+
+	plan, err := engine.SyncPlan(new(SyncPlanColumns))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var warnings []string
+	for _, change := range plan.Warnings() {
+		warnings = append(warnings, change.String())
+	}
+	expected := []string{
+		"Table sync_plan_columns Column name db nullable is false, struct nullable is true",
+		"Table sync_plan_columns column title db type is INTEGER, struct type is TEXT",
+		"Table sync_plan_columns has column legacy but struct has not related field",
+	}
+	if fmt.Sprint(warnings) != fmt.Sprint(expected) {
+		t.Errorf("got the warnings %q", warnings)
+	}
+	if sqls := plan.SQLs(); len(sqls) != 0 {
+		t.Errorf("Sync2 would execute %v", sqls)
+	}
+
+	engine.dialect = &alterDialect{engine.dialect}
+	plan, err = engine.SyncPlanWithOptions(SyncOptions{AlterTypes: true, AlterNullability: true}, new(SyncPlanColumns))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sqls = make(map[SyncChangeType][]string)
+	for _, change := range plan.Changes {
+		if change.Rebuild {
+			t.Errorf("%v rebuilds the table", change)
+		}
+		sqls[change.Type] = append(sqls[change.Type], change.SQLs...)
+	}
+	if fmt.Sprint(sqls[SyncModifyColumn]) != "[alter table sync_plan_columns MODIFY COLUMN `title` TEXT NULL ]" {
+		t.Errorf("got the type change %q", sqls[SyncModifyColumn])
+	}
+	if fmt.Sprint(sqls[SyncColumnNullable]) != "[alter table sync_plan_columns MODIFY COLUMN `name` TEXT NULL ]" {
+		t.Errorf("got the nullability change %q", sqls[SyncColumnNullable])
+	}
+	if len(plan.Warnings()) != 1 || plan.Warnings()[0].Type != SyncExtraColumn {
+		t.Errorf("got the warnings %v", plan.Warnings())
+	}
+}
+
+type SyncFkRebuild struct {
+	Id   int64
+	Name string
+}
+
+func TestSyncRebuildForeignKeys(t *testing.T) {
+	engine := newTestEngine(t)
+	if err := engine.SetSQLiteConfig(SQLiteConfig{ForeignKeys: true}); err != nil {
+		t.Fatal(err)
+	}
+	for _, sql := range []string{
+		"CREATE TABLE sync_fk_rebuild (id INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL, name TEXT, legacy TEXT)",
+		"CREATE TABLE sync_fk_rebuild_child (id INTEGER PRIMARY KEY, parent_id INTEGER REFERENCES sync_fk_rebuild (id) ON DELETE CASCADE)",
+		"INSERT INTO sync_fk_rebuild (name, legacy) VALUES ('a', 'x')",
+		"INSERT INTO sync_fk_rebuild_child (parent_id) VALUES (1)",
+	} {
+		if _, err := engine.Exec(sql); err != nil {
+			t.Fatal(err)
+		}
+	}
+	assertForeignKeys := func() {
+		results, err := engine.QueryString("PRAGMA foreign_keys")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if results[0]["foreign_keys"] != "1" {
+			t.Error("the foreign keys are not turned back on")
+		}
+	}
+
+	// a rebuild in a transaction can't turn the foreign keys off
+	session := engine.NewSession()
+	if err := session.Begin(); err != nil {
+		t.Fatal(err)
+	}
+	if err := session.SyncWithOptions(SyncOptions{DropColumns: true}, new(SyncFkRebuild)); err == nil {
+		t.Error("rebuilt the table in a transaction with the foreign keys on")
+	}
+	session.Rollback()
+	session.Close()
+
+	// on a single connection, to check the one of the rebuild
+	engine.SetMaxOpenConns(1)
+	if err := engine.SyncWithOptions(SyncOptions{DropColumns: true}, new(SyncFkRebuild)); err != nil {
+		t.Fatal(err)
+	}
+	results, err := engine.QueryString("SELECT id FROM sync_fk_rebuild_child")
+	if err != nil || len(results) != 1 {
+		t.Errorf("the child rows are deleted: %v %v", results, err)
+	}
+	assertForeignKeys()
+
+	// a rebuild leaving a violation is rolled back
+	for _, sql := range []string{
+		"ALTER TABLE sync_fk_rebuild ADD COLUMN legacy TEXT",
+		"PRAGMA foreign_keys = OFF",
+		"INSERT INTO sync_fk_rebuild_child (parent_id) VALUES (2)",
+		"PRAGMA foreign_keys = ON",
+	} {
+		if _, err := engine.Exec(sql); err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = engine.SyncWithOptions(SyncOptions{DropColumns: true}, new(SyncFkRebuild))
+	if !errors.Is(err, ErrForeignKeyViolation) {
+		t.Errorf("got %v, expected a foreign key violation", err)
+	}
+	if _, err = engine.QueryString("SELECT legacy FROM sync_fk_rebuild"); err != nil {
+		t.Errorf("the failed rebuild isn't rolled back: %v", err)
+	}
+	assertForeignKeys()
+}
@@ -0,0 +1,213 @@
+// Copyright 2017 The Xorm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xorm
+
+import (
+	"reflect"
+	"strings"
+	"time"
+)
+
+// TableNameResolver resolves the table of a bean per call, for the types
+// whose records are split across several tables as the time-partitioned
+// tables. It could be implemented by the bean or set with
+// SetTableNameResolver.
+type TableNameResolver interface {
+	// TableNameFor returns the table of bean for op, which is one of
+	// "insert", "get", "find", "count", "sum", "update", "delete" and "sync".
+	// An empty name keeps the table given by TableName or the mapper.
+	TableNameFor(bean interface{}, op string) string
+}
+
+// tableNamesResolver is implemented by the resolvers which know all the
+// tables of a type, Sync2 then syncs them all
+type tableNamesResolver interface {
+	TableNames(bean interface{}) []string
+}
+
+// SetTableNameResolver sets the resolver of the tables of bean's type
+func (engine *Engine) SetTableNameResolver(bean interface{}, resolver TableNameResolver) {
+	engine.mutex.Lock()
+	defer engine.mutex.Unlock()
+	if engine.tableNameResolvers == nil {
+		engine.tableNameResolvers = make(map[reflect.Type]TableNameResolver)
+	}
+	engine.tableNameResolvers[rValue(bean).Type()] = resolver
+}
+
+// tableNameResolver returns the resolver of bean's type, nil if it has
+// none
+func (engine *Engine) tableNameResolver(bean interface{}) TableNameResolver {
+	if resolver, ok := bean.(TableNameResolver); ok {
+		return resolver
+	}
+	v := rValue(bean)
+	if v.CanAddr() {
+		if resolver, ok := v.Addr().Interface().(TableNameResolver); ok {
+			return resolver
+		}
+	}
+
+	engine.mutex.RLock()
+	defer engine.mutex.RUnlock()
+	return engine.tableNameResolvers[v.Type()]
+}
+
+// resolveTableName sets the table of bean for op given by its resolver,
+// unless the table is set by Table or Partitions
+func (statement *Statement) resolveTableName(bean interface{}, op string) {
+	if statement.AltTableName != "" || len(statement.partitions) > 0 {
+		return
+	}
+	if resolver := statement.Engine.tableNameResolver(bean); resolver != nil {
+		if name := resolver.TableNameFor(bean, op); name != "" {
+			statement.tableName = name
+		}
+	}
+}
+
+// syncTable is a table synced by Sync2, tableName is empty for the table
+// of Table or the mapper
+type syncTable struct {
+	bean      interface{}
+	tableName string
+}
+
+// syncTables returns the tables Sync2 syncs for beans
+func (session *Session) syncTables(beans []interface{}) []syncTable {
+	var tables []syncTable
+	for _, bean := range beans {
+		names := session.syncTableNames(bean)
+		if len(names) == 0 {
+			tables = append(tables, syncTable{bean: bean})
+		}
+		for _, name := range names {
+			tables = append(tables, syncTable{bean, name})
+		}
+	}
+	return tables
+}
+
+// syncTableNames returns the tables Sync2 syncs for bean, nil when it's
+// the one of Table or the mapper
+func (session *Session) syncTableNames(bean interface{}) []string {
+	if session.Statement.AltTableName != "" {
+		return nil
+	}
+	resolver := session.Engine.tableNameResolver(bean)
+	if resolver == nil {
+		return nil
+	}
+	if r, ok := resolver.(tableNamesResolver); ok {
+		return r.TableNames(bean)
+	}
+	if name := resolver.TableNameFor(bean, "sync"); name != "" {
+		return []string{name}
+	}
+	return nil
+}
+
+// resolveFindTable sets the table of Find, resolved with the condition
+// bean if there is one or with the zero bean
+func (session *Session) resolveFindTable(bean interface{}, condiBean []interface{}) {
+	if len(condiBean) > 0 && condiBean[0] != nil {
+		bean = condiBean[0]
+	}
+	session.Statement.resolveTableName(bean, "find")
+}
+
+// splitByTable splits the beans of sliceValue into the slices of the beans
+// resolved to the same table for insert, in the order of their first bean
+func (session *Session) splitByTable(sliceValue reflect.Value) []reflect.Value {
+	if session.Statement.AltTableName != "" || sliceValue.Len() == 0 ||
+		session.Engine.tableNameResolver(sliceValue.Index(0).Interface()) == nil {
+		return []reflect.Value{sliceValue}
+	}
+
+	var names []string
+	parts := make(map[string]reflect.Value)
+	for i := 0; i < sliceValue.Len(); i++ {
+		bean := sliceValue.Index(i).Interface()
+		name := session.Engine.tableNameResolver(bean).TableNameFor(bean, "insert")
+		part, ok := parts[name]
+		if !ok {
+			names = append(names, name)
+			part = reflect.MakeSlice(sliceValue.Type(), 0, 1)
+		}
+		parts[name] = reflect.Append(part, sliceValue.Index(i))
+	}
+
+	slices := make([]reflect.Value, len(names))
+	for i, name := range names {
+		slices[i] = parts[name]
+	}
+	return slices
+}
+
+// Partitions makes Get, Find, Count and Sum read the union of the tables
+// instead of the table of the bean, as the tables of a date range of a
+// time-partitioned table. The union is named after the bean's table in the
+// query.
+func (session *Session) Partitions(tableNames ...string) *Session {
+	session.Statement.partitions = tableNames
+	return session
+}
+
+// partitionsUnion returns the union of the partitions for the FROM clause
+func (statement *Statement) partitionsUnion() string {
+	selects := make([]string, len(statement.partitions))
+	for i, name := range statement.partitions {
+		selects[i] = "SELECT * FROM " + statement.Engine.Quote(name)
+	}
+	return "(" + strings.Join(selects, " UNION ALL ") + ")"
+}
+
+// MonthlyTableResolver resolves the tables partitioned by month, named
+// Prefix followed by the month of the time field Field as "200601". The
+// beans whose field is zero, as the conditions of Find without it, go to
+// the table of the current month.
+type MonthlyTableResolver struct {
+	Prefix string
+	Field  string
+	// From and To are the first and the last months of the tables created
+	// by Sync2
+	From, To time.Time
+}
+
+// TableNameFor implements TableNameResolver
+func (r *MonthlyTableResolver) TableNameFor(bean interface{}, op string) string {
+	t := time.Now()
+	if v := rValue(bean); v.Kind() == reflect.Struct {
+		field := reflect.Indirect(v.FieldByName(r.Field))
+		if field.IsValid() {
+			if ft, ok := field.Interface().(time.Time); ok && !ft.IsZero() {
+				t = ft
+			}
+		}
+	}
+	return r.TableNameOf(t)
+}
+
+// TableNameOf returns the table of the month of t
+func (r *MonthlyTableResolver) TableNameOf(t time.Time) string {
+	return r.Prefix + t.Format("200601")
+}
+
+// TableNamesBetween returns the tables of the months from from to to, to
+// be read with Partitions
+func (r *MonthlyTableResolver) TableNamesBetween(from, to time.Time) []string {
+	var names []string
+	month := time.Date(from.Year(), from.Month(), 1, 0, 0, 0, 0, from.Location())
+	for !month.After(to) {
+		names = append(names, r.TableNameOf(month))
+		month = month.AddDate(0, 1, 0)
+	}
+	return names
+}
+
+// TableNames returns the tables from From to To, synced by Sync2
+func (r *MonthlyTableResolver) TableNames(bean interface{}) []string {
+	return r.TableNamesBetween(r.From, r.To)
+}
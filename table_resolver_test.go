@@ -0,0 +1,28 @@
+package xorm
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMonthlyTableResolver(t *testing.T) {
+	type event struct {
+		Id        int64
+		CreatedAt time.Time
+	}
+	resolver := &MonthlyTableResolver{Prefix: "events_", Field: "CreatedAt"}
+
+	created := time.Date(2017, 11, 30, 23, 0, 0, 0, time.UTC)
+	if name := resolver.TableNameFor(&event{CreatedAt: created}, "insert"); name != "events_201711" {
+		t.Errorf("got %v", name)
+	}
+	if name := resolver.TableNameFor(&event{}, "find"); name != resolver.TableNameOf(time.Now()) {
+		t.Errorf("got %v for a zero time", name)
+	}
+
+	names := resolver.TableNamesBetween(created, created.AddDate(0, 2, 0))
+	if !reflect.DeepEqual(names, []string{"events_201711", "events_201712", "events_201801"}) {
+		t.Errorf("got %v", names)
+	}
+}
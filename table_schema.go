@@ -0,0 +1,447 @@
+// Copyright 2017 The Xorm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xorm
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/go-xorm/core"
+)
+
+// Check is a CHECK constraint of a table, declared on a field by the tag
+// check(age >= 0)
+type Check struct {
+	// Name is the name of the constraint, CK_<table>_<column> if empty
+	Name string
+	Expr string
+
+	col string
+}
+
+// ConstraintName returns the name of the constraint on tableName
+func (check *Check) ConstraintName(tableName string) string {
+	if check.Name != "" {
+		return check.Name
+	}
+	return fmt.Sprintf("CK_%v_%v", tableName, check.col)
+}
+
+// GeneratedColumn is the expression a column is computed from, declared by
+// the tags generated(price*qty) and stored or virtual. The generated columns
+// are never inserted nor updated.
+type GeneratedColumn struct {
+	Expr string
+	// Stored is true if the value is stored instead of computed when read
+	Stored bool
+}
+
+// TableComment is implemented by the beans whose table has a comment
+type TableComment interface {
+	TableComment() string
+}
+
+// tableSchema is the part of the schema of a table core.Table has no place
+// for
+type tableSchema struct {
+	foreignKeys []*ForeignKey
+	checks      []*Check
+	// generated are the generated columns by lower case column name
+	generated map[string]*GeneratedColumn
+	// indexes are the options of the indexes by index name
+	indexes map[string]*IndexOptions
+}
+
+func (schema *tableSchema) isEmpty() bool {
+	return len(schema.foreignKeys) == 0 && len(schema.checks) == 0 && len(schema.generated) == 0 &&
+		len(schema.indexes) == 0
+}
+
+// tableSchema returns the schema of table, either a mapped table or one read
+// by DBMetas
+func (engine *Engine) tableSchema(table *core.Table) *tableSchema {
+	var key interface{} = table.Name
+	if table.Type != nil {
+		key = table.Type
+	}
+	if schema, ok := engine.schemas.Load(key); ok {
+		return schema.(*tableSchema)
+	}
+	return &tableSchema{}
+}
+
+// setTableSchema stores the schema of a mapped type or of a table name
+func (engine *Engine) setTableSchema(key interface{}, schema *tableSchema) {
+	if schema.isEmpty() {
+		engine.schemas.Delete(key)
+		return
+	}
+	engine.schemas.Store(key, schema)
+}
+
+// Checks returns the check constraints of table
+func (engine *Engine) Checks(table *core.Table) []*Check {
+	return engine.tableSchema(table).checks
+}
+
+// GeneratedColumn returns how the column colName of table is generated, nil
+// if it isn't a generated column
+func (engine *Engine) GeneratedColumn(table *core.Table, colName string) *GeneratedColumn {
+	return engine.tableSchema(table).generated[strings.ToLower(colName)]
+}
+
+// schemaGetter is implemented by the dialects which can read the check
+// constraints and the generated columns of a table
+type schemaGetter interface {
+	GetChecks(tableName string) ([]*Check, error)
+	GetGeneratedColumns(tableName string) (map[string]*GeneratedColumn, error)
+}
+
+// readTableSchema reads the schema of the table named tableName from the
+// database
+func (engine *Engine) readTableSchema(tableName string) (*tableSchema, error) {
+	var schema = new(tableSchema)
+	var err error
+	if getter, ok := engine.dialect.(foreignKeysGetter); ok {
+		if schema.foreignKeys, err = getter.GetForeignKeys(tableName); err != nil {
+			return nil, err
+		}
+	}
+	if getter, ok := engine.dialect.(schemaGetter); ok {
+		if schema.checks, err = getter.GetChecks(tableName); err != nil {
+			return nil, err
+		}
+		generated, err := getter.GetGeneratedColumns(tableName)
+		if err != nil {
+			return nil, err
+		}
+		if len(generated) > 0 {
+			schema.generated = make(map[string]*GeneratedColumn, len(generated))
+			for name, gen := range generated {
+				schema.generated[strings.ToLower(name)] = gen
+			}
+		}
+	}
+	if getter, ok := engine.dialect.(indexOptionsGetter); ok {
+		if schema.indexes, err = getter.GetIndexOptions(tableName); err != nil {
+			return nil, err
+		}
+	}
+	return schema, nil
+}
+
+// checkSQL returns the constraint clause of check on tableName, an unnamed
+// check read from the database stays unnamed
+func checkSQL(dialect core.Dialect, tableName string, check *Check) string {
+	if check.Name == "" && check.col == "" {
+		return fmt.Sprintf("CHECK (%v)", check.Expr)
+	}
+	return fmt.Sprintf("CONSTRAINT %v CHECK (%v)", dialect.Quote(check.ConstraintName(tableName)), check.Expr)
+}
+
+// addCheckSQL returns the statement adding check to an existing table
+func (engine *Engine) addCheckSQL(tableName string, check *Check) string {
+	return fmt.Sprintf("ALTER TABLE %v ADD %v", engine.Quote(tableName),
+		checkSQL(engine.dialect, tableName, check))
+}
+
+// createTableSQL returns the CREATE TABLE statement of dialect for table,
+// with the generated columns, the constraints and the table comment which
+// the dialects don't render
+func (engine *Engine) createTableSQL(dialect core.Dialect, table *core.Table, tableName, storeEngine, charset string) string {
+	if tableName == "" {
+		tableName = table.Name
+	}
+	return engine.createTableSQLAs(dialect, table, engine.tableSchema(table), tableName, tableName, storeEngine, charset)
+}
+
+// createTableSQLAs is createTableSQL creating the table named tableName with
+// schema and the constraints named after the table constraintTable, as the
+// table created by a rebuild before being renamed
+func (engine *Engine) createTableSQLAs(dialect core.Dialect, table *core.Table, schema *tableSchema, tableName, constraintTable, storeEngine, charset string) string {
+	sql := dialect.CreateTableSql(table, tableName, storeEngine, charset)
+	if !schema.isEmpty() {
+		sql = editColumnDefs(sql, func(defs []string) []string {
+			for i, def := range defs {
+				col := table.GetColumn(columnDefName(def))
+				if col == nil {
+					continue
+				}
+				if gen := schema.generated[strings.ToLower(col.Name)]; gen != nil {
+					defs[i] = generatedColumnSQL(dialect, col, gen)
+				}
+			}
+			for _, fk := range schema.foreignKeys {
+				defs = append(defs, foreignKeySQL(dialect, constraintTable, fk))
+			}
+			for _, check := range schema.checks {
+				defs = append(defs, checkSQL(dialect, constraintTable, check))
+			}
+			return defs
+		})
+	}
+
+	if dialect.DBType() == core.MYSQL && table.Comment != "" {
+		sql += " COMMENT=" + quoteString(table.Comment)
+	}
+	return sql
+}
+
+// editColumnDefs replaces the column and constraint definitions of the
+// CREATE TABLE statement sql by the ones returned by edit
+func editColumnDefs(sql string, edit func(defs []string) []string) string {
+	create := strings.Index(strings.ToUpper(sql), "CREATE TABLE ")
+	if create < 0 {
+		return sql
+	}
+	start := strings.Index(sql[create:], "(")
+	if start < 0 {
+		return sql
+	}
+	start += create
+	end := closingParen(sql, start)
+	if end < 0 {
+		return sql
+	}
+
+	defs := splitColumnDefs(sql[start+1 : end])
+	for i, def := range defs {
+		defs[i] = strings.TrimSpace(def)
+	}
+	return sql[:start+1] + strings.Join(edit(defs), ", ") + sql[end:]
+}
+
+// splitColumnDefs splits the column and constraint definitions of a CREATE
+// TABLE statement on the commas out of parentheses and quotes
+func splitColumnDefs(defs string) []string {
+	var parts []string
+	var depth, start int
+	var quote byte
+	for i := 0; i < len(defs); i++ {
+		switch c := defs[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+		case c == '[':
+			quote = ']'
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case c == ',' && depth == 0:
+			parts = append(parts, defs[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, defs[start:])
+}
+
+// columnDefName returns the unquoted column name of the definition def
+func columnDefName(def string) string {
+	fields := strings.Fields(def)
+	if len(fields) == 0 {
+		return ""
+	}
+	return strings.Trim(fields[0], "`\"[]")
+}
+
+// columnSQL returns the definition of col in the dialect's DDL
+func (engine *Engine) columnSQL(dialect core.Dialect, table *core.Table, col *core.Column) string {
+	gen := engine.GeneratedColumn(table, col.Name)
+	if gen == nil {
+		sql := strings.TrimSpace(col.String(dialect))
+		if dialect.DBType() == core.MYSQL && col.Comment != "" {
+			sql += " COMMENT " + quoteString(col.Comment)
+		}
+		return sql
+	}
+	return generatedColumnSQL(dialect, col, gen)
+}
+
+// generatedColumnSQL returns the definition of the generated column col
+func generatedColumnSQL(dialect core.Dialect, col *core.Column, gen *GeneratedColumn) string {
+	name := dialect.Quote(col.Name)
+	switch dialect.DBType() {
+	case core.MSSQL:
+		sql := fmt.Sprintf("%v AS (%v)", name, gen.Expr)
+		if gen.Stored {
+			sql += " PERSISTED"
+		}
+		return sql
+	}
+
+	sql := fmt.Sprintf("%v %v GENERATED ALWAYS AS (%v)", name, dialect.SqlType(col), gen.Expr)
+	switch {
+	// postgres only stores them and oracle only computes them
+	case dialect.DBType() == core.POSTGRES:
+		sql += " STORED"
+	case dialect.DBType() == core.ORACLE:
+		sql += " VIRTUAL"
+	case gen.Stored:
+		sql += " STORED"
+	default:
+		sql += " VIRTUAL"
+	}
+	if !col.Nullable {
+		sql += " NOT NULL"
+	}
+	if dialect.DBType() == core.MYSQL && col.Comment != "" {
+		sql += " COMMENT " + quoteString(col.Comment)
+	}
+	return sql
+}
+
+// commentSQLs returns the statements setting the comments of table and of
+// its columns, for the dialects which can't set them in CREATE TABLE
+func commentSQLs(dialect core.Dialect, table *core.Table, tableName string) []string {
+	if tableName == "" {
+		tableName = table.Name
+	}
+	var sqls []string
+	if table.Comment != "" {
+		sqls = append(sqls, tableCommentSQL(dialect, tableName, table.Comment)...)
+	}
+	for _, col := range table.Columns() {
+		sqls = append(sqls, columnCommentSQL(dialect, tableName, col)...)
+	}
+	return sqls
+}
+
+func tableCommentSQL(dialect core.Dialect, tableName, comment string) []string {
+	switch dialect.DBType() {
+	case core.POSTGRES, core.ORACLE:
+		return []string{fmt.Sprintf("COMMENT ON TABLE %v IS %v", dialect.Quote(tableName), quoteString(comment))}
+	case core.MSSQL:
+		return []string{fmt.Sprintf("EXEC sp_addextendedproperty 'MS_Description', %v, 'SCHEMA', 'dbo', 'TABLE', %v",
+			quoteString(comment), quoteString(tableName))}
+	}
+	return nil
+}
+
+// columnCommentSQL returns the statements setting the comment of col, mysql
+// sets it in the column definition
+func columnCommentSQL(dialect core.Dialect, tableName string, col *core.Column) []string {
+	if col.Comment == "" {
+		return nil
+	}
+	switch dialect.DBType() {
+	case core.POSTGRES, core.ORACLE:
+		return []string{fmt.Sprintf("COMMENT ON COLUMN %v.%v IS %v", dialect.Quote(tableName),
+			dialect.Quote(col.Name), quoteString(col.Comment))}
+	case core.MSSQL:
+		return []string{fmt.Sprintf("EXEC sp_addextendedproperty 'MS_Description', %v, 'SCHEMA', 'dbo', 'TABLE', %v, 'COLUMN', %v",
+			quoteString(col.Comment), quoteString(tableName), quoteString(col.Name))}
+	}
+	return nil
+}
+
+// quoteString returns s as a SQL string literal
+func quoteString(s string) string {
+	return "'" + strings.Replace(s, "'", "''", -1) + "'"
+}
+
+// dumpColumns returns the columns of the SELECT dumping table, the generated
+// columns can't be inserted back
+func (engine *Engine) dumpColumns(table *core.Table) string {
+	schema := engine.tableSchema(table)
+	if len(schema.generated) == 0 {
+		return "*"
+	}
+	var cols []string
+	for _, colName := range table.ColumnsSeq() {
+		if schema.generated[strings.ToLower(colName)] == nil {
+			cols = append(cols, engine.Quote(colName))
+		}
+	}
+	return strings.Join(cols, ", ")
+}
+
+// queryChecks reads the check constraints of the rows of query, which
+// selects their name and expression
+func queryChecks(db *core.DB, query string, args ...interface{}) ([]*Check, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var checks []*Check
+	for rows.Next() {
+		var check Check
+		if err = rows.Scan(&check.Name, &check.Expr); err != nil {
+			return nil, err
+		}
+		check.Expr = trimCheckExpr(check.Expr)
+		checks = append(checks, &check)
+	}
+	return checks, rows.Err()
+}
+
+// trimCheckExpr removes the CHECK keyword and the parentheses around the
+// expression of a check constraint definition
+func trimCheckExpr(expr string) string {
+	expr = strings.TrimSpace(expr)
+	if upper := strings.ToUpper(expr); strings.HasPrefix(upper, "CHECK ") || strings.HasPrefix(upper, "CHECK(") {
+		expr = expr[len("CHECK"):]
+	}
+	return trimParens(expr)
+}
+
+// trimParens removes the parentheses around expr
+func trimParens(expr string) string {
+	expr = strings.TrimSpace(expr)
+	for strings.HasPrefix(expr, "(") && closingParen(expr, 0) == len(expr)-1 {
+		expr = strings.TrimSpace(expr[1 : len(expr)-1])
+	}
+	return expr
+}
+
+// closingParen returns the index of the parenthesis closing the one at
+// start of s, -1 if it isn't closed
+func closingParen(s string, start int) int {
+	var depth int
+	var inQuote bool
+	for i := start; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\'':
+			inQuote = !inQuote
+		case inQuote:
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// queryGeneratedColumns reads the generated columns of the rows of query,
+// which selects their name, expression and STORED or VIRTUAL
+func queryGeneratedColumns(db *core.DB, query string, args ...interface{}) (map[string]*GeneratedColumn, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var generated = make(map[string]*GeneratedColumn)
+	for rows.Next() {
+		var name, expr, storage string
+		if err = rows.Scan(&name, &expr, &storage); err != nil {
+			return nil, err
+		}
+		generated[name] = &GeneratedColumn{
+			Expr:   trimCheckExpr(expr),
+			Stored: strings.EqualFold(storage, "STORED"),
+		}
+	}
+	return generated, rows.Err()
+}
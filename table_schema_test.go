@@ -0,0 +1,48 @@
+package xorm
+
+import (
+	"testing"
+
+	"github.com/go-xorm/core"
+)
+
+func TestTrimCheckExpr(t *testing.T) {
+	var cases = []struct {
+		expr     string
+		expected string
+	}{
+		{"CHECK ((age >= 0))", "age >= 0"},
+		{"check(age >= 0)", "age >= 0"},
+		{"(a > 0) AND (b > 0)", "(a > 0) AND (b > 0)"},
+		{"name <> ')'", "name <> ')'"},
+		{"checked = 1", "checked = 1"},
+	}
+	for _, c := range cases {
+		if got := trimCheckExpr(c.expr); got != c.expected {
+			t.Errorf("%v: got %v", c.expr, got)
+		}
+	}
+}
+
+func TestGeneratedColumnSQL(t *testing.T) {
+	col := &core.Column{Name: "total", SQLType: core.SQLType{Name: core.Int}, Nullable: true, Comment: "price's total"}
+	gen := &GeneratedColumn{Expr: "price * qty", Stored: true}
+	var cases = []struct {
+		dialect  core.Dialect
+		dbType   core.DbType
+		expected string
+	}{
+		{&mysql{}, core.MYSQL, "`total` INT GENERATED ALWAYS AS (price * qty) STORED COMMENT 'price''s total'"},
+		{&postgres{}, core.POSTGRES, `"total" INTEGER GENERATED ALWAYS AS (price * qty) STORED`},
+		{&mssql{}, core.MSSQL, `"total" AS (price * qty) PERSISTED`},
+	}
+	for _, c := range cases {
+		c.dialect.Init(nil, &core.Uri{DbType: c.dbType}, "", "")
+		if got := generatedColumnSQL(c.dialect, col, gen); got != c.expected {
+			t.Errorf("%v: got %v", c.dbType, got)
+		}
+		if name := columnDefName(c.expected); name != "total" {
+			t.Errorf("%v: got column %v", c.dbType, name)
+		}
+	}
+}
@@ -0,0 +1,223 @@
+// Copyright 2017 The Xorm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xorm
+
+import (
+	"github.com/go-xorm/core"
+)
+
+// txCacheSpace keeps the ids or the beans written by a transaction, a nil
+// value means the key was deleted
+type txCacheSpace struct {
+	entries map[string]map[string]interface{}
+	cleared map[string]bool
+}
+
+func newTxCacheSpace() txCacheSpace {
+	return txCacheSpace{
+		entries: make(map[string]map[string]interface{}),
+		cleared: make(map[string]bool),
+	}
+}
+
+func (space txCacheSpace) get(tableName, key string) (interface{}, bool) {
+	if entries, ok := space.entries[tableName]; ok {
+		if v, ok := entries[key]; ok {
+			return v, true
+		}
+	}
+	if space.cleared[tableName] {
+		return nil, true
+	}
+	return nil, false
+}
+
+func (space txCacheSpace) set(tableName, key string, value interface{}) {
+	entries, ok := space.entries[tableName]
+	if !ok {
+		entries = make(map[string]interface{})
+		space.entries[tableName] = entries
+	}
+	entries[key] = value
+}
+
+func (space txCacheSpace) clear(tableName string) {
+	delete(space.entries, tableName)
+	space.cleared[tableName] = true
+}
+
+// txCacher is the cache overlay of a transaction. Its reads see the writes
+// of the transaction, which are buffered and applied to the engine's cacher
+// on commit or thrown away on rollback.
+type txCacher struct {
+	cacher core.Cacher
+	ids    txCacheSpace
+	beans  txCacheSpace
+	ops    []func(core.Cacher)
+}
+
+func newTxCacher(cacher core.Cacher) *txCacher {
+	return &txCacher{
+		cacher: cacher,
+		ids:    newTxCacheSpace(),
+		beans:  newTxCacheSpace(),
+	}
+}
+
+func (c *txCacher) GetIds(tableName, sql string) interface{} {
+	if v, ok := c.ids.get(tableName, sql); ok {
+		return v
+	}
+	return c.cacher.GetIds(tableName, sql)
+}
+
+func (c *txCacher) GetBean(tableName string, id string) interface{} {
+	if v, ok := c.beans.get(tableName, id); ok {
+		return v
+	}
+	return c.cacher.GetBean(tableName, id)
+}
+
+func (c *txCacher) PutIds(tableName, sql string, ids interface{}) {
+	c.ids.set(tableName, sql, ids)
+	c.ops = append(c.ops, func(cacher core.Cacher) {
+		cacher.PutIds(tableName, sql, ids)
+	})
+}
+
+func (c *txCacher) PutBean(tableName string, id string, obj interface{}) {
+	c.beans.set(tableName, id, obj)
+	c.ops = append(c.ops, func(cacher core.Cacher) {
+		cacher.PutBean(tableName, id, obj)
+	})
+}
+
+func (c *txCacher) DelIds(tableName, sql string) {
+	c.ids.set(tableName, sql, nil)
+	c.ops = append(c.ops, func(cacher core.Cacher) {
+		cacher.DelIds(tableName, sql)
+	})
+}
+
+func (c *txCacher) DelBean(tableName string, id string) {
+	c.beans.set(tableName, id, nil)
+	c.ops = append(c.ops, func(cacher core.Cacher) {
+		cacher.DelBean(tableName, id)
+	})
+}
+
+func (c *txCacher) ClearIds(tableName string) {
+	c.ids.clear(tableName)
+	c.ops = append(c.ops, func(cacher core.Cacher) {
+		cacher.ClearIds(tableName)
+	})
+}
+
+func (c *txCacher) ClearBeans(tableName string) {
+	c.beans.clear(tableName)
+	c.ops = append(c.ops, func(cacher core.Cacher) {
+		cacher.ClearBeans(tableName)
+	})
+}
+
+func (c *txCacher) PutIdsDeps(tableName, sql string, ids interface{}, deps CacheIdsDeps) {
+	c.ids.set(tableName, sql, ids)
+	c.ops = append(c.ops, func(cacher core.Cacher) {
+		putIdsDeps(cacher, tableName, sql, ids, deps)
+	})
+}
+
+// ClearIdsOfColumns hides all the id lists of the table from the
+// transaction, only the ones depending on cols are removed on commit
+func (c *txCacher) ClearIdsOfColumns(tableName string, cols []string) {
+	c.ids.clear(tableName)
+	c.ops = append(c.ops, func(cacher core.Cacher) {
+		clearIdsOfColumns(cacher, tableName, cols)
+	})
+}
+
+// ClearIdsOfBeans hides all the id lists of the table from the transaction,
+// only the ones listing ids are removed on commit
+func (c *txCacher) ClearIdsOfBeans(tableName string, ids []string) {
+	c.ids.clear(tableName)
+	c.ops = append(c.ops, func(cacher core.Cacher) {
+		clearIdsOfBeans(cacher, tableName, ids)
+	})
+}
+
+// commit applies the buffered writes to the engine's cacher
+func (c *txCacher) commit() {
+	for _, op := range c.ops {
+		op(c.cacher)
+	}
+	c.ops = nil
+}
+
+// rollbackTo throws away the writes buffered after the first n ones
+func (c *txCacher) rollbackTo(n int) {
+	ops := c.ops[:n]
+	c.ids = newTxCacheSpace()
+	c.beans = newTxCacheSpace()
+	c.ops = make([]func(core.Cacher), 0, n)
+	for _, op := range ops {
+		op(c)
+	}
+}
+
+// inTx returns true if the session is in a running transaction
+func (session *Session) inTx() bool {
+	return session.Tx != nil && !session.IsAutoCommit && !session.IsCommitedOrRollbacked
+}
+
+// getCacher returns the table's cacher, wrapped by the transaction's overlay
+// when the session is in a transaction
+func (session *Session) getCacher(table *core.Table) core.Cacher {
+	return session.overlay(session.Engine.getCacher2(table))
+}
+
+// overlay returns cacher wrapped by the transaction's overlay when the
+// session is in a transaction
+func (session *Session) overlay(cacher core.Cacher) core.Cacher {
+	if cacher == nil || !session.inTx() {
+		return cacher
+	}
+
+	if session.txCachers == nil {
+		session.txCachers = make(map[core.Cacher]*txCacher)
+	}
+	c, ok := session.txCachers[cacher]
+	if !ok {
+		c = newTxCacher(cacher)
+		session.txCachers[cacher] = c
+	}
+	return c
+}
+
+// cacheMarks returns the number of writes buffered by each overlay, so that
+// a nested transaction's writes can be thrown away
+func (session *Session) cacheMarks() map[core.Cacher]int {
+	marks := make(map[core.Cacher]int, len(session.txCachers))
+	for cacher, c := range session.txCachers {
+		marks[cacher] = len(c.ops)
+	}
+	return marks
+}
+
+// newCacheSession returns a session loading the records missing from the
+// cache, it shares the transaction of session. The returned release func
+// must be called instead of Close, which would roll the transaction back.
+func (session *Session) newCacheSession() (*Session, func()) {
+	newSession := session.Engine.NewSession()
+	newSession.ctx = session.ctx
+	newSession.group = session.group
+	if session.inTx() {
+		newSession.Tx = session.Tx
+		newSession.IsAutoCommit = false
+	}
+	return newSession, func() {
+		newSession.Tx = nil
+		newSession.Close()
+	}
+}
@@ -0,0 +1,123 @@
+package xorm
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-xorm/core"
+)
+
+func TestTxCacher(t *testing.T) {
+	shared := NewLRUCacher2(NewMemoryStore(), time.Hour, 100)
+	defer shared.Close()
+	shared.PutBean("user", "1", &cachedUser{1, "lunny"})
+	shared.PutBean("user", "2", &cachedUser{2, "xorm"})
+
+	c := newTxCacher(shared)
+	c.DelBean("user", "1")
+	c.PutIds("user", "select id from user", "[[2]]")
+	if c.GetBean("user", "1") != nil {
+		t.Error("the transaction reads its deleted bean")
+	}
+	if shared.GetBean("user", "1") == nil || shared.GetIds("user", "select id from user") != nil {
+		t.Error("the transaction wrote to the shared cacher before its commit")
+	}
+
+	// a nested transaction clearing the beans is rolled back
+	n := len(c.ops)
+	c.ClearBeans("user")
+	if c.GetBean("user", "2") != nil {
+		t.Error("the transaction reads its cleared beans")
+	}
+	c.rollbackTo(n)
+	if c.GetBean("user", "2") == nil {
+		t.Error("the rolled back clear hides the beans")
+	}
+	if c.GetBean("user", "1") != nil || c.GetIds("user", "select id from user") == nil {
+		t.Error("the rollback threw away the writes before it")
+	}
+
+	c.commit()
+	if shared.GetBean("user", "1") != nil {
+		t.Error("the commit didn't delete the bean")
+	}
+	if shared.GetBean("user", "2") == nil {
+		t.Error("the commit applied the rolled back clear")
+	}
+	if shared.GetIds("user", "select id from user") == nil {
+		t.Error("the commit didn't put the ids")
+	}
+}
+
+type TxCachedUser struct {
+	Id   int64
+	Name string
+}
+
+func TestTxCacherSession(t *testing.T) {
+	engine := newTestEngine(t)
+	cacher := NewLRUCacher2(NewMemoryStore(), time.Hour, 100)
+	engine.SetDefaultCacher(cacher)
+	if err := engine.Sync2(new(TxCachedUser)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := engine.Insert(&TxCachedUser{Name: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := engine.Id(1).Get(new(TxCachedUser)); err != nil {
+		t.Fatal(err)
+	}
+	pk := core.PK{int64(1)}
+	sid, err := pk.ToString()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cachedName := func() string {
+		bean := cacher.GetBean("tx_cached_user", sid)
+		if bean == nil {
+			return ""
+		}
+		return bean.(*TxCachedUser).Name
+	}
+	if cachedName() != "a" {
+		t.Fatal("the record isn't cached")
+	}
+
+	session := engine.NewSession()
+	defer session.Close()
+
+	if err := session.Begin(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := session.Id(1).Update(&TxCachedUser{Name: "b"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := session.Id(1).Delete(new(TxCachedUser)); err != nil {
+		t.Fatal(err)
+	}
+	if err := session.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	if name := cachedName(); name != "a" {
+		t.Errorf("the rolled back transaction changed the cached record to %q", name)
+	}
+
+	session = engine.NewSession()
+	defer session.Close()
+
+	if err := session.Begin(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := session.Id(1).Delete(new(TxCachedUser)); err != nil {
+		t.Fatal(err)
+	}
+	if cachedName() != "a" {
+		t.Error("the transaction evicted the record before its commit")
+	}
+	if err := session.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if cachedName() != "" {
+		t.Error("the committed transaction didn't evict the record")
+	}
+}
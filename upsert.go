@@ -0,0 +1,211 @@
+// Copyright 2017 The Xorm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xorm
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/go-xorm/core"
+)
+
+// upsertDialect is implemented by the dialects which can insert records and
+// update the ones conflicting with existing records in one statement. rows
+// contains the placeholders of every record. When updateCols is empty, the
+// existing records are kept.
+type upsertDialect interface {
+	UpsertSql(tableName string, colNames []string, rows [][]string, conflictCols, updateCols []string) string
+}
+
+// upsertIdDialect is implemented by the upsertDialect dialects whose upsert
+// statement can make the id of the conflicting record the last insert id.
+// The last insert id isn't set when a record is updated, so the other
+// dialects read the id back by upsertReturns, or leave it unknown.
+type upsertIdDialect interface {
+	UpsertIdSql(tableName string, colNames []string, rows [][]string, conflictCols, updateCols []string, autoIncrCol string) string
+}
+
+// Upsert insert one record, or update the existing one which conflicts with
+// it on conflictCols, the primary key by default. Cols and Omit choose the
+// inserted and updated columns, MustCols restricts the updated columns and
+// DoNothing keeps the existing record. The conflict columns, the created
+// and the version columns are never updated.
+// The id and the version of the inserted or updated record are set into bean
+// on postgres and sqlite, only the id is on mysql.
+func (session *Session) Upsert(bean interface{}, conflictCols ...string) (int64, error) {
+	defer session.resetStatement()
+	if session.IsAutoClose {
+		defer session.Close()
+	}
+
+	session.Statement.isUpsert = true
+	session.Statement.conflictColumns = conflictCols
+	affected, err := session.innerInsert(bean)
+	if err != nil {
+		return affected, err
+	}
+	session.cacheUpsert()
+	return affected, nil
+}
+
+// UpsertMulti insert or update multiple records in one statement, see Upsert
+func (session *Session) UpsertMulti(rowsSlicePtr interface{}, conflictCols ...string) (int64, error) {
+	defer session.resetStatement()
+	if session.IsAutoClose {
+		defer session.Close()
+	}
+
+	sliceValue := reflect.Indirect(reflect.ValueOf(rowsSlicePtr))
+	if sliceValue.Kind() != reflect.Slice {
+		return 0, ErrParamsType
+	}
+
+	if sliceValue.Len() <= 0 {
+		return 0, nil
+	}
+
+	session.Statement.isUpsert = true
+	session.Statement.conflictColumns = conflictCols
+	affected, err := session.innerInsertMulti(rowsSlicePtr)
+	if err != nil {
+		return affected, err
+	}
+	session.cacheUpsert()
+	return affected, nil
+}
+
+// upsertSQL returns the upsert statement of the records about to be inserted
+func (session *Session) upsertSQL(colNames []string, rows [][]string) (string, error) {
+	dialect, ok := session.Engine.dialect.(upsertDialect)
+	if !ok {
+		return "", ErrNotImplemented
+	}
+
+	table := session.Statement.RefTable
+	conflictCols := session.Statement.conflictColumns
+	if len(conflictCols) == 0 {
+		conflictCols = table.PrimaryKeys
+	}
+	if len(conflictCols) == 0 {
+		return "", fmt.Errorf("upsert into %s needs conflict columns", session.Statement.TableName())
+	}
+
+	var inserted = make(map[string]bool, len(colNames))
+	for _, colName := range colNames {
+		inserted[strings.ToLower(colName)] = true
+	}
+	var conflicts = make(map[string]bool, len(conflictCols))
+	for _, colName := range conflictCols {
+		if !inserted[strings.ToLower(colName)] {
+			return "", fmt.Errorf("upsert conflict column %s is not inserted", colName)
+		}
+		conflicts[strings.ToLower(colName)] = true
+	}
+
+	var updateCols []string
+	if !session.Statement.doNothing {
+		for _, colName := range colNames {
+			lColName := strings.ToLower(colName)
+			if conflicts[lColName] {
+				continue
+			}
+			if col := table.GetColumn(colName); col != nil && (col.IsCreated || col.IsVersion || col.IsAutoIncrement) {
+				continue
+			}
+			if len(session.Statement.mustColumnMap) > 0 && !session.Statement.mustColumnMap[lColName] {
+				continue
+			}
+			updateCols = append(updateCols, colName)
+		}
+	}
+
+	if idDialect, ok := dialect.(upsertIdDialect); ok && table.AutoIncrement != "" {
+		return idDialect.UpsertIdSql(session.Statement.TableName(), colNames, rows, conflictCols, updateCols, table.AutoIncrement), nil
+	}
+	return dialect.UpsertSql(session.Statement.TableName(), colNames, rows, conflictCols, updateCols), nil
+}
+
+// upsertReturns tells if the upsert statement of dialect can read back the
+// columns of the records it inserted or updated. Oracle's MERGE can't return
+// them and mssql's OUTPUT doesn't go where ReturningSql puts it.
+func upsertReturns(dialect core.Dialect) bool {
+	if _, ok := dialect.(returningDialect); !ok {
+		return false
+	}
+	switch dialect.DBType() {
+	case core.POSTGRES, core.SQLITE:
+		return true
+	}
+	return false
+}
+
+// cacheUpsert clears the cached records of the table since some of them may
+// have been updated
+func (session *Session) cacheUpsert() {
+	if cacher := session.getCacher(session.Statement.RefTable); cacher != nil && session.Statement.UseCache {
+		session.Engine.logger.Debug("[cache] clear beans:", session.Statement.TableName())
+		cacher.ClearBeans(session.Statement.TableName())
+	}
+}
+
+// insertValuesSql returns the INSERT ... VALUES statement of rows
+func insertValuesSql(dialect core.Dialect, tableName string, colNames []string, rows [][]string) string {
+	values := make([]string, 0, len(rows))
+	for _, places := range rows {
+		values = append(values, "("+strings.Join(places, ", ")+")")
+	}
+	return fmt.Sprintf("INSERT INTO %s (%s) VALUES %s",
+		dialect.Quote(tableName), quoteColumns(dialect, colNames), strings.Join(values, ", "))
+}
+
+// onConflictSql returns the ON CONFLICT clause shared by postgres and sqlite
+func onConflictSql(dialect core.Dialect, conflictCols, updateCols []string) string {
+	sqlStr := fmt.Sprintf(" ON CONFLICT (%s)", quoteColumns(dialect, conflictCols))
+	if len(updateCols) == 0 {
+		return sqlStr + " DO NOTHING"
+	}
+
+	sets := make([]string, 0, len(updateCols))
+	for _, colName := range updateCols {
+		sets = append(sets, fmt.Sprintf("%s = excluded.%s", dialect.Quote(colName), dialect.Quote(colName)))
+	}
+	return sqlStr + " DO UPDATE SET " + strings.Join(sets, ", ")
+}
+
+// mergeSql returns the MERGE statement shared by mssql and oracle, source
+// is the query of the records aliased as xorm_source
+func mergeSql(dialect core.Dialect, tableName, source string, colNames, conflictCols, updateCols []string) string {
+	target := dialect.Quote(tableName)
+
+	ons := make([]string, 0, len(conflictCols))
+	for _, colName := range conflictCols {
+		ons = append(ons, fmt.Sprintf("%s.%s = xorm_source.%s", target, dialect.Quote(colName), dialect.Quote(colName)))
+	}
+	sqlStr := fmt.Sprintf("MERGE INTO %s USING %s ON (%s)", target, source, strings.Join(ons, " AND "))
+
+	if len(updateCols) > 0 {
+		sets := make([]string, 0, len(updateCols))
+		for _, colName := range updateCols {
+			sets = append(sets, fmt.Sprintf("%s = xorm_source.%s", dialect.Quote(colName), dialect.Quote(colName)))
+		}
+		sqlStr += " WHEN MATCHED THEN UPDATE SET " + strings.Join(sets, ", ")
+	}
+
+	values := make([]string, 0, len(colNames))
+	for _, colName := range colNames {
+		values = append(values, "xorm_source."+dialect.Quote(colName))
+	}
+	return sqlStr + fmt.Sprintf(" WHEN NOT MATCHED THEN INSERT (%s) VALUES (%s)",
+		quoteColumns(dialect, colNames), strings.Join(values, ", "))
+}
+
+func quoteColumns(dialect core.Dialect, colNames []string) string {
+	quoted := make([]string, 0, len(colNames))
+	for _, colName := range colNames {
+		quoted = append(quoted, dialect.Quote(colName))
+	}
+	return strings.Join(quoted, ", ")
+}
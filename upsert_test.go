@@ -0,0 +1,143 @@
+package xorm
+
+import (
+	"testing"
+
+	"github.com/go-xorm/core"
+)
+
+type UpsertUser struct {
+	Id   int64
+	Name string `xorm:"unique"`
+	Age  int
+}
+
+func TestUpsertKeepsId(t *testing.T) {
+	engine := newTestEngine(t)
+	if err := engine.Sync2(new(UpsertUser)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := engine.Insert(&UpsertUser{Name: "a"}, &UpsertUser{Name: "b"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the last insert id is the one of b when the record of a is updated
+	user := &UpsertUser{Name: "a", Age: 10}
+	if _, err := engine.Upsert(user, "name"); err != nil {
+		t.Fatal(err)
+	}
+	if user.Id != 1 {
+		t.Errorf("the updated record got the id %v", user.Id)
+	}
+	var got UpsertUser
+	if _, err := engine.Where("name = ?", "a").Get(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Id != 1 || got.Age != 10 {
+		t.Errorf("got %+v", got)
+	}
+
+	user = &UpsertUser{Name: "c", Age: 30}
+	if _, err := engine.Upsert(user, "name"); err != nil {
+		t.Fatal(err)
+	}
+	got = UpsertUser{}
+	if _, err := engine.Where("name = ?", "c").Get(&got); err != nil {
+		t.Fatal(err)
+	}
+	if user.Id == 0 || user.Id != got.Id {
+		t.Errorf("the inserted record %v got the id %v", got.Id, user.Id)
+	}
+
+	user = &UpsertUser{Name: "a", Age: 20}
+	if affected, err := engine.DoNothing().Upsert(user, "name"); err != nil || affected != 0 {
+		t.Fatal(affected, err)
+	}
+	if user.Id != 0 {
+		t.Errorf("the kept record got the id %v", user.Id)
+	}
+}
+
+type UpsertVersion struct {
+	Id      int64
+	Name    string `xorm:"unique"`
+	Age     int
+	Version int `xorm:"version"`
+}
+
+func TestUpsertKeepsVersion(t *testing.T) {
+	engine := newTestEngine(t)
+	if err := engine.Sync2(new(UpsertVersion)); err != nil {
+		t.Fatal(err)
+	}
+	record := &UpsertVersion{Name: "a"}
+	if _, err := engine.Insert(record); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := engine.Id(record.Id).Update(&UpsertVersion{Age: 1, Version: record.Version}); err != nil {
+		t.Fatal(err)
+	}
+
+	record = &UpsertVersion{Name: "a", Age: 10}
+	if _, err := engine.Upsert(record, "name"); err != nil {
+		t.Fatal(err)
+	}
+	if record.Id != 1 || record.Version != 2 {
+		t.Errorf("the updated record got %+v", record)
+	}
+
+	record = &UpsertVersion{Name: "b", Age: 20}
+	if _, err := engine.Upsert(record, "name"); err != nil {
+		t.Fatal(err)
+	}
+	if record.Id <= 1 || record.Version != 1 {
+		t.Errorf("the inserted record got %+v", record)
+	}
+}
+
+// oracleUpsertDialect runs the upsert of sqlite where oracle runs MERGE,
+// whose id can't be read back
+type oracleUpsertDialect struct {
+	*sqlite3
+}
+
+func (db *oracleUpsertDialect) DBType() core.DbType {
+	return core.ORACLE
+}
+
+func TestUpsertWithoutId(t *testing.T) {
+	engine := newTestEngine(t)
+	if err := engine.Sync2(new(UpsertUser)); err != nil {
+		t.Fatal(err)
+	}
+	dialect := engine.dialect
+	engine.dialect = &oracleUpsertDialect{dialect.(*sqlite3)}
+
+	user := &UpsertUser{Name: "a", Age: 10}
+	if affected, err := engine.Upsert(user, "name"); err != nil || affected != 1 {
+		t.Fatal(affected, err)
+	}
+	engine.dialect = dialect
+	var got UpsertUser
+	if has, err := engine.Where("name = ?", "a").Get(&got); err != nil || !has || got.Age != 10 {
+		t.Errorf("the record isn't inserted: %v %v %+v", has, err, got)
+	}
+}
+
+func TestMysqlUpsertIdSql(t *testing.T) {
+	dialect := new(mysql)
+	dialect.Init(nil, &core.Uri{DbType: core.MYSQL}, "mysql", "")
+	rows := [][]string{{"?", "?"}}
+
+	sqlStr := dialect.UpsertIdSql("user", []string{"name", "age"}, rows, []string{"name"}, []string{"age"}, "id")
+	expected := "INSERT INTO `user` (`name`, `age`) VALUES (?, ?) ON DUPLICATE KEY UPDATE `age` = VALUES(`age`), `id` = LAST_INSERT_ID(`id`)"
+	if sqlStr != expected {
+		t.Errorf("got %v", sqlStr)
+	}
+
+	sqlStr = dialect.UpsertIdSql("user", []string{"name", "age"}, rows, []string{"name"}, nil, "id")
+	expected = "INSERT INTO `user` (`name`, `age`) VALUES (?, ?) ON DUPLICATE KEY UPDATE `id` = LAST_INSERT_ID(`id`)"
+	if sqlStr != expected {
+		t.Errorf("got %v", sqlStr)
+	}
+}
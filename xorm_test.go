@@ -0,0 +1,19 @@
+package xorm
+
+import (
+	"path/filepath"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// newTestEngine returns an engine on a new sqlite3 database, closed at the
+// end of the test
+func newTestEngine(t *testing.T) *Engine {
+	engine, err := NewEngine("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { engine.Close() })
+	return engine
+}